@@ -61,8 +61,10 @@ type Channel struct {
 	// The recipients of the channel. This is only populated in DM channels.
 	Recipients []*User `json:"recipients"`
 
-	// The messages in the channel. This is only present in state-cached channels,
-	// and State.MaxMessageCount must be non-zero.
+	// The messages in the channel, oldest first. This is only present in
+	// state-cached channels, and State.MaxMessageCount must be non-zero.
+	// The State mirrors every change of State.Messages into them, so
+	// messages past the MessageCache.TTL remain until the cache next changes.
 	Messages []*Message `json:"-"`
 
 	// A list of permission overwrites present for the channel.
@@ -157,6 +159,18 @@ func (c *Channel) MembersInVoice() (members []*Member, err error) {
 		return
 	}
 
+	if st, ok := c.stateCache(); ok {
+		states, err := st.ChannelVoiceStates(c.ID)
+		if err == nil {
+			for _, voice := range states {
+				if m, err := st.Member(c.GuildID, voice.UserID); err == nil {
+					members = append(members, m)
+				}
+			}
+			return members, nil
+		}
+	}
+
 	g, err := c.Guild()
 	if err != nil {
 		return
@@ -176,6 +190,15 @@ func (c *Channel) MembersInVoice() (members []*Member, err error) {
 	return
 }
 
+// stateCache returns the State of the channel's session, if it uses one.
+func (c *Channel) stateCache() (*State, bool) {
+	if c.Session == nil {
+		return nil, false
+	}
+	st, ok := c.Session.State.(*State)
+	return st, ok
+}
+
 // A ChannelEdit holds Channel Field data for a channel edit.
 type ChannelEdit struct {
 	Name                 string                 `json:"name,omitempty"`
@@ -0,0 +1,277 @@
+package discordgo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// dcaMagic starts the header of a DCA1 stream.
+const dcaMagic = "DCA1"
+
+// DCAMetadata is the metadata of a DCA stream, see
+// https://github.com/bwmarrin/dca/wiki/DCA1-specification
+type DCAMetadata struct {
+	DCA    DCAFormat       `json:"dca"`
+	Opus   DCAOpus         `json:"opus"`
+	Info   DCAInfo         `json:"info"`
+	Origin DCAOrigin       `json:"origin"`
+	Extra  json.RawMessage `json:"extra,omitempty"`
+}
+
+// DCAFormat is the version of a DCA stream, and the tool that encoded it.
+type DCAFormat struct {
+	Version int     `json:"version"`
+	Tool    DCATool `json:"tool"`
+}
+
+// DCATool is the tool that encoded a DCA stream.
+type DCATool struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	URL     string `json:"url"`
+	Author  string `json:"author"`
+}
+
+// DCAOpus is the opus encoding of a DCA stream.
+type DCAOpus struct {
+	Mode       string `json:"mode"`
+	SampleRate int    `json:"sample_rate"`
+	FrameSize  int    `json:"frame_size"`
+	Bitrate    int    `json:"abr"`
+	VBR        bool   `json:"vbr"`
+	Channels   int    `json:"channels"`
+}
+
+// DCAInfo describes the audio of a DCA stream.
+type DCAInfo struct {
+	Title    string  `json:"title"`
+	Artist   string  `json:"artist"`
+	Album    string  `json:"album"`
+	Genre    string  `json:"genre"`
+	Comments string  `json:"comments"`
+	Cover    *string `json:"cover"`
+}
+
+// DCAOrigin describes the source a DCA stream was encoded from.
+type DCAOrigin struct {
+	Source   string `json:"source"`
+	Bitrate  int    `json:"abr"`
+	Channels int    `json:"channels"`
+	Encoding string `json:"encoding"`
+	URL      string `json:"url"`
+}
+
+// A DCAReader reads the opus frames of a DCA stream, in either the DCA0 format
+// of length prefixed frames, or the DCA1 format which adds a metadata header.
+type DCAReader struct {
+	// Metadata is the metadata of a DCA1 stream. For a DCA0 stream, it has
+	// version 0 and the opus encoding Discord expects.
+	Metadata *DCAMetadata
+
+	r       io.Reader
+	start   int64 // offset of the first frame, if r is an io.Seeker
+	samples int64
+}
+
+// NewDCAReader creates a DCAReader, and reads the metadata of the stream.
+func NewDCAReader(r io.Reader) (*DCAReader, error) {
+	d := &DCAReader{r: r}
+
+	if s, ok := r.(io.Seeker); ok {
+		start, err := s.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		d.start = start
+	}
+
+	magic := make([]byte, len(dcaMagic))
+	n, err := io.ReadFull(r, magic)
+	if err == io.EOF {
+		return nil, ErrDCAInvalid
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	magic = magic[:n]
+
+	// DCA0 streams start with their first frame
+	if string(magic) != dcaMagic {
+		if s, ok := r.(io.Seeker); ok {
+			if _, err := s.Seek(d.start, io.SeekStart); err != nil {
+				return nil, err
+			}
+		} else {
+			d.r = io.MultiReader(bytes.NewReader(magic), r)
+		}
+
+		d.Metadata = &DCAMetadata{Opus: DCAOpus{SampleRate: voiceSampleRate, FrameSize: voiceFrameSize, Channels: 2}}
+		return d, nil
+	}
+
+	var size int32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil || size < 0 {
+		return nil, ErrDCAInvalid
+	}
+
+	header := make([]byte, size)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrDCAInvalid
+	}
+
+	d.Metadata = &DCAMetadata{}
+	if err := json.Unmarshal(header, d.Metadata); err != nil {
+		return nil, err
+	}
+
+	d.start += int64(len(dcaMagic) + 4 + len(header))
+	return d, nil
+}
+
+// ReadFrame returns the next opus frame of the stream, or io.EOF once it
+// ended.
+func (d *DCAReader) ReadFrame() ([]byte, error) {
+	var size int16
+	if err := binary.Read(d.r, binary.LittleEndian, &size); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, ErrDCAInvalid
+		}
+		return nil, err
+	}
+
+	if size <= 0 {
+		return nil, ErrDCAInvalid
+	}
+
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(d.r, frame); err != nil {
+		return nil, ErrDCAInvalid
+	}
+
+	d.samples += int64(opusPacketSamples(frame))
+	return frame, nil
+}
+
+// Position returns the duration of the frames read.
+func (d *DCAReader) Position() time.Duration {
+	return time.Duration(d.samples) * time.Second / voiceSampleRate
+}
+
+// Duration returns the duration of the stream, which is read ahead of the
+// frames to return. It returns ErrNotSeekable unless the stream is an
+// io.Seeker.
+func (d *DCAReader) Duration() (time.Duration, error) {
+	s, ok := d.r.(io.ReadSeeker)
+	if !ok {
+		return 0, ErrNotSeekable
+	}
+
+	pos, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	defer s.Seek(pos, io.SeekStart)
+
+	if _, err = s.Seek(d.start, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	// Only the size and TOC bytes of the frames are read
+	var samples int64
+	header := make([]byte, 4)
+	for {
+		n, err := io.ReadFull(s, header)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && n < 3 {
+			return 0, ErrDCAInvalid
+		}
+
+		size := int64(int16(binary.LittleEndian.Uint16(header)))
+		if size <= 0 {
+			return 0, ErrDCAInvalid
+		}
+
+		toc := header[2:n]
+		if int64(len(toc)) > size {
+			toc = toc[:size]
+		}
+
+		samples += int64(opusPacketSamples(toc))
+		if _, err = s.Seek(size-int64(len(header[2:n])), io.SeekCurrent); err != nil {
+			return 0, err
+		}
+	}
+
+	return time.Duration(samples) * time.Second / voiceSampleRate, nil
+}
+
+// A DCAWriter writes opus frames into a DCA stream.
+type DCAWriter struct {
+	w io.Writer
+}
+
+// NewDCAWriter creates a DCAWriter. With metadata, it writes a DCA1 stream
+// starting with the metadata, otherwise a DCA0 stream.
+// w        : The writer of the stream.
+// metadata : The metadata of the stream, can be nil.
+func NewDCAWriter(w io.Writer, metadata *DCAMetadata) (*DCAWriter, error) {
+	d := &DCAWriter{w: w}
+
+	if metadata == nil {
+		return d, nil
+	}
+
+	m := *metadata
+	m.DCA.Version = 1
+	if m.DCA.Tool.Name == "" {
+		m.DCA.Tool = DCATool{Name: "discordgo", Version: VERSION, URL: "https://github.com/auttaja/discordgo"}
+	}
+
+	header, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, len(dcaMagic)+4, len(dcaMagic)+4+len(header))
+	copy(b, dcaMagic)
+	binary.LittleEndian.PutUint32(b[len(dcaMagic):], uint32(len(header)))
+
+	if _, err = w.Write(append(b, header...)); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// WriteFrame writes an opus frame.
+func (d *DCAWriter) WriteFrame(opus []byte) error {
+	if len(opus) == 0 || len(opus) > 1<<15-1 {
+		return ErrOpusPacket
+	}
+
+	b := make([]byte, 2+len(opus))
+	binary.LittleEndian.PutUint16(b, uint16(len(opus)))
+	copy(b[2:], opus)
+
+	_, err := d.w.Write(b)
+	return err
+}
+
+// PlayDCA sends the audio of a DCA stream to a voice connection, until the
+// stream ends or stop is closed. The frames of the stream must be as long as
+// the frames sent by the voice connection, 20ms unless FrameSize is set.
+// r    : The DCA stream.
+// stop : Closed to stop playing, can be nil.
+func (v *VoiceConnection) PlayDCA(r io.Reader, stop <-chan struct{}) error {
+	d, err := NewDCAReader(r)
+	if err != nil {
+		return err
+	}
+
+	return v.playOpus(d.ReadFrame, stop)
+}
@@ -0,0 +1,106 @@
+package discordgo
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// onlyReader hides the io.Seeker of a reader.
+type onlyReader struct {
+	io.Reader
+}
+
+func TestDCAWriterReader(t *testing.T) {
+	frames := [][]byte{{0xFC, 1}, {0xFC, 2, 2}, {0xFC}}
+
+	for _, metadata := range []*DCAMetadata{nil, {Info: DCAInfo{Title: "airhorn"}, Opus: DCAOpus{FrameSize: 960, Channels: 2}}} {
+		var buf bytes.Buffer
+		w, err := NewDCAWriter(&buf, metadata)
+		if err != nil {
+			t.Fatalf("NewDCAWriter returned error: %+v", err)
+		}
+		for _, f := range frames {
+			if err = w.WriteFrame(f); err != nil {
+				t.Fatalf("WriteFrame returned error: %+v", err)
+			}
+		}
+
+		for _, r := range []io.Reader{bytes.NewReader(buf.Bytes()), onlyReader{bytes.NewReader(buf.Bytes())}} {
+			d, err := NewDCAReader(r)
+			if err != nil {
+				t.Fatalf("NewDCAReader returned error: %+v", err)
+			}
+
+			if metadata == nil && (d.Metadata.DCA.Version != 0 || d.Metadata.Opus.FrameSize != 960 || d.Metadata.Opus.Channels != 2) {
+				t.Errorf("DCA0 stream should have the default metadata, got %+v", d.Metadata)
+			}
+			if metadata != nil && (d.Metadata.DCA.Version != 1 || d.Metadata.DCA.Tool.Name != "discordgo" || d.Metadata.Info.Title != "airhorn") {
+				t.Errorf("DCA1 stream should have its metadata, got %+v", d.Metadata)
+			}
+
+			duration, err := d.Duration()
+			if _, seekable := r.(io.Seeker); seekable && (err != nil || duration != 60*time.Millisecond) {
+				t.Errorf("duration should be 60ms, got %s, %+v", duration, err)
+			}
+			if _, seekable := r.(io.Seeker); !seekable && err != ErrNotSeekable {
+				t.Errorf("duration of an unseekable stream should fail, got %+v", err)
+			}
+
+			for _, want := range frames {
+				f, err := d.ReadFrame()
+				if err != nil || !bytes.Equal(f, want) {
+					t.Fatalf("frame should be %x, got %x, %+v", want, f, err)
+				}
+			}
+			if _, err = d.ReadFrame(); err != io.EOF {
+				t.Errorf("stream should end, got %+v", err)
+			}
+
+			if p := d.Position(); p != 60*time.Millisecond {
+				t.Errorf("position should be 60ms, got %s", p)
+			}
+		}
+	}
+}
+
+func TestDCAReaderInvalid(t *testing.T) {
+	for _, b := range [][]byte{nil, []byte("DCA1\x10\x00\x00\x00{}"), {0x05, 0x00, 0xFC}, {0x00, 0x80, 0xFC}} {
+		d, err := NewDCAReader(bytes.NewReader(b))
+		if err == nil {
+			_, err = d.ReadFrame()
+		}
+		if err != ErrDCAInvalid {
+			t.Errorf("stream %x should be invalid, got %+v", b, err)
+		}
+	}
+}
+
+func TestDCAReaderAirhorn(t *testing.T) {
+	f, err := os.Open("examples/airhorn/airhorn.dca")
+	if err != nil {
+		t.Skipf("airhorn.dca not found: %+v", err)
+	}
+	defer f.Close()
+
+	d, err := NewDCAReader(f)
+	if err != nil {
+		t.Fatalf("NewDCAReader returned error: %+v", err)
+	}
+
+	duration, err := d.Duration()
+	if err != nil || duration <= 0 {
+		t.Fatalf("Duration returned %s, %+v", duration, err)
+	}
+
+	for {
+		if _, err = d.ReadFrame(); err != nil {
+			break
+		}
+	}
+	if err != io.EOF || d.Position() != duration {
+		t.Errorf("airhorn.dca should be read to its end at %s, got %s, %+v", duration, d.Position(), err)
+	}
+}
@@ -0,0 +1,334 @@
+package discordtest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrNoInteraction is returned by a replaying Cassette when no recorded
+// interaction matches a request.
+var ErrNoInteraction = errors.New("no matching interaction in cassette")
+
+// A CassetteMode sets whether a Cassette records or replays interactions.
+type CassetteMode int
+
+// Modes of a Cassette
+const (
+	ModeReplay CassetteMode = iota
+	ModeRecord
+)
+
+// boundaryPlaceholder replaces the random boundary of multipart bodies, so
+// that uploads made by separate runs are recorded and matched identically.
+const boundaryPlaceholder = "discordtest-boundary"
+
+// scrubbed replaces the value of scrubbed headers.
+const scrubbed = "[scrubbed]"
+
+// DefaultScrubHeaders are the headers which are scrubbed from recorded
+// interactions, unless Cassette.ScrubHeaders is set.
+var DefaultScrubHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// A CassetteRequest is the recorded half of an interaction sent to Discord.
+type CassetteRequest struct {
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	Query  string      `json:"query,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+	Base64 bool        `json:"base64,omitempty"`
+}
+
+// A CassetteResponse is the recorded half of an interaction received from Discord.
+type CassetteResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	Base64     bool        `json:"base64,omitempty"`
+}
+
+// An Interaction is a single recorded REST request and its response.
+type Interaction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+// A Cassette is an http.RoundTripper which records REST interactions with
+// Discord to a file, or replays them from it, to be used as the Transport of
+// Session.Client in deterministic tests:
+//
+//	c, err := discordtest.NewCassette("testdata/send.json", discordtest.ModeReplay)
+//	dg.Client = &http.Client{Transport: c}
+//
+// Requests are replayed in the order they were recorded, each recorded
+// interaction answers a single request matching its method, path, query and body.
+type Cassette struct {
+	sync.Mutex
+
+	// Mode sets whether requests are recorded or replayed.
+	Mode CassetteMode
+
+	// Transport is used to make the real requests in record mode.
+	// If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	// ScrubHeaders are the request and response headers whose values are
+	// replaced before they are recorded. If nil, DefaultScrubHeaders is used.
+	ScrubHeaders []string
+
+	// Scrub, if set, is called with every interaction before it is recorded,
+	// to remove secrets such as webhook tokens from paths and bodies.
+	Scrub func(i *Interaction)
+
+	Interactions []*Interaction
+
+	path string
+	used []bool
+}
+
+// NewCassette creates a Cassette backed by the file at path.
+// In replay mode the file is loaded and must exist, in record mode it is
+// written when Save is called.
+// path : the path of the cassette file
+// mode : whether to record or replay interactions
+func NewCassette(path string, mode CassetteMode) (*Cassette, error) {
+	c := &Cassette{
+		Mode: mode,
+		path: path,
+	}
+
+	if mode == ModeRecord {
+		return c, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(b, &c.Interactions); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Save writes the recorded interactions to the cassette file.
+func (c *Cassette) Save() error {
+	c.Lock()
+	defer c.Unlock()
+
+	b, err := json.MarshalIndent(c.Interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(c.path, b, os.FileMode(0644))
+}
+
+// RoundTrip implements http.RoundTripper.
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	recorded := CassetteRequest{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  req.URL.Query().Encode(),
+		Header: c.scrub(req.Header),
+	}
+	recorded.Body, recorded.Base64 = encodeBody(normalizeBody(req.Header, body))
+
+	if c.Mode == ModeRecord {
+		return c.record(req, recorded)
+	}
+	return c.replay(req, recorded)
+}
+
+func (c *Cassette) record(req *http.Request, recorded CassetteRequest) (*http.Response, error) {
+	transport := c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	i := &Interaction{
+		Request: recorded,
+		Response: CassetteResponse{
+			StatusCode: resp.StatusCode,
+			Header:     c.scrub(resp.Header),
+		},
+	}
+	i.Response.Body, i.Response.Base64 = encodeBody(body)
+
+	if c.Scrub != nil {
+		c.Scrub(i)
+	}
+
+	c.Lock()
+	c.Interactions = append(c.Interactions, i)
+	c.Unlock()
+
+	return resp, nil
+}
+
+func (c *Cassette) replay(req *http.Request, recorded CassetteRequest) (*http.Response, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.trackInteractions()
+	for n, i := range c.Interactions {
+		if c.used[n] || !i.Request.matches(&recorded) {
+			continue
+		}
+		c.used[n] = true
+
+		body, err := decodeBody(i.Response.Body, i.Response.Base64)
+		if err != nil {
+			return nil, err
+		}
+
+		header := http.Header{}
+		for k, v := range i.Response.Header {
+			header[k] = v
+		}
+
+		// Rate limit resets are relative to the Date header, so it is moved
+		// to now, keeping recorded rate limits from blocking the replay.
+		header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+
+		return &http.Response{
+			Status:        strconv.Itoa(i.Response.StatusCode) + " " + http.StatusText(i.Response.StatusCode),
+			StatusCode:    i.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%s %s: %s", req.Method, req.URL.Path, ErrNoInteraction)
+}
+
+// Done reports whether every recorded interaction has been replayed.
+func (c *Cassette) Done() bool {
+	c.Lock()
+	defer c.Unlock()
+
+	c.trackInteractions()
+	for _, used := range c.used {
+		if !used {
+			return false
+		}
+	}
+	return true
+}
+
+// trackInteractions sizes the replayed interactions to the Interactions,
+// which may be set or appended to after NewCassette. The cassette must be
+// locked.
+func (c *Cassette) trackInteractions() {
+	if len(c.used) == len(c.Interactions) {
+		return
+	}
+
+	used := make([]bool, len(c.Interactions))
+	copy(used, c.used)
+	c.used = used
+}
+
+// matches reports whether the recorded request matches r on method, path,
+// query and body.
+func (cr *CassetteRequest) matches(r *CassetteRequest) bool {
+	return cr.Method == r.Method &&
+		cr.Path == r.Path &&
+		cr.Query == r.Query &&
+		cr.Body == r.Body &&
+		cr.Base64 == r.Base64
+}
+
+// scrub returns a copy of h with the values of the scrubbed headers replaced.
+func (c *Cassette) scrub(h http.Header) http.Header {
+	names := c.ScrubHeaders
+	if names == nil {
+		names = DefaultScrubHeaders
+	}
+
+	out := http.Header{}
+	for k, v := range h {
+		out[k] = append([]string(nil), v...)
+	}
+
+	for _, name := range names {
+		if _, ok := out[http.CanonicalHeaderKey(name)]; ok {
+			out.Set(name, scrubbed)
+		}
+	}
+
+	if ct := out.Get("Content-Type"); ct != "" {
+		if _, params, err := mime.ParseMediaType(ct); err == nil && params["boundary"] != "" {
+			out.Set("Content-Type", strings.Replace(ct, params["boundary"], boundaryPlaceholder, -1))
+		}
+	}
+
+	return out
+}
+
+// normalizeBody replaces the random boundary of a multipart body.
+func normalizeBody(h http.Header, body []byte) []byte {
+	_, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return body
+	}
+
+	return bytes.Replace(body, []byte(params["boundary"]), []byte(boundaryPlaceholder), -1)
+}
+
+// encodeBody returns the body as a string, base64 encoded if it is not valid UTF-8.
+func encodeBody(body []byte) (string, bool) {
+	if utf8.Valid(body) {
+		return string(body), false
+	}
+	return base64.StdEncoding.EncodeToString(body), true
+}
+
+func decodeBody(body string, b64 bool) ([]byte, error) {
+	if b64 {
+		return base64.StdEncoding.DecodeString(body)
+	}
+	return []byte(body), nil
+}
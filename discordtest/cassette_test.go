@@ -0,0 +1,86 @@
+package discordtest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/auttaja/discordgo"
+)
+
+func TestCassetteRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discordtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cassette.json")
+
+	srv := NewServer()
+	srv.Token = "cassette-secret"
+	g := srv.AddGuild(&discordgo.Guild{Name: "test"})
+	c, _ := srv.AddChannel(&discordgo.Channel{GuildID: g.ID, Name: "general"})
+
+	send := func(dg *discordgo.Session) (*discordgo.Message, error) {
+		return dg.ChannelMessageSendComplex(c.ID, &discordgo.MessageSend{
+			Content: "upload",
+			Files: []*discordgo.File{
+				{Name: "file.bin", ContentType: "application/octet-stream", Reader: bytes.NewReader([]byte{0xff, 0x00, 0xfe})},
+			},
+		})
+	}
+
+	rec, err := NewCassette(path, ModeRecord)
+	if err != nil {
+		t.Fatalf("NewCassette returned error: %+v", err)
+	}
+	rec.Transport = srv.Client().Transport
+
+	dg, _ := discordgo.New(srv.Token)
+	dg.Client = &http.Client{Transport: rec}
+
+	recorded, err := send(dg)
+	if err != nil {
+		t.Fatalf("recording send returned error: %+v", err)
+	}
+	if err = rec.Save(); err != nil {
+		t.Fatalf("Save returned error: %+v", err)
+	}
+	srv.Close()
+
+	b, _ := ioutil.ReadFile(path)
+	if strings.Contains(string(b), srv.Token) {
+		t.Errorf("cassette should not contain the token")
+	}
+
+	play, err := NewCassette(path, ModeReplay)
+	if err != nil {
+		t.Fatalf("NewCassette returned error: %+v", err)
+	}
+	dg.Client = &http.Client{Transport: play}
+
+	replayed, err := send(dg)
+	if err != nil {
+		t.Fatalf("replaying send returned error: %+v", err)
+	}
+	if replayed.ID != recorded.ID || len(replayed.Attachments) != 1 || replayed.Attachments[0].Size != 3 {
+		t.Errorf("replayed message should match the recorded one, got %+v", replayed)
+	}
+	if !play.Done() {
+		t.Errorf("every interaction should have been replayed")
+	}
+
+	if _, err = dg.ChannelMessageSend(c.ID, "not recorded"); err == nil {
+		t.Errorf("unrecorded request should return an error")
+	}
+
+	// A cassette can be built without NewCassette.
+	dg.Client = &http.Client{Transport: &Cassette{Mode: ModeReplay, Interactions: play.Interactions}}
+	if _, err = send(dg); err != nil {
+		t.Errorf("replaying send on a cassette literal returned error: %+v", err)
+	}
+}
@@ -0,0 +1,237 @@
+package discordtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/auttaja/discordgo"
+	"github.com/gorilla/websocket"
+)
+
+// writeWait is the time allowed to write a control message to a client.
+const writeWait = time.Second
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// A gatewayPayload is a packet sent over the gateway in either direction.
+type gatewayPayload struct {
+	Operation int             `json:"op"`
+	Sequence  int64           `json:"s,omitempty"`
+	Type      string          `json:"t,omitempty"`
+	Data      json.RawMessage `json:"d"`
+}
+
+// A gatewayConn is a single client connected to the gateway.
+type gatewayConn struct {
+	sync.Mutex
+
+	ws         *websocket.Conn
+	seq        int64
+	identified bool
+	sessionID  string
+}
+
+// send writes a packet to the client. Dispatch (Op 0) packets get the next
+// sequence number of the connection.
+func (c *gatewayConn) send(op int, t string, data json.RawMessage) error {
+	c.Lock()
+	defer c.Unlock()
+
+	p := gatewayPayload{Operation: op, Type: t, Data: data}
+	if op == 0 {
+		c.seq++
+		p.Sequence = c.seq
+	}
+
+	return c.ws.WriteJSON(p)
+}
+
+// dispatch sends the event if the connection has identified or resumed.
+func (c *gatewayConn) dispatch(t string, data json.RawMessage) error {
+	c.Lock()
+	identified := c.identified
+	c.Unlock()
+
+	if !identified {
+		return nil
+	}
+	return c.send(0, t, data)
+}
+
+func (c *gatewayConn) close() {
+	c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeWait))
+	c.ws.Close()
+}
+
+// dispatch sends a dispatch event to every identified gateway connection.
+func (s *Server) dispatch(t string, data json.RawMessage) {
+	s.connsMu.Lock()
+	conns := make([]*gatewayConn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.connsMu.Unlock()
+
+	for _, c := range conns {
+		c.dispatch(t, data)
+	}
+}
+
+// serveGateway upgrades the request to a websocket and serves the gateway
+// protocol on it until the client disconnects.
+func (s *Server) serveGateway(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	c := &gatewayConn{ws: ws}
+
+	s.connsMu.Lock()
+	s.conns[c] = struct{}{}
+	s.connsMu.Unlock()
+
+	defer func() {
+		s.connsMu.Lock()
+		delete(s.conns, c)
+		s.connsMu.Unlock()
+		ws.Close()
+	}()
+
+	hello := marshal(map[string]interface{}{
+		"heartbeat_interval": s.HeartbeatInterval.Nanoseconds() / 1e6,
+	})
+	if err = c.send(10, "", hello); err != nil {
+		return
+	}
+
+	for {
+		var p gatewayPayload
+		if err = ws.ReadJSON(&p); err != nil {
+			return
+		}
+
+		switch p.Operation {
+		case 1:
+			err = c.send(11, "", nil)
+		case 2:
+			err = s.identify(c, p.Data)
+		case 6:
+			err = s.resume(c, p.Data)
+		case 8:
+			err = s.requestGuildMembers(c, p.Data)
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// identify answers an Op 2 Identify packet with READY, followed by a
+// GUILD_CREATE for every guild in the model.
+func (s *Server) identify(c *gatewayConn, data json.RawMessage) error {
+	var d struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(data, &d); err != nil {
+		return err
+	}
+
+	if d.Token != "Bot "+s.Token && d.Token != s.Token {
+		return c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(4004, "Authentication failed."), time.Now().Add(writeWait))
+	}
+
+	s.RLock()
+	ready := discordgo.Ready{
+		Version:         6,
+		SessionID:       s.NewID(),
+		User:            s.User,
+		PrivateChannels: []*discordgo.Channel{},
+		Guilds:          []*discordgo.Guild{},
+	}
+	var guilds []json.RawMessage
+	for _, g := range s.guilds {
+		ready.Guilds = append(ready.Guilds, &discordgo.Guild{ID: g.ID, Unavailable: true})
+		guilds = append(guilds, marshal(g))
+	}
+	readyPayload := marshal(ready)
+
+	c.Lock()
+	c.identified = true
+	c.sessionID = ready.SessionID
+	c.Unlock()
+	s.RUnlock()
+
+	if err := c.send(0, "READY", readyPayload); err != nil {
+		return err
+	}
+
+	for _, g := range guilds {
+		if err := c.send(0, "GUILD_CREATE", g); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resume answers an Op 6 Resume packet. As the server keeps no event
+// backlog, a resume only succeeds on the connection it was identified on.
+func (s *Server) resume(c *gatewayConn, data json.RawMessage) error {
+	var d struct {
+		SessionID string `json:"session_id"`
+	}
+	if err := json.Unmarshal(data, &d); err != nil {
+		return err
+	}
+
+	c.Lock()
+	valid := c.identified && c.sessionID == d.SessionID
+	c.Unlock()
+
+	if !valid {
+		return c.send(9, "", json.RawMessage("false"))
+	}
+
+	return c.send(0, "RESUMED", json.RawMessage("{}"))
+}
+
+// requestGuildMembers answers an Op 8 Request Guild Members packet with
+// a single GUILD_MEMBERS_CHUNK.
+func (s *Server) requestGuildMembers(c *gatewayConn, data json.RawMessage) error {
+	var d struct {
+		GuildID string `json:"guild_id"`
+		Query   string `json:"query"`
+		Limit   int    `json:"limit"`
+	}
+	if err := json.Unmarshal(data, &d); err != nil {
+		return err
+	}
+
+	s.RLock()
+	g, ok := s.guilds[d.GuildID]
+	if !ok {
+		s.RUnlock()
+		return nil
+	}
+
+	chunk := discordgo.GuildMembersChunk{GuildID: g.ID, Members: []*discordgo.Member{}}
+	for _, m := range sortedMembers(g) {
+		if d.Limit > 0 && len(chunk.Members) == d.Limit {
+			break
+		}
+		if strings.HasPrefix(strings.ToLower(m.User.Username), strings.ToLower(d.Query)) {
+			chunk.Members = append(chunk.Members, m)
+		}
+	}
+	payload := marshal(chunk)
+	s.RUnlock()
+
+	return c.send(0, "GUILD_MEMBERS_CHUNK", payload)
+}
@@ -0,0 +1,438 @@
+package discordtest
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+
+	"github.com/auttaja/discordgo"
+)
+
+// Errors returned when the requested object is not part of the model.
+var (
+	ErrUnknownGuild   = errors.New("unknown guild")
+	ErrUnknownChannel = errors.New("unknown channel")
+	ErrUnknownMember  = errors.New("unknown member")
+	ErrUnknownMessage = errors.New("unknown message")
+	ErrUnknownRole    = errors.New("unknown role")
+)
+
+// clone deep copies src into dst by round tripping it through JSON,
+// which is exactly what a client sees of the objects of the model.
+func clone(src, dst interface{}) {
+	b, err := json.Marshal(src)
+	if err != nil {
+		panic(err)
+	}
+	if err = json.Unmarshal(b, dst); err != nil {
+		panic(err)
+	}
+}
+
+// marshal encodes v, panicking on errors as the model only contains
+// types which always encode.
+func marshal(v interface{}) json.RawMessage {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// idLess compares two snowflake IDs numerically.
+func idLess(a, b string) bool {
+	ai, _ := strconv.ParseUint(a, 10, 64)
+	bi, _ := strconv.ParseUint(b, 10, 64)
+	return ai < bi
+}
+
+// AddUser adds a user to the model, giving it an ID if it has none.
+// A copy of the stored user is returned.
+func (s *Server) AddUser(u *discordgo.User) *discordgo.User {
+	s.Lock()
+	defer s.Unlock()
+
+	stored := s.addUser(u)
+
+	var out *discordgo.User
+	clone(stored, &out)
+	return out
+}
+
+func (s *Server) addUser(u *discordgo.User) *discordgo.User {
+	if u.ID == "" {
+		u.ID = s.NewID()
+	}
+	if u.Discriminator == "" {
+		u.Discriminator = "0001"
+	}
+
+	if existing, ok := s.users[u.ID]; ok {
+		return existing
+	}
+
+	var stored *discordgo.User
+	clone(u, &stored)
+	s.users[stored.ID] = stored
+	return stored
+}
+
+// AddGuild adds a guild, including any channels, roles and members it holds,
+// to the model. The bot user is added as a member if it is not one already.
+// A GUILD_CREATE event is sent to every connected session.
+// A copy of the stored guild is returned.
+func (s *Server) AddGuild(g *discordgo.Guild) *discordgo.Guild {
+	s.Lock()
+
+	var stored *discordgo.Guild
+	clone(g, &stored)
+
+	if stored.ID == "" {
+		stored.ID = s.NewID()
+	}
+	if stored.OwnerID == "" {
+		stored.OwnerID = s.User.ID
+	}
+	stored.JoinedAt = timestamp()
+
+	// Every guild has an @everyone role sharing the ID of the guild.
+	if _, err := stored.GetRole(stored.ID); err != nil {
+		stored.Roles = append([]*discordgo.Role{{
+			ID:          stored.ID,
+			Name:        "@everyone",
+			Permissions: discordgo.Permissions(discordgo.PermissionReadMessages | discordgo.PermissionSendMessages),
+		}}, stored.Roles...)
+	}
+	for _, r := range stored.Roles {
+		if r.ID == "" {
+			r.ID = s.NewID()
+		}
+	}
+
+	for _, c := range stored.Channels {
+		if c.ID == "" {
+			c.ID = s.NewID()
+		}
+		c.GuildID = stored.ID
+		s.channels[c.ID] = c
+	}
+
+	for _, m := range stored.Members {
+		m.User = s.addUser(m.User)
+		m.GuildID = stored.ID
+		if m.JoinedAt == "" {
+			m.JoinedAt = timestamp()
+		}
+	}
+	if _, err := stored.GetMember(s.User.ID); err != nil {
+		stored.Members = append(stored.Members, &discordgo.Member{
+			GuildID:  stored.ID,
+			User:     s.User,
+			JoinedAt: timestamp(),
+			Roles:    []string{},
+		})
+	}
+	stored.MemberCount = len(stored.Members)
+
+	s.guilds[stored.ID] = stored
+
+	payload := marshal(stored)
+	s.Unlock()
+
+	s.dispatch("GUILD_CREATE", payload)
+
+	var out *discordgo.Guild
+	clone(payload, &out)
+	return out
+}
+
+// Guild returns a copy of the guild with the given ID.
+func (s *Server) Guild(guildID string) (*discordgo.Guild, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	g, ok := s.guilds[guildID]
+	if !ok {
+		return nil, ErrUnknownGuild
+	}
+
+	var out *discordgo.Guild
+	clone(g, &out)
+	return out, nil
+}
+
+// AddChannel adds a channel to the guild given by its GuildID.
+// A CHANNEL_CREATE event is sent to every connected session.
+// A copy of the stored channel is returned.
+func (s *Server) AddChannel(c *discordgo.Channel) (*discordgo.Channel, error) {
+	s.Lock()
+
+	g, ok := s.guilds[c.GuildID]
+	if !ok {
+		s.Unlock()
+		return nil, ErrUnknownGuild
+	}
+
+	var stored *discordgo.Channel
+	clone(c, &stored)
+	if stored.ID == "" {
+		stored.ID = s.NewID()
+	}
+	g.Channels = append(g.Channels, stored)
+	s.channels[stored.ID] = stored
+
+	payload := marshal(stored)
+	s.Unlock()
+
+	s.dispatch("CHANNEL_CREATE", payload)
+
+	var out *discordgo.Channel
+	clone(payload, &out)
+	return out, nil
+}
+
+// Channel returns a copy of the channel with the given ID.
+func (s *Server) Channel(channelID string) (*discordgo.Channel, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	c, ok := s.channels[channelID]
+	if !ok {
+		return nil, ErrUnknownChannel
+	}
+
+	var out *discordgo.Channel
+	clone(c, &out)
+	return out, nil
+}
+
+// AddMember adds a member to the guild given by its GuildID.
+// A GUILD_MEMBER_ADD event is sent to every connected session.
+// A copy of the stored member is returned.
+func (s *Server) AddMember(m *discordgo.Member) (*discordgo.Member, error) {
+	s.Lock()
+
+	g, ok := s.guilds[m.GuildID]
+	if !ok {
+		s.Unlock()
+		return nil, ErrUnknownGuild
+	}
+
+	var stored *discordgo.Member
+	clone(m, &stored)
+	stored.User = s.addUser(m.User)
+	if stored.JoinedAt == "" {
+		stored.JoinedAt = timestamp()
+	}
+	if stored.Roles == nil {
+		stored.Roles = []string{}
+	}
+
+	if _, err := g.GetMember(stored.User.ID); err == nil {
+		s.Unlock()
+		return nil, errors.New("member already exists")
+	}
+	g.Members = append(g.Members, stored)
+	g.MemberCount++
+
+	payload := marshal(stored)
+	s.Unlock()
+
+	s.dispatch("GUILD_MEMBER_ADD", payload)
+
+	var out *discordgo.Member
+	clone(payload, &out)
+	return out, nil
+}
+
+// RemoveMember removes a member from a guild.
+// A GUILD_MEMBER_REMOVE event is sent to every connected session.
+func (s *Server) RemoveMember(guildID, userID string) error {
+	s.Lock()
+
+	payload, err := s.removeMember(guildID, userID)
+	s.Unlock()
+	if err != nil {
+		return err
+	}
+
+	s.dispatch("GUILD_MEMBER_REMOVE", payload)
+	return nil
+}
+
+func (s *Server) removeMember(guildID, userID string) (json.RawMessage, error) {
+	g, ok := s.guilds[guildID]
+	if !ok {
+		return nil, ErrUnknownGuild
+	}
+
+	for i, m := range g.Members {
+		if m.User.ID == userID {
+			g.Members = append(g.Members[:i], g.Members[i+1:]...)
+			g.MemberCount--
+			return marshal(struct {
+				GuildID string          `json:"guild_id"`
+				User    *discordgo.User `json:"user"`
+			}{guildID, m.User}), nil
+		}
+	}
+
+	return nil, ErrUnknownMember
+}
+
+// Member returns a copy of a member of a guild.
+func (s *Server) Member(guildID, userID string) (*discordgo.Member, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	g, ok := s.guilds[guildID]
+	if !ok {
+		return nil, ErrUnknownGuild
+	}
+
+	m, err := g.GetMember(userID)
+	if err != nil {
+		return nil, ErrUnknownMember
+	}
+
+	var out *discordgo.Member
+	clone(m, &out)
+	return out, nil
+}
+
+// AddRole adds a role to a guild.
+// A GUILD_ROLE_CREATE event is sent to every connected session.
+// A copy of the stored role is returned.
+func (s *Server) AddRole(guildID string, r *discordgo.Role) (*discordgo.Role, error) {
+	s.Lock()
+
+	g, ok := s.guilds[guildID]
+	if !ok {
+		s.Unlock()
+		return nil, ErrUnknownGuild
+	}
+
+	var stored *discordgo.Role
+	clone(r, &stored)
+	if stored.ID == "" {
+		stored.ID = s.NewID()
+	}
+	if stored.Position == 0 {
+		stored.Position = len(g.Roles)
+	}
+	g.Roles = append(g.Roles, stored)
+
+	payload := marshal(discordgo.GuildRole{Role: stored, GuildID: guildID})
+	s.Unlock()
+
+	s.dispatch("GUILD_ROLE_CREATE", payload)
+
+	var out *discordgo.Role
+	clone(stored, &out)
+	return out, nil
+}
+
+// SendMessage posts a message as the given author, as if it was sent by
+// another Discord client. A MESSAGE_CREATE event is sent to every connected session.
+// A copy of the stored message is returned.
+func (s *Server) SendMessage(channelID string, author *discordgo.User, content string) (*discordgo.Message, error) {
+	s.Lock()
+
+	author = s.addUser(author)
+	m, err := s.createMessage(channelID, author, &discordgo.MessageSend{Content: content}, nil)
+	if err != nil {
+		s.Unlock()
+		return nil, err
+	}
+
+	payload := marshal(m)
+	s.Unlock()
+
+	s.dispatch("MESSAGE_CREATE", payload)
+
+	var out *discordgo.Message
+	clone(payload, &out)
+	return out, nil
+}
+
+func (s *Server) createMessage(channelID string, author *discordgo.User, data *discordgo.MessageSend, attachments []*discordgo.MessageAttachment) (*discordgo.Message, error) {
+	c, ok := s.channels[channelID]
+	if !ok {
+		return nil, ErrUnknownChannel
+	}
+
+	m := &discordgo.Message{
+		ID:           s.NewID(),
+		ChannelID:    c.ID,
+		GuildID:      c.GuildID,
+		Content:      data.Content,
+		Timestamp:    timestamp(),
+		Tts:          data.Tts,
+		Author:       author,
+		Attachments:  attachments,
+		Embeds:       []*discordgo.MessageEmbed{},
+		Mentions:     []*discordgo.User{},
+		MentionRoles: []string{},
+	}
+	if m.Attachments == nil {
+		m.Attachments = []*discordgo.MessageAttachment{}
+	}
+	if data.Embed != nil {
+		m.Embeds = append(m.Embeds, data.Embed)
+	}
+
+	if g, ok := s.guilds[c.GuildID]; ok {
+		if member, err := g.GetMember(author.ID); err == nil {
+			m.Member = &discordgo.Member{
+				User:     author,
+				JoinedAt: member.JoinedAt,
+				Nick:     member.Nick,
+				Roles:    member.Roles,
+			}
+		}
+	}
+
+	c.LastMessageID = m.ID
+	s.messages[c.ID] = append(s.messages[c.ID], m)
+	return m, nil
+}
+
+// Messages returns copies of all messages in a channel, oldest first.
+func (s *Server) Messages(channelID string) ([]*discordgo.Message, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if _, ok := s.channels[channelID]; !ok {
+		return nil, ErrUnknownChannel
+	}
+
+	var out []*discordgo.Message
+	clone(s.messages[channelID], &out)
+	return out, nil
+}
+
+// message returns the index of a stored message in its channel.
+func (s *Server) message(channelID, messageID string) (int, *discordgo.Message, error) {
+	if _, ok := s.channels[channelID]; !ok {
+		return 0, nil, ErrUnknownChannel
+	}
+
+	for i, m := range s.messages[channelID] {
+		if m.ID == messageID {
+			return i, m, nil
+		}
+	}
+
+	return 0, nil, ErrUnknownMessage
+}
+
+// sortedMembers returns the members of a guild sorted by user ID.
+func sortedMembers(g *discordgo.Guild) []*discordgo.Member {
+	members := make([]*discordgo.Member, len(g.Members))
+	copy(members, g.Members)
+	sort.Slice(members, func(i, j int) bool {
+		return idLess(members[i].User.ID, members[j].User.ID)
+	})
+	return members
+}
@@ -0,0 +1,982 @@
+package discordtest
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"io/ioutil"
+	"math"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/auttaja/discordgo"
+)
+
+// apiPrefix matches the versioned API prefix of REST paths, e.g. /api/v6/
+var apiPrefix = regexp.MustCompile(`^/api(/v\d+)?/`)
+
+// A handlerFunc handles a REST route, the params hold the values of the
+// ":" segments in the route pattern.
+type handlerFunc func(s *Server, w http.ResponseWriter, r *http.Request, params []string)
+
+type route struct {
+	method  string
+	pattern []string
+	handler handlerFunc
+}
+
+var routes []*route
+
+func handle(method, pattern string, h handlerFunc) {
+	routes = append(routes, &route{method, strings.Split(pattern, "/"), h})
+}
+
+func init() {
+	handle("GET", "gateway", getGateway)
+	handle("GET", "gateway/bot", getGateway)
+
+	handle("GET", "users/:", getUser)
+	handle("GET", "users/@me/guilds", getUserGuilds)
+	handle("POST", "users/@me/channels", postUserChannel)
+
+	handle("GET", "guilds/:", getGuild)
+	handle("PATCH", "guilds/:", patchGuild)
+	handle("GET", "guilds/:/channels", getGuildChannels)
+	handle("POST", "guilds/:/channels", postGuildChannel)
+	handle("GET", "guilds/:/members", getGuildMembers)
+	handle("GET", "guilds/:/members/:", getGuildMember)
+	handle("PATCH", "guilds/:/members/:", patchGuildMember)
+	handle("DELETE", "guilds/:/members/:", deleteGuildMember)
+	handle("PUT", "guilds/:/members/:/roles/:", putGuildMemberRole)
+	handle("DELETE", "guilds/:/members/:/roles/:", deleteGuildMemberRole)
+	handle("GET", "guilds/:/roles", getGuildRoles)
+	handle("POST", "guilds/:/roles", postGuildRole)
+	handle("PATCH", "guilds/:/roles/:", patchGuildRole)
+	handle("DELETE", "guilds/:/roles/:", deleteGuildRole)
+
+	handle("GET", "channels/:", getChannel)
+	handle("PATCH", "channels/:", patchChannel)
+	handle("DELETE", "channels/:", deleteChannel)
+	handle("POST", "channels/:/typing", postTyping)
+	handle("GET", "channels/:/messages", getMessages)
+	handle("POST", "channels/:/messages", postMessage)
+	handle("POST", "channels/:/messages/bulk-delete", postBulkDelete)
+	handle("GET", "channels/:/messages/:", getMessage)
+	handle("PATCH", "channels/:/messages/:", patchMessage)
+	handle("DELETE", "channels/:/messages/:", deleteMessage)
+}
+
+// match reports whether the path segments match the route pattern and
+// returns the values of its ":" segments.
+func (rt *route) match(segments []string) ([]string, bool) {
+	if len(segments) != len(rt.pattern) {
+		return nil, false
+	}
+
+	var params []string
+	for i, p := range rt.pattern {
+		switch {
+		case p == ":":
+			params = append(params, segments[i])
+		case p != segments[i]:
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+// bucketKey returns the rate limit bucket of a request, which like on
+// Discord is per route and major parameter (the first ID in the path).
+func (rt *route) bucketKey(params []string) string {
+	key := rt.method + " "
+	for i, p := range rt.pattern {
+		if i > 0 {
+			key += "/"
+		}
+		if p == ":" && i == 1 && len(params) > 0 {
+			key += params[0]
+		} else {
+			key += p
+		}
+	}
+	return key
+}
+
+// serveREST routes a REST request to its handler.
+func (s *Server) serveREST(w http.ResponseWriter, r *http.Request) {
+	if !apiPrefix.MatchString(r.URL.Path) {
+		writeError(w, http.StatusNotFound, 0, "404: Not Found")
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bot "+s.Token {
+		writeError(w, http.StatusUnauthorized, 0, "401: Unauthorized")
+		return
+	}
+
+	segments := strings.Split(strings.Trim(apiPrefix.ReplaceAllString(r.URL.Path, ""), "/"), "/")
+	for _, rt := range routes {
+		if rt.method != r.Method {
+			continue
+		}
+
+		params, ok := rt.match(segments)
+		if !ok {
+			continue
+		}
+
+		if !s.takeBucket(w, rt.bucketKey(params)) {
+			return
+		}
+
+		rt.handler(s, w, r, params)
+		return
+	}
+
+	writeError(w, http.StatusNotFound, 0, "404: Not Found")
+}
+
+// bucket holds the rate limit state of a single route.
+type bucket struct {
+	remaining int
+	reset     time.Time
+}
+
+// takeBucket takes a request from the bucket with the given key, writing the
+// rate limit headers. If the bucket is exhausted a 429 response is written
+// and false is returned.
+func (s *Server) takeBucket(w http.ResponseWriter, key string) bool {
+	s.bucketsMu.Lock()
+	defer s.bucketsMu.Unlock()
+
+	now := time.Now()
+	b, ok := s.buckets[key]
+	if !ok || now.After(b.reset) {
+		b = &bucket{remaining: s.RateLimit, reset: now.Add(s.RateLimitReset)}
+		s.buckets[key] = b
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	resetAfter := b.reset.Sub(now).Seconds()
+	w.Header().Set("Date", now.UTC().Format(http.TimeFormat))
+	w.Header().Set("X-RateLimit-Bucket", strconv.FormatUint(uint64(h.Sum32()), 16))
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(s.RateLimit))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(int64(math.Ceil(float64(b.reset.UnixNano())/float64(time.Second))), 10))
+	w.Header().Set("X-RateLimit-Reset-After", strconv.FormatFloat(resetAfter, 'f', 3, 64))
+
+	if b.remaining <= 0 {
+		retryAfter := int64(math.Ceil(resetAfter * 1000))
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+		writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+			"message":     "You are being rate limited.",
+			"retry_after": retryAfter,
+			"global":      false,
+		})
+		return false
+	}
+
+	b.remaining--
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(b.remaining))
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if raw, ok := v.(json.RawMessage); ok {
+		w.Write(raw)
+		return
+	}
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status, code int, message string) {
+	writeJSON(w, status, discordgo.APIErrorMessage{Code: code, Message: message})
+}
+
+// writeModelError writes the Discord error response for an error of the model.
+func writeModelError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrUnknownGuild:
+		writeError(w, http.StatusNotFound, discordgo.ErrCodeUnknownGuild, "Unknown Guild")
+	case ErrUnknownChannel:
+		writeError(w, http.StatusNotFound, discordgo.ErrCodeUnknownChannel, "Unknown Channel")
+	case ErrUnknownMember:
+		writeError(w, http.StatusNotFound, discordgo.ErrCodeUnknownMember, "Unknown Member")
+	case ErrUnknownMessage:
+		writeError(w, http.StatusNotFound, discordgo.ErrCodeUnknownMessage, "Unknown Message")
+	case ErrUnknownRole:
+		writeError(w, http.StatusNotFound, discordgo.ErrCodeUnknownRole, "Unknown Role")
+	default:
+		writeError(w, http.StatusBadRequest, discordgo.ErrCodeInvalidFormBody, err.Error())
+	}
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, 50109, "The request body contains invalid JSON.")
+		return false
+	}
+	return true
+}
+
+func getGateway(s *Server, w http.ResponseWriter, r *http.Request, _ []string) {
+	writeJSON(w, http.StatusOK, discordgo.GatewayBotResponse{URL: s.GatewayURL(), Shards: 1})
+}
+
+func getUser(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	s.RLock()
+	defer s.RUnlock()
+
+	userID := p[0]
+	if userID == "@me" {
+		userID = s.User.ID
+	}
+
+	u, ok := s.users[userID]
+	if !ok {
+		writeError(w, http.StatusNotFound, discordgo.ErrCodeUnknownUser, "Unknown User")
+		return
+	}
+	writeJSON(w, http.StatusOK, u)
+}
+
+func getUserGuilds(s *Server, w http.ResponseWriter, r *http.Request, _ []string) {
+	s.RLock()
+	defer s.RUnlock()
+
+	guilds := []*discordgo.UserGuild{}
+	for _, g := range s.guilds {
+		guilds = append(guilds, &discordgo.UserGuild{
+			ID:    g.ID,
+			Name:  g.Name,
+			Icon:  g.Icon,
+			Owner: g.OwnerID == s.User.ID,
+		})
+	}
+	writeJSON(w, http.StatusOK, guilds)
+}
+
+func postUserChannel(s *Server, w http.ResponseWriter, r *http.Request, _ []string) {
+	var data struct {
+		RecipientID string `json:"recipient_id"`
+	}
+	if !readJSON(w, r, &data) {
+		return
+	}
+
+	s.Lock()
+	u, ok := s.users[data.RecipientID]
+	if !ok {
+		s.Unlock()
+		writeError(w, http.StatusNotFound, discordgo.ErrCodeUnknownUser, "Unknown User")
+		return
+	}
+
+	for _, c := range s.channels {
+		if c.Type == discordgo.ChannelTypeDM && len(c.Recipients) == 1 && c.Recipients[0].ID == u.ID {
+			payload := marshal(c)
+			s.Unlock()
+			writeJSON(w, http.StatusOK, payload)
+			return
+		}
+	}
+
+	c := &discordgo.Channel{
+		ID:         s.NewID(),
+		Type:       discordgo.ChannelTypeDM,
+		Recipients: []*discordgo.User{u},
+	}
+	s.channels[c.ID] = c
+	payload := marshal(c)
+	s.Unlock()
+
+	s.dispatch("CHANNEL_CREATE", payload)
+	writeJSON(w, http.StatusOK, payload)
+}
+
+func getGuild(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	s.RLock()
+	defer s.RUnlock()
+
+	g, ok := s.guilds[p[0]]
+	if !ok {
+		writeModelError(w, ErrUnknownGuild)
+		return
+	}
+
+	// The REST API does not return the fields only sent in GUILD_CREATE.
+	out := *g
+	out.Members = nil
+	out.Channels = nil
+	out.Presences = nil
+	out.VoiceStates = nil
+	writeJSON(w, http.StatusOK, out)
+}
+
+func patchGuild(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	var data discordgo.GuildParams
+	if !readJSON(w, r, &data) {
+		return
+	}
+
+	s.Lock()
+	g, ok := s.guilds[p[0]]
+	if !ok {
+		s.Unlock()
+		writeModelError(w, ErrUnknownGuild)
+		return
+	}
+
+	if data.Name != "" {
+		g.Name = data.Name
+	}
+	if data.Region != "" {
+		g.Region = data.Region
+	}
+	if data.VerificationLevel != nil {
+		g.VerificationLevel = *data.VerificationLevel
+	}
+	if data.AfkChannelID != "" {
+		g.AfkChannelID = data.AfkChannelID
+	}
+	if data.AfkTimeout != 0 {
+		g.AfkTimeout = data.AfkTimeout
+	}
+	if data.OwnerID != "" {
+		g.OwnerID = data.OwnerID
+	}
+
+	out := *g
+	out.Members = nil
+	out.Channels = nil
+	out.Presences = nil
+	out.VoiceStates = nil
+	payload := marshal(out)
+	s.Unlock()
+
+	s.dispatch("GUILD_UPDATE", payload)
+	writeJSON(w, http.StatusOK, payload)
+}
+
+func getGuildChannels(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	s.RLock()
+	defer s.RUnlock()
+
+	g, ok := s.guilds[p[0]]
+	if !ok {
+		writeModelError(w, ErrUnknownGuild)
+		return
+	}
+
+	channels := g.Channels
+	if channels == nil {
+		channels = []*discordgo.Channel{}
+	}
+	writeJSON(w, http.StatusOK, channels)
+}
+
+func postGuildChannel(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	var data discordgo.GuildChannelCreateData
+	if !readJSON(w, r, &data) {
+		return
+	}
+
+	c, err := s.AddChannel(&discordgo.Channel{
+		GuildID:              p[0],
+		Name:                 data.Name,
+		Type:                 data.Type,
+		Topic:                data.Topic,
+		Bitrate:              data.Bitrate,
+		UserLimit:            data.UserLimit,
+		PermissionOverwrites: data.PermissionOverwrites,
+		ParentID:             data.ParentID,
+		NSFW:                 data.NSFW,
+	})
+	if err != nil {
+		writeModelError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, c)
+}
+
+func getGuildMembers(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	s.RLock()
+	defer s.RUnlock()
+
+	g, ok := s.guilds[p[0]]
+	if !ok {
+		writeModelError(w, ErrUnknownGuild)
+		return
+	}
+
+	limit := 1
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil {
+		limit = l
+	}
+	if limit < 1 || limit > 1000 {
+		writeError(w, http.StatusBadRequest, discordgo.ErrCodeInvalidFormBody, "Invalid Form Body")
+		return
+	}
+	after := r.URL.Query().Get("after")
+
+	members := []*discordgo.Member{}
+	for _, m := range sortedMembers(g) {
+		if len(members) == limit {
+			break
+		}
+		if after == "" || idLess(after, m.User.ID) {
+			members = append(members, m)
+		}
+	}
+	writeJSON(w, http.StatusOK, members)
+}
+
+func getGuildMember(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	m, err := s.Member(p[0], p[1])
+	if err != nil {
+		writeModelError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, m)
+}
+
+// updateMember applies f to a stored member and sends a GUILD_MEMBER_UPDATE event.
+func (s *Server) updateMember(guildID, userID string, f func(m *discordgo.Member) error) error {
+	s.Lock()
+	g, ok := s.guilds[guildID]
+	if !ok {
+		s.Unlock()
+		return ErrUnknownGuild
+	}
+
+	m, err := g.GetMember(userID)
+	if err != nil {
+		s.Unlock()
+		return ErrUnknownMember
+	}
+
+	if err = f(m); err != nil {
+		s.Unlock()
+		return err
+	}
+
+	payload := marshal(m)
+	s.Unlock()
+
+	s.dispatch("GUILD_MEMBER_UPDATE", payload)
+	return nil
+}
+
+func patchGuildMember(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	var data struct {
+		Roles *[]string `json:"roles"`
+		Nick  *string   `json:"nick"`
+		Mute  *bool     `json:"mute"`
+		Deaf  *bool     `json:"deaf"`
+	}
+	if !readJSON(w, r, &data) {
+		return
+	}
+
+	err := s.updateMember(p[0], p[1], func(m *discordgo.Member) error {
+		if data.Roles != nil {
+			m.Roles = *data.Roles
+		}
+		if data.Nick != nil {
+			m.Nick = *data.Nick
+		}
+		if data.Mute != nil {
+			m.Mute = *data.Mute
+		}
+		if data.Deaf != nil {
+			m.Deaf = *data.Deaf
+		}
+		return nil
+	})
+	if err != nil {
+		writeModelError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func deleteGuildMember(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	if err := s.RemoveMember(p[0], p[1]); err != nil {
+		writeModelError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func putGuildMemberRole(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	err := s.updateMember(p[0], p[1], func(m *discordgo.Member) error {
+		if _, err := s.guilds[p[0]].GetRole(p[2]); err != nil {
+			return ErrUnknownRole
+		}
+		if !discordgo.Contains(m.Roles, p[2]) {
+			m.Roles = append(m.Roles, p[2])
+		}
+		return nil
+	})
+	if err != nil {
+		writeModelError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func deleteGuildMemberRole(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	err := s.updateMember(p[0], p[1], func(m *discordgo.Member) error {
+		for i, roleID := range m.Roles {
+			if roleID == p[2] {
+				m.Roles = append(m.Roles[:i], m.Roles[i+1:]...)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		writeModelError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getGuildRoles(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	g, err := s.Guild(p[0])
+	if err != nil {
+		writeModelError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, g.Roles)
+}
+
+func postGuildRole(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	var data discordgo.RoleSettings
+	if !readJSON(w, r, &data) {
+		return
+	}
+
+	if data.Name == "" {
+		data.Name = "new role"
+	}
+
+	role, err := s.AddRole(p[0], &discordgo.Role{
+		Name:        data.Name,
+		Color:       data.Color,
+		Hoist:       data.Hoist,
+		Permissions: data.Permissions,
+		Mentionable: data.Mentionable,
+	})
+	if err != nil {
+		writeModelError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, role)
+}
+
+func patchGuildRole(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	var data discordgo.RoleSettings
+	if !readJSON(w, r, &data) {
+		return
+	}
+
+	s.Lock()
+	g, ok := s.guilds[p[0]]
+	if !ok {
+		s.Unlock()
+		writeModelError(w, ErrUnknownGuild)
+		return
+	}
+
+	role, err := g.GetRole(p[1])
+	if err != nil {
+		s.Unlock()
+		writeModelError(w, ErrUnknownRole)
+		return
+	}
+
+	if data.Name != "" {
+		role.Name = data.Name
+	}
+	role.Color = data.Color
+	role.Hoist = data.Hoist
+	role.Permissions = data.Permissions
+	role.Mentionable = data.Mentionable
+
+	payload := marshal(discordgo.GuildRole{Role: role, GuildID: g.ID})
+	out := marshal(role)
+	s.Unlock()
+
+	s.dispatch("GUILD_ROLE_UPDATE", payload)
+	writeJSON(w, http.StatusOK, out)
+}
+
+func deleteGuildRole(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	s.Lock()
+	g, ok := s.guilds[p[0]]
+	if !ok {
+		s.Unlock()
+		writeModelError(w, ErrUnknownGuild)
+		return
+	}
+
+	found := false
+	for i, role := range g.Roles {
+		if role.ID == p[1] {
+			g.Roles = append(g.Roles[:i], g.Roles[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if !found {
+		s.Unlock()
+		writeModelError(w, ErrUnknownRole)
+		return
+	}
+
+	for _, m := range g.Members {
+		for i, roleID := range m.Roles {
+			if roleID == p[1] {
+				m.Roles = append(m.Roles[:i], m.Roles[i+1:]...)
+				break
+			}
+		}
+	}
+
+	payload := marshal(discordgo.GuildRoleDelete{RoleID: p[1], GuildID: g.ID})
+	s.Unlock()
+
+	s.dispatch("GUILD_ROLE_DELETE", payload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getChannel(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	c, err := s.Channel(p[0])
+	if err != nil {
+		writeModelError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+func patchChannel(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, 50109, "The request body contains invalid JSON.")
+		return
+	}
+
+	s.Lock()
+	c, ok := s.channels[p[0]]
+	if !ok {
+		s.Unlock()
+		writeModelError(w, ErrUnknownChannel)
+		return
+	}
+
+	// The keys of ChannelEdit match those of Channel, so the edit is
+	// applied by decoding it on top of the stored channel.
+	id, guildID, channelType := c.ID, c.GuildID, c.Type
+	if err = json.Unmarshal(body, c); err != nil {
+		s.Unlock()
+		writeError(w, http.StatusBadRequest, 50109, "The request body contains invalid JSON.")
+		return
+	}
+	c.ID, c.GuildID, c.Type = id, guildID, channelType
+
+	payload := marshal(c)
+	s.Unlock()
+
+	s.dispatch("CHANNEL_UPDATE", payload)
+	writeJSON(w, http.StatusOK, payload)
+}
+
+func deleteChannel(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	s.Lock()
+	c, ok := s.channels[p[0]]
+	if !ok {
+		s.Unlock()
+		writeModelError(w, ErrUnknownChannel)
+		return
+	}
+
+	delete(s.channels, c.ID)
+	delete(s.messages, c.ID)
+	if g, ok := s.guilds[c.GuildID]; ok {
+		for i, gc := range g.Channels {
+			if gc.ID == c.ID {
+				g.Channels = append(g.Channels[:i], g.Channels[i+1:]...)
+				break
+			}
+		}
+	}
+
+	payload := marshal(c)
+	s.Unlock()
+
+	s.dispatch("CHANNEL_DELETE", payload)
+	writeJSON(w, http.StatusOK, payload)
+}
+
+func postTyping(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	c, err := s.Channel(p[0])
+	if err != nil {
+		writeModelError(w, err)
+		return
+	}
+
+	s.dispatch("TYPING_START", marshal(discordgo.TypingStart{
+		UserID:    s.User.ID,
+		ChannelID: c.ID,
+		GuildID:   c.GuildID,
+		Timestamp: int(time.Now().Unix()),
+	}))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getMessages(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if _, ok := s.channels[p[0]]; !ok {
+		writeModelError(w, ErrUnknownChannel)
+		return
+	}
+
+	q := r.URL.Query()
+	limit := 50
+	if l, err := strconv.Atoi(q.Get("limit")); err == nil {
+		limit = l
+	}
+	if limit < 1 || limit > 100 {
+		writeError(w, http.StatusBadRequest, discordgo.ErrCodeInvalidFormBody, "Invalid Form Body")
+		return
+	}
+
+	// Stored messages are oldest first, the API returns them newest first.
+	all := s.messages[p[0]]
+	var selected []*discordgo.Message
+	switch {
+	case q.Get("after") != "":
+		for _, m := range all {
+			if idLess(q.Get("after"), m.ID) && len(selected) < limit {
+				selected = append(selected, m)
+			}
+		}
+	case q.Get("around") != "":
+		around := q.Get("around")
+		var before, after []*discordgo.Message
+		for _, m := range all {
+			if idLess(m.ID, around) {
+				before = append(before, m)
+			} else {
+				after = append(after, m)
+			}
+		}
+		if len(before) > limit/2 {
+			before = before[len(before)-limit/2:]
+		}
+		if len(after) > limit-len(before) {
+			after = after[:limit-len(before)]
+		}
+		selected = append(before, after...)
+	default:
+		before := q.Get("before")
+		for i := len(all) - 1; i >= 0 && len(selected) < limit; i-- {
+			if before == "" || idLess(all[i].ID, before) {
+				selected = append([]*discordgo.Message{all[i]}, selected...)
+			}
+		}
+	}
+
+	out := make([]*discordgo.Message, 0, len(selected))
+	for i := len(selected) - 1; i >= 0; i-- {
+		out = append(out, selected[i])
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func postMessage(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	var data discordgo.MessageSend
+	var attachments []*discordgo.MessageAttachment
+
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+
+			body, err := ioutil.ReadAll(part)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, discordgo.ErrCodeInvalidFormBody, "Invalid Form Body")
+				return
+			}
+
+			if part.FormName() == "payload_json" {
+				if err = json.Unmarshal(body, &data); err != nil {
+					writeError(w, http.StatusBadRequest, 50109, "The request body contains invalid JSON.")
+					return
+				}
+				continue
+			}
+
+			id := s.NewID()
+			attachments = append(attachments, &discordgo.MessageAttachment{
+				ID:       id,
+				Filename: part.FileName(),
+				Size:     len(body),
+				URL:      discordgo.EndpointCDNAttachments + p[0] + "/" + id + "/" + part.FileName(),
+				ProxyURL: discordgo.EndpointCDNAttachments + p[0] + "/" + id + "/" + part.FileName(),
+			})
+		}
+	} else if !readJSON(w, r, &data) {
+		return
+	}
+
+	if data.Content == "" && data.Embed == nil && len(attachments) == 0 {
+		writeError(w, http.StatusBadRequest, discordgo.ErrCodeCannotSendEmptyMessage, "Cannot send an empty message")
+		return
+	}
+
+	s.Lock()
+	m, err := s.createMessage(p[0], s.User, &data, attachments)
+	if err != nil {
+		s.Unlock()
+		writeModelError(w, err)
+		return
+	}
+	payload := marshal(m)
+	s.Unlock()
+
+	s.dispatch("MESSAGE_CREATE", payload)
+	writeJSON(w, http.StatusOK, payload)
+}
+
+func getMessage(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	s.RLock()
+	defer s.RUnlock()
+
+	_, m, err := s.message(p[0], p[1])
+	if err != nil {
+		writeModelError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, m)
+}
+
+func patchMessage(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	var data struct {
+		Content *string                 `json:"content"`
+		Embed   *discordgo.MessageEmbed `json:"embed"`
+		Flags   *discordgo.MessageFlag  `json:"flags"`
+	}
+	if !readJSON(w, r, &data) {
+		return
+	}
+
+	s.Lock()
+	_, m, err := s.message(p[0], p[1])
+	if err != nil {
+		s.Unlock()
+		writeModelError(w, err)
+		return
+	}
+
+	if m.Author.ID != s.User.ID && (data.Content != nil || data.Embed != nil) {
+		s.Unlock()
+		writeError(w, http.StatusForbidden, discordgo.ErrCodeCannotEditFromAnotherUser, "Cannot edit a message authored by another user")
+		return
+	}
+
+	if data.Content != nil {
+		m.Content = *data.Content
+	}
+	if data.Embed != nil {
+		m.Embeds = []*discordgo.MessageEmbed{data.Embed}
+	}
+	if data.Flags != nil {
+		m.Flags = *data.Flags
+	}
+	m.EditedTimestamp = timestamp()
+
+	payload := marshal(m)
+	s.Unlock()
+
+	s.dispatch("MESSAGE_UPDATE", payload)
+	writeJSON(w, http.StatusOK, payload)
+}
+
+func deleteMessage(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	s.Lock()
+	i, m, err := s.message(p[0], p[1])
+	if err != nil {
+		s.Unlock()
+		writeModelError(w, err)
+		return
+	}
+
+	s.messages[p[0]] = append(s.messages[p[0]][:i], s.messages[p[0]][i+1:]...)
+	payload := marshal(struct {
+		ID        string `json:"id"`
+		ChannelID string `json:"channel_id"`
+		GuildID   string `json:"guild_id,omitempty"`
+	}{m.ID, m.ChannelID, m.GuildID})
+	s.Unlock()
+
+	s.dispatch("MESSAGE_DELETE", payload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func postBulkDelete(s *Server, w http.ResponseWriter, r *http.Request, p []string) {
+	var data struct {
+		Messages []string `json:"messages"`
+	}
+	if !readJSON(w, r, &data) {
+		return
+	}
+
+	if len(data.Messages) < 2 || len(data.Messages) > 100 {
+		writeError(w, http.StatusBadRequest, discordgo.ErrCodeTooFewOrTooManyMessagesToDelete, "You can only bulk delete messages between 2 and 100")
+		return
+	}
+
+	s.Lock()
+	c, ok := s.channels[p[0]]
+	if !ok {
+		s.Unlock()
+		writeModelError(w, ErrUnknownChannel)
+		return
+	}
+
+	kept := s.messages[c.ID][:0]
+	for _, m := range s.messages[c.ID] {
+		if !discordgo.Contains(data.Messages, m.ID) {
+			kept = append(kept, m)
+		}
+	}
+	s.messages[c.ID] = kept
+
+	payload := marshal(discordgo.MessageDeleteBulk{
+		Messages:  data.Messages,
+		ChannelID: c.ID,
+		GuildID:   c.GuildID,
+	})
+	s.Unlock()
+
+	s.dispatch("MESSAGE_DELETE_BULK", payload)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,177 @@
+// Package discordtest provides an in-process fake Discord server for testing
+// bots built on discordgo without a network connection or a real account.
+//
+// A Server answers the common REST routes with realistic rate limit headers
+// and runs a local gateway websocket which emits the matching dispatch events
+// whenever its in-memory model changes:
+//
+//	srv := discordtest.NewServer()
+//	defer srv.Close()
+//
+//	g := srv.AddGuild(&discordgo.Guild{Name: "test"})
+//	c, _ := srv.AddChannel(&discordgo.Channel{GuildID: g.ID, Name: "general"})
+//
+//	dg, _ := srv.Session()
+//	dg.AddHandler(func(s *discordgo.Session, m *discordgo.MessageCreate) {
+//	    // ...
+//	})
+//	dg.Open()
+//
+//	srv.SendMessage(c.ID, user, "!ping")
+package discordtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/auttaja/discordgo"
+)
+
+// discordEpoch is the first millisecond of 2015, the epoch of Discord snowflakes.
+const discordEpoch = 1420070400000
+
+// A Server is a fake Discord REST API and gateway running on a local listener.
+type Server struct {
+	sync.RWMutex
+
+	// Token is the bot token sessions created with Session() authenticate with.
+	Token string
+
+	// User is the bot user that every session is logged in as.
+	User *discordgo.User
+
+	// RateLimit is the number of requests allowed per bucket every RateLimitReset.
+	RateLimit      int
+	RateLimitReset time.Duration
+
+	// HeartbeatInterval is the interval sent to clients in the Op 10 Hello packet.
+	HeartbeatInterval time.Duration
+
+	srv       *httptest.Server
+	increment int64
+
+	guilds   map[string]*discordgo.Guild
+	channels map[string]*discordgo.Channel
+	messages map[string][]*discordgo.Message
+	users    map[string]*discordgo.User
+
+	bucketsMu sync.Mutex
+	buckets   map[string]*bucket
+
+	connsMu sync.Mutex
+	conns   map[*gatewayConn]struct{}
+}
+
+// NewServer starts and returns a new Server.
+// The caller should call Close when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		Token:             "discordtest",
+		RateLimit:         50,
+		RateLimitReset:    time.Second,
+		HeartbeatInterval: 41250 * time.Millisecond,
+		guilds:            make(map[string]*discordgo.Guild),
+		channels:          make(map[string]*discordgo.Channel),
+		messages:          make(map[string][]*discordgo.Message),
+		users:             make(map[string]*discordgo.User),
+		buckets:           make(map[string]*bucket),
+		conns:             make(map[*gatewayConn]struct{}),
+	}
+
+	s.User = &discordgo.User{
+		ID:            s.NewID(),
+		Username:      "discordtest",
+		Discriminator: "0000",
+		Bot:           true,
+		Verified:      true,
+	}
+	s.users[s.User.ID] = s.User
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gateway", s.serveGateway)
+	mux.HandleFunc("/gateway/", s.serveGateway)
+	mux.HandleFunc("/", s.serveREST)
+	s.srv = httptest.NewServer(mux)
+
+	return s
+}
+
+// Close closes all gateway connections and shuts the server down.
+func (s *Server) Close() {
+	s.connsMu.Lock()
+	for c := range s.conns {
+		c.close()
+	}
+	s.connsMu.Unlock()
+
+	s.srv.Close()
+}
+
+// URL returns the base URL of the server, of the form http://ipaddr:port.
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// GatewayURL returns the websocket URL of the fake gateway.
+func (s *Server) GatewayURL() string {
+	return "ws" + strings.TrimPrefix(s.srv.URL, "http") + "/gateway"
+}
+
+// Client returns an http.Client which routes every request to the server,
+// regardless of the host it was made for.
+func (s *Server) Client() *http.Client {
+	return &http.Client{
+		Transport: &transport{host: s.srv.Listener.Addr().String()},
+		Timeout:   20 * time.Second,
+	}
+}
+
+// Session returns a new discordgo.Session authenticated as the server's bot
+// user, with its REST requests and gateway connection routed to the server.
+func (s *Server) Session() (*discordgo.Session, error) {
+	dg, err := discordgo.New(s.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	dg.Client = s.Client()
+	dg.SyncEvents = true
+	dg.ShouldReconnectOnError = false
+	return dg, nil
+}
+
+// NewID returns a new snowflake ID, based on the current time.
+func (s *Server) NewID() string {
+	n := atomic.AddInt64(&s.increment, 1)
+	ms := time.Now().UnixNano()/int64(time.Millisecond) - discordEpoch
+	return strconv.FormatInt(ms<<22|n&0x3fffff, 10)
+}
+
+// timestamp returns the current time formatted the way Discord does.
+func timestamp() discordgo.Timestamp {
+	return discordgo.Timestamp(time.Now().UTC().Format("2006-01-02T15:04:05.000000+00:00"))
+}
+
+// transport rewrites every request to be sent to the server.
+type transport struct {
+	host string
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := new(http.Request)
+	*r = *req
+
+	u := *req.URL
+	u.Scheme = "http"
+	u.Host = t.host
+	r.URL = &u
+	r.Host = t.host
+
+	return http.DefaultTransport.RoundTrip(r)
+}
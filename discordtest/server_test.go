@@ -0,0 +1,210 @@
+package discordtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/auttaja/discordgo"
+)
+
+// openSession opens a session against the server, with a channel receiving
+// every event it handles.
+func openSession(t *testing.T, srv *Server) (*discordgo.Session, <-chan interface{}) {
+	dg, err := srv.Session()
+	if err != nil {
+		t.Fatalf("Session returned error: %+v", err)
+	}
+
+	events := make(chan interface{}, 100)
+	dg.AddHandler(func(s *discordgo.Session, e interface{}) {
+		events <- e
+	})
+
+	if err = dg.Open(); err != nil {
+		t.Fatalf("Open returned error: %+v", err)
+	}
+	return dg, events
+}
+
+// waitFor waits for the first event for which match returns true.
+func waitFor(t *testing.T, events <-chan interface{}, match func(e interface{}) bool) interface{} {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-events:
+			if match(e) {
+				return e
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for event")
+			return nil
+		}
+	}
+}
+
+func TestServerSession(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	g := srv.AddGuild(&discordgo.Guild{Name: "test"})
+	c, err := srv.AddChannel(&discordgo.Channel{GuildID: g.ID, Name: "general", Type: discordgo.ChannelTypeGuildText})
+	if err != nil {
+		t.Fatalf("AddChannel returned error: %+v", err)
+	}
+
+	dg, events := openSession(t, srv)
+	defer dg.Close()
+
+	if dg.State.MyUser().ID != srv.User.ID {
+		t.Errorf("session should be logged in as %s, got %s", srv.User.ID, dg.State.MyUser().ID)
+	}
+
+	waitFor(t, events, func(e interface{}) bool {
+		gc, ok := e.(*discordgo.GuildCreate)
+		return ok && gc.ID == g.ID
+	})
+
+	if _, err = dg.State.Channel(c.ID); err != nil {
+		t.Fatalf("channel should be in the state: %+v", err)
+	}
+
+	m, err := dg.ChannelMessageSend(c.ID, "hello")
+	if err != nil {
+		t.Fatalf("ChannelMessageSend returned error: %+v", err)
+	}
+	if m.Content != "hello" || m.Author.ID != srv.User.ID {
+		t.Errorf("unexpected message returned: %+v", m)
+	}
+
+	waitFor(t, events, func(e interface{}) bool {
+		mc, ok := e.(*discordgo.MessageCreate)
+		return ok && mc.ID == m.ID
+	})
+
+	user := &discordgo.User{Username: "someone"}
+	sent, err := srv.SendMessage(c.ID, user, "!ping")
+	if err != nil {
+		t.Fatalf("SendMessage returned error: %+v", err)
+	}
+
+	edit := discordgo.NewMessageEdit(c.ID, m.ID).SetContent("edited")
+	edit.Flags = discordgo.MessageFlagSuppressEmbeds
+	if _, err = dg.ChannelMessageEditComplex(edit); err != nil {
+		t.Fatalf("ChannelMessageEditComplex returned error: %+v", err)
+	}
+
+	// An edit without flags keeps them.
+	b, err := dg.RequestWithBucketID("PATCH", discordgo.EndpointChannelMessage(c.ID, m.ID), map[string]string{"content": "again"}, "")
+	if err != nil {
+		t.Fatalf("editing the message returned error: %+v", err)
+	}
+	var edited discordgo.Message
+	if err = json.Unmarshal(b, &edited); err != nil || edited.Content != "again" || edited.Flags != discordgo.MessageFlagSuppressEmbeds {
+		t.Errorf("edit without flags should keep the flags, got %+v, %+v", edited, err)
+	}
+
+	e := waitFor(t, events, func(e interface{}) bool {
+		mc, ok := e.(*discordgo.MessageCreate)
+		return ok && mc.ID == sent.ID
+	})
+	if e.(*discordgo.MessageCreate).Author.Username != "someone" {
+		t.Errorf("message author should be someone, got %+v", e.(*discordgo.MessageCreate).Author)
+	}
+
+	messages, err := dg.ChannelMessages(c.ID, 10, "", "", "")
+	if err != nil {
+		t.Fatalf("ChannelMessages returned error: %+v", err)
+	}
+	if len(messages) != 2 || messages[0].ID != sent.ID {
+		t.Errorf("expected 2 messages, newest first, got %+v", messages)
+	}
+}
+
+func TestServerMembers(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	g := srv.AddGuild(&discordgo.Guild{Name: "test"})
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if _, err := srv.AddMember(&discordgo.Member{GuildID: g.ID, User: &discordgo.User{Username: name}}); err != nil {
+			t.Fatalf("AddMember returned error: %+v", err)
+		}
+	}
+
+	dg, events := openSession(t, srv)
+	defer dg.Close()
+
+	members, err := dg.GuildMembers(g.ID, "", 1000)
+	if err != nil {
+		t.Fatalf("GuildMembers returned error: %+v", err)
+	}
+	if len(members) != 4 {
+		t.Errorf("expected 4 members, got %d", len(members))
+	}
+
+	if err = dg.RequestGuildMembers(g.ID, "b", 0); err != nil {
+		t.Fatalf("RequestGuildMembers returned error: %+v", err)
+	}
+
+	e := waitFor(t, events, func(e interface{}) bool {
+		_, ok := e.(*discordgo.GuildMembersChunk)
+		return ok
+	})
+	chunk := e.(*discordgo.GuildMembersChunk)
+	if len(chunk.Members) != 1 || chunk.Members[0].User.Username != "bob" {
+		t.Errorf("expected only bob in the chunk, got %+v", chunk.Members)
+	}
+
+	err = dg.GuildMemberRoleAdd(g.ID, chunk.Members[0].User.ID, "unknown", "")
+	if restErr, ok := err.(*discordgo.RESTError); !ok || restErr.Response.StatusCode != http.StatusNotFound || restErr.Message.Code != discordgo.ErrCodeUnknownRole {
+		t.Errorf("adding an unknown role should return Unknown Role, got %+v", err)
+	}
+
+	if err = dg.GuildMemberDelete(g.ID, chunk.Members[0].User.ID); err != nil {
+		t.Fatalf("GuildMemberDelete returned error: %+v", err)
+	}
+
+	waitFor(t, events, func(e interface{}) bool {
+		_, ok := e.(*discordgo.GuildMemberRemove)
+		return ok
+	})
+}
+
+func TestServerRateLimit(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.RateLimit = 2
+
+	g := srv.AddGuild(&discordgo.Guild{Name: "test"})
+
+	client := srv.Client()
+	get := func() *http.Response {
+		req, _ := http.NewRequest("GET", discordgo.EndpointGuild(g.ID), nil)
+		req.Header.Set("Authorization", "Bot "+srv.Token)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request returned error: %+v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := get()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") != "1" || resp.Header.Get("X-RateLimit-Reset") == "" {
+		t.Errorf("missing rate limit headers: %+v", resp.Header)
+	}
+
+	get()
+	resp = get()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Errorf("429 response should have a Retry-After header")
+	}
+}
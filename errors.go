@@ -73,6 +73,43 @@ var (
 	// ErrGuildNoSplash gets returned when the guild does not have a splash set while requesting the splash image
 	ErrGuildNoSplash = errors.New("guild does not have a splash set")
 
+	// ErrSnapshotVersion gets returned when loading a state snapshot written in an unsupported format version
+	ErrSnapshotVersion = errors.New("unsupported state snapshot version")
+
+	// ErrSnapshotUnsupported gets returned when saving or loading a snapshot of a
+	// Session.State that is not a *State
+	ErrSnapshotUnsupported = errors.New("the state cache does not support snapshots")
+
+	// ErrVoiceDecrypt gets returned when a received voice packet could not be decrypted
+	ErrVoiceDecrypt = errors.New("could not decrypt voice packet")
+
+	// ErrVoiceIPDiscovery gets returned when the external address of a voice connection could not be discovered
+	ErrVoiceIPDiscovery = errors.New("voice ip discovery failed")
+
+	// ErrVoiceNotReady gets returned when sending audio to a voice connection that is not connected yet
+	ErrVoiceNotReady = errors.New("voice connection is not ready")
+
+	// ErrOggInvalid gets returned when reading a stream that is not a valid Ogg Opus stream
+	ErrOggInvalid = errors.New("invalid ogg opus stream")
+
+	// ErrOpusPacket gets returned when writing an invalid opus packet
+	ErrOpusPacket = errors.New("invalid opus packet")
+
+	// ErrOpusFrameSize gets returned when playing opus packets that are not a frame long
+	ErrOpusFrameSize = errors.New("opus packets must be a frame long")
+
+	// ErrDCAInvalid gets returned when reading a stream that is not a valid DCA stream
+	ErrDCAInvalid = errors.New("invalid dca stream")
+
+	// ErrNotSeekable gets returned when a method needs to seek in a stream that is not an io.Seeker
+	ErrNotSeekable = errors.New("the stream is not seekable")
+
+	// ErrTrackSkipped gets returned when a track of a VoicePlayer was skipped
+	ErrTrackSkipped = errors.New("the track was skipped")
+
+	// ErrPlayerStopped gets returned when a VoicePlayer was stopped
+	ErrPlayerStopped = errors.New("the voice player is stopped")
+
 	// ErrUnauthorized gets returned when the HTTP request was unauthorized
 	ErrUnauthorized = errors.New("HTTP request was unauthorized. This could be because the provided token was not a bot token")
 )
@@ -248,7 +248,11 @@ func (s *Session) setSession(g *Guild) {
 	}
 
 	for _, m := range g.Members {
-		m.User.Session = s
+		// Users can be shared between guilds, so they are only
+		// written to when their session changes.
+		if m.User.Session != s {
+			m.User.Session = s
+		}
 		m.GuildID = g.ID
 	}
 
@@ -282,6 +286,10 @@ func (s *Session) onInterface(i interface{}) {
 		go s.onVoiceStateUpdate(t)
 	}
 
+	if s.InviteTracker != nil {
+		s.InviteTracker.onInterface(s, i)
+	}
+
 	if s.State == nil {
 		panic("the state is nil in onInterface")
 	}
@@ -7,50 +7,55 @@ package discordgo
 // Event type values are used to match the events returned by Discord.
 // EventTypes surrounded by __ are synthetic and are internal to DiscordGo.
 const (
-	channelCreateEventType            = "CHANNEL_CREATE"
-	channelDeleteEventType            = "CHANNEL_DELETE"
-	channelPinsUpdateEventType        = "CHANNEL_PINS_UPDATE"
-	channelUpdateEventType            = "CHANNEL_UPDATE"
-	connectEventType                  = "__CONNECT__"
-	disconnectEventType               = "__DISCONNECT__"
-	eventEventType                    = "__EVENT__"
-	guildBanAddEventType              = "GUILD_BAN_ADD"
-	guildBanRemoveEventType           = "GUILD_BAN_REMOVE"
-	guildCreateEventType              = "GUILD_CREATE"
-	guildDeleteEventType              = "GUILD_DELETE"
-	guildEmojisUpdateEventType        = "GUILD_EMOJIS_UPDATE"
-	guildIntegrationsUpdateEventType  = "GUILD_INTEGRATIONS_UPDATE"
-	guildMemberAddEventType           = "GUILD_MEMBER_ADD"
-	guildMemberRemoveEventType        = "GUILD_MEMBER_REMOVE"
-	guildMemberUpdateEventType        = "GUILD_MEMBER_UPDATE"
-	guildMembersChunkEventType        = "GUILD_MEMBERS_CHUNK"
-	guildRoleCreateEventType          = "GUILD_ROLE_CREATE"
-	guildRoleDeleteEventType          = "GUILD_ROLE_DELETE"
-	guildRoleUpdateEventType          = "GUILD_ROLE_UPDATE"
-	guildUpdateEventType              = "GUILD_UPDATE"
-	messageAckEventType               = "MESSAGE_ACK"
-	messageCreateEventType            = "MESSAGE_CREATE"
-	messageDeleteEventType            = "MESSAGE_DELETE"
-	messageDeleteBulkEventType        = "MESSAGE_DELETE_BULK"
-	messageReactionAddEventType       = "MESSAGE_REACTION_ADD"
-	messageReactionRemoveEventType    = "MESSAGE_REACTION_REMOVE"
-	messageReactionRemoveAllEventType = "MESSAGE_REACTION_REMOVE_ALL"
-	messageUpdateEventType            = "MESSAGE_UPDATE"
-	presenceUpdateEventType           = "PRESENCE_UPDATE"
-	presencesReplaceEventType         = "PRESENCES_REPLACE"
-	rateLimitEventType                = "__RATE_LIMIT__"
-	readyEventType                    = "READY"
-	relationshipAddEventType          = "RELATIONSHIP_ADD"
-	relationshipRemoveEventType       = "RELATIONSHIP_REMOVE"
-	resumedEventType                  = "RESUMED"
-	typingStartEventType              = "TYPING_START"
-	userGuildSettingsUpdateEventType  = "USER_GUILD_SETTINGS_UPDATE"
-	userNoteUpdateEventType           = "USER_NOTE_UPDATE"
-	userSettingsUpdateEventType       = "USER_SETTINGS_UPDATE"
-	userUpdateEventType               = "USER_UPDATE"
-	voiceServerUpdateEventType        = "VOICE_SERVER_UPDATE"
-	voiceStateUpdateEventType         = "VOICE_STATE_UPDATE"
-	webhooksUpdateEventType           = "WEBHOOKS_UPDATE"
+	channelCreateEventType              = "CHANNEL_CREATE"
+	channelDeleteEventType              = "CHANNEL_DELETE"
+	channelPinsUpdateEventType          = "CHANNEL_PINS_UPDATE"
+	channelUpdateEventType              = "CHANNEL_UPDATE"
+	connectEventType                    = "__CONNECT__"
+	disconnectEventType                 = "__DISCONNECT__"
+	eventEventType                      = "__EVENT__"
+	guildBanAddEventType                = "GUILD_BAN_ADD"
+	guildBanRemoveEventType             = "GUILD_BAN_REMOVE"
+	guildCreateEventType                = "GUILD_CREATE"
+	guildDeleteEventType                = "GUILD_DELETE"
+	guildEmojisUpdateEventType          = "GUILD_EMOJIS_UPDATE"
+	guildIntegrationsUpdateEventType    = "GUILD_INTEGRATIONS_UPDATE"
+	guildMemberAddEventType             = "GUILD_MEMBER_ADD"
+	guildMemberJoinedViaInviteEventType = "__GUILD_MEMBER_JOINED_VIA_INVITE__"
+	guildMemberRemoveEventType          = "GUILD_MEMBER_REMOVE"
+	guildMemberUpdateEventType          = "GUILD_MEMBER_UPDATE"
+	guildMembersChunkEventType          = "GUILD_MEMBERS_CHUNK"
+	guildRoleCreateEventType            = "GUILD_ROLE_CREATE"
+	guildRoleDeleteEventType            = "GUILD_ROLE_DELETE"
+	guildRoleUpdateEventType            = "GUILD_ROLE_UPDATE"
+	guildStateDriftEventType            = "__GUILD_STATE_DRIFT__"
+	guildUpdateEventType                = "GUILD_UPDATE"
+	inviteCreateEventType               = "INVITE_CREATE"
+	inviteDeleteEventType               = "INVITE_DELETE"
+	messageAckEventType                 = "MESSAGE_ACK"
+	messageCreateEventType              = "MESSAGE_CREATE"
+	messageDeleteBulkEventType          = "MESSAGE_DELETE_BULK"
+	messageDeleteEventType              = "MESSAGE_DELETE"
+	messageReactionAddEventType         = "MESSAGE_REACTION_ADD"
+	messageReactionRemoveAllEventType   = "MESSAGE_REACTION_REMOVE_ALL"
+	messageReactionRemoveEmojiEventType = "MESSAGE_REACTION_REMOVE_EMOJI"
+	messageReactionRemoveEventType      = "MESSAGE_REACTION_REMOVE"
+	messageUpdateEventType              = "MESSAGE_UPDATE"
+	presenceUpdateEventType             = "PRESENCE_UPDATE"
+	presencesReplaceEventType           = "PRESENCES_REPLACE"
+	rateLimitEventType                  = "__RATE_LIMIT__"
+	readyEventType                      = "READY"
+	relationshipAddEventType            = "RELATIONSHIP_ADD"
+	relationshipRemoveEventType         = "RELATIONSHIP_REMOVE"
+	resumedEventType                    = "RESUMED"
+	typingStartEventType                = "TYPING_START"
+	userGuildSettingsUpdateEventType    = "USER_GUILD_SETTINGS_UPDATE"
+	userNoteUpdateEventType             = "USER_NOTE_UPDATE"
+	userSettingsUpdateEventType         = "USER_SETTINGS_UPDATE"
+	userUpdateEventType                 = "USER_UPDATE"
+	voiceServerUpdateEventType          = "VOICE_SERVER_UPDATE"
+	voiceStateUpdateEventType           = "VOICE_STATE_UPDATE"
+	webhooksUpdateEventType             = "WEBHOOKS_UPDATE"
 )
 
 // channelCreateEventHandler is an event handler for ChannelCreate events.
@@ -318,6 +323,21 @@ func (eh guildMemberAddEventHandler) Handle(s *Session, i interface{}) {
 	}
 }
 
+// guildMemberJoinedViaInviteEventHandler is an event handler for GuildMemberJoinedViaInvite events.
+type guildMemberJoinedViaInviteEventHandler func(*Session, *GuildMemberJoinedViaInvite)
+
+// Type returns the event type for GuildMemberJoinedViaInvite events.
+func (eh guildMemberJoinedViaInviteEventHandler) Type() string {
+	return guildMemberJoinedViaInviteEventType
+}
+
+// Handle is the handler for GuildMemberJoinedViaInvite events.
+func (eh guildMemberJoinedViaInviteEventHandler) Handle(s *Session, i interface{}) {
+	if t, ok := i.(*GuildMemberJoinedViaInvite); ok {
+		eh(s, t)
+	}
+}
+
 // guildMemberRemoveEventHandler is an event handler for GuildMemberRemove events.
 type guildMemberRemoveEventHandler func(*Session, *GuildMemberRemove)
 
@@ -438,6 +458,21 @@ func (eh guildRoleUpdateEventHandler) Handle(s *Session, i interface{}) {
 	}
 }
 
+// guildStateDriftEventHandler is an event handler for GuildStateDrift events.
+type guildStateDriftEventHandler func(*Session, *GuildStateDrift)
+
+// Type returns the event type for GuildStateDrift events.
+func (eh guildStateDriftEventHandler) Type() string {
+	return guildStateDriftEventType
+}
+
+// Handle is the handler for GuildStateDrift events.
+func (eh guildStateDriftEventHandler) Handle(s *Session, i interface{}) {
+	if t, ok := i.(*GuildStateDrift); ok {
+		eh(s, t)
+	}
+}
+
 // guildUpdateEventHandler is an event handler for GuildUpdate events.
 type guildUpdateEventHandler func(*Session, *GuildUpdate)
 
@@ -458,6 +493,46 @@ func (eh guildUpdateEventHandler) Handle(s *Session, i interface{}) {
 	}
 }
 
+// inviteCreateEventHandler is an event handler for InviteCreate events.
+type inviteCreateEventHandler func(*Session, *InviteCreate)
+
+// Type returns the event type for InviteCreate events.
+func (eh inviteCreateEventHandler) Type() string {
+	return inviteCreateEventType
+}
+
+// New returns a new instance of InviteCreate.
+func (eh inviteCreateEventHandler) New() interface{} {
+	return &InviteCreate{}
+}
+
+// Handle is the handler for InviteCreate events.
+func (eh inviteCreateEventHandler) Handle(s *Session, i interface{}) {
+	if t, ok := i.(*InviteCreate); ok {
+		eh(s, t)
+	}
+}
+
+// inviteDeleteEventHandler is an event handler for InviteDelete events.
+type inviteDeleteEventHandler func(*Session, *InviteDelete)
+
+// Type returns the event type for InviteDelete events.
+func (eh inviteDeleteEventHandler) Type() string {
+	return inviteDeleteEventType
+}
+
+// New returns a new instance of InviteDelete.
+func (eh inviteDeleteEventHandler) New() interface{} {
+	return &InviteDelete{}
+}
+
+// Handle is the handler for InviteDelete events.
+func (eh inviteDeleteEventHandler) Handle(s *Session, i interface{}) {
+	if t, ok := i.(*InviteDelete); ok {
+		eh(s, t)
+	}
+}
+
 // messageAckEventHandler is an event handler for MessageAck events.
 type messageAckEventHandler func(*Session, *MessageAck)
 
@@ -598,6 +673,26 @@ func (eh messageReactionRemoveAllEventHandler) Handle(s *Session, i interface{})
 	}
 }
 
+// messageReactionRemoveEmojiEventHandler is an event handler for MessageReactionRemoveEmoji events.
+type messageReactionRemoveEmojiEventHandler func(*Session, *MessageReactionRemoveEmoji)
+
+// Type returns the event type for MessageReactionRemoveEmoji events.
+func (eh messageReactionRemoveEmojiEventHandler) Type() string {
+	return messageReactionRemoveEmojiEventType
+}
+
+// New returns a new instance of MessageReactionRemoveEmoji.
+func (eh messageReactionRemoveEmojiEventHandler) New() interface{} {
+	return &MessageReactionRemoveEmoji{}
+}
+
+// Handle is the handler for MessageReactionRemoveEmoji events.
+func (eh messageReactionRemoveEmojiEventHandler) Handle(s *Session, i interface{}) {
+	if t, ok := i.(*MessageReactionRemoveEmoji); ok {
+		eh(s, t)
+	}
+}
+
 // messageUpdateEventHandler is an event handler for MessageUpdate events.
 type messageUpdateEventHandler func(*Session, *MessageUpdate)
 
@@ -865,6 +960,8 @@ func handlerForInterface(handler interface{}) EventHandler {
 		return guildIntegrationsUpdateEventHandler(v)
 	case func(*Session, *GuildMemberAdd):
 		return guildMemberAddEventHandler(v)
+	case func(*Session, *GuildMemberJoinedViaInvite):
+		return guildMemberJoinedViaInviteEventHandler(v)
 	case func(*Session, *GuildMemberRemove):
 		return guildMemberRemoveEventHandler(v)
 	case func(*Session, *GuildMemberUpdate):
@@ -877,8 +974,14 @@ func handlerForInterface(handler interface{}) EventHandler {
 		return guildRoleDeleteEventHandler(v)
 	case func(*Session, *GuildRoleUpdate):
 		return guildRoleUpdateEventHandler(v)
+	case func(*Session, *GuildStateDrift):
+		return guildStateDriftEventHandler(v)
 	case func(*Session, *GuildUpdate):
 		return guildUpdateEventHandler(v)
+	case func(*Session, *InviteCreate):
+		return inviteCreateEventHandler(v)
+	case func(*Session, *InviteDelete):
+		return inviteDeleteEventHandler(v)
 	case func(*Session, *MessageAck):
 		return messageAckEventHandler(v)
 	case func(*Session, *MessageCreate):
@@ -893,6 +996,8 @@ func handlerForInterface(handler interface{}) EventHandler {
 		return messageReactionRemoveEventHandler(v)
 	case func(*Session, *MessageReactionRemoveAll):
 		return messageReactionRemoveAllEventHandler(v)
+	case func(*Session, *MessageReactionRemoveEmoji):
+		return messageReactionRemoveEmojiEventHandler(v)
 	case func(*Session, *MessageUpdate):
 		return messageUpdateEventHandler(v)
 	case func(*Session, *PresenceUpdate):
@@ -941,6 +1046,8 @@ func init() {
 	registerInterfaceProvider(guildRoleDeleteEventHandler(nil))
 	registerInterfaceProvider(guildRoleUpdateEventHandler(nil))
 	registerInterfaceProvider(guildUpdateEventHandler(nil))
+	registerInterfaceProvider(inviteCreateEventHandler(nil))
+	registerInterfaceProvider(inviteDeleteEventHandler(nil))
 	registerInterfaceProvider(messageAckEventHandler(nil))
 	registerInterfaceProvider(messageCreateEventHandler(nil))
 	registerInterfaceProvider(messageDeleteEventHandler(nil))
@@ -948,6 +1055,7 @@ func init() {
 	registerInterfaceProvider(messageReactionAddEventHandler(nil))
 	registerInterfaceProvider(messageReactionRemoveEventHandler(nil))
 	registerInterfaceProvider(messageReactionRemoveAllEventHandler(nil))
+	registerInterfaceProvider(messageReactionRemoveEmojiEventHandler(nil))
 	registerInterfaceProvider(messageUpdateEventHandler(nil))
 	registerInterfaceProvider(presenceUpdateEventHandler(nil))
 	registerInterfaceProvider(presencesReplaceEventHandler(nil))
@@ -103,6 +103,20 @@ type GuildMemberAdd struct {
 	*Member
 }
 
+// GuildMemberJoinedViaInvite is the data for a GuildMemberJoinedViaInvite event.
+// It is sent by the InviteTracker after a GuildMemberAdd event.
+type GuildMemberJoinedViaInvite struct {
+	*Member
+
+	// The invite the member most likely joined with, nil if it could not be
+	// worked out, such as before the invites of the guild were fetched
+	Invite *Invite
+
+	// Whether the member joined with the vanity URL of the guild,
+	// Invite then only holds the vanity code and its uses
+	Vanity bool
+}
+
 // GuildMemberUpdate is the data for a GuildMemberUpdate event.
 type GuildMemberUpdate struct {
 	*Member
@@ -144,6 +158,16 @@ type GuildMembersChunk struct {
 	Members []*Member `json:"members"`
 }
 
+// GuildStateDrift is the data for a GuildStateDrift event.
+// It is sent by a StateChecker for a guild whose entities in the state
+// differ from the API.
+type GuildStateDrift struct {
+	GuildID string
+
+	// The drifted entities that were found.
+	Drift []*StateDrift
+}
+
 // GuildIntegrationsUpdate is the data for a GuildIntegrationsUpdate event.
 type GuildIntegrationsUpdate struct {
 	GuildID string `json:"guild_id"`
@@ -170,21 +194,32 @@ type MessageUpdate struct {
 // MessageDelete is the data for a MessageDelete event.
 type MessageDelete struct {
 	*Message
+	BeforeDelete *Message `json:"-"`
 }
 
 // MessageReactionAdd is the data for a MessageReactionAdd event.
 type MessageReactionAdd struct {
 	*MessageReaction
+	BeforeUpdate []*MessageReactions `json:"-"`
 }
 
 // MessageReactionRemove is the data for a MessageReactionRemove event.
 type MessageReactionRemove struct {
 	*MessageReaction
+	BeforeUpdate []*MessageReactions `json:"-"`
 }
 
 // MessageReactionRemoveAll is the data for a MessageReactionRemoveAll event.
 type MessageReactionRemoveAll struct {
 	*MessageReaction
+	BeforeUpdate []*MessageReactions `json:"-"`
+}
+
+// MessageReactionRemoveEmoji is the data for a MessageReactionRemoveEmoji event,
+// sent when all reactions with an emoji are removed from a message.
+type MessageReactionRemoveEmoji struct {
+	*MessageReaction
+	BeforeUpdate []*MessageReactions `json:"-"`
 }
 
 // PresencesReplace is the data for a PresencesReplace event.
@@ -238,9 +273,10 @@ type VoiceStateUpdate struct {
 
 // MessageDeleteBulk is the data for a MessageDeleteBulk event
 type MessageDeleteBulk struct {
-	Messages  []string `json:"ids"`
-	ChannelID string   `json:"channel_id"`
-	GuildID   string   `json:"guild_id"`
+	Messages     []string   `json:"ids"`
+	ChannelID    string     `json:"channel_id"`
+	GuildID      string     `json:"guild_id"`
+	BeforeDelete []*Message `json:"-"`
 }
 
 // WebhooksUpdate is the data for a WebhooksUpdate event
@@ -248,3 +284,17 @@ type WebhooksUpdate struct {
 	GuildID   string `json:"guild_id"`
 	ChannelID string `json:"channel_id"`
 }
+
+// InviteCreate is the data for a InviteCreate event
+type InviteCreate struct {
+	*Invite
+	ChannelID string `json:"channel_id"`
+	GuildID   string `json:"guild_id"`
+}
+
+// InviteDelete is the data for a InviteDelete event
+type InviteDelete struct {
+	ChannelID string `json:"channel_id"`
+	GuildID   string `json:"guild_id"`
+	Code      string `json:"code"`
+}
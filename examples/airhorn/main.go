@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/binary"
 	"flag"
 	"fmt"
 	"io"
@@ -142,19 +141,20 @@ func loadSound() error {
 		fmt.Println("Error opening dca file :", err)
 		return err
 	}
+	defer file.Close()
 
-	var opuslen int16
+	dca, err := discordgo.NewDCAReader(file)
+	if err != nil {
+		fmt.Println("Error reading dca file :", err)
+		return err
+	}
 
 	for {
-		// Read opus frame length from dca file.
-		err = binary.Read(file, binary.LittleEndian, &opuslen)
+		// Read an opus frame from the dca file.
+		frame, err := dca.ReadFrame()
 
 		// If this is the end of the file, just return.
-		if err == io.EOF || err == io.ErrUnexpectedEOF {
-			err := file.Close()
-			if err != nil {
-				return err
-			}
+		if err == io.EOF {
 			return nil
 		}
 
@@ -163,18 +163,8 @@ func loadSound() error {
 			return err
 		}
 
-		// Read encoded pcm from dca file.
-		InBuf := make([]byte, opuslen)
-		err = binary.Read(file, binary.LittleEndian, &InBuf)
-
-		// Should not be any end of file errors
-		if err != nil {
-			fmt.Println("Error reading from dca file :", err)
-			return err
-		}
-
 		// Append encoded pcm data to the buffer.
-		buffer = append(buffer, InBuf)
+		buffer = append(buffer, frame)
 	}
 }
 
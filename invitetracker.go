@@ -0,0 +1,271 @@
+package discordgo
+
+import (
+	"sync"
+)
+
+// An InviteTracker keeps the use counts of the invites of every guild, to work
+// out which invite a new member joined with. Assign it to Session.InviteTracker
+// before opening the session; it needs the Manage Server permission in the
+// guilds it tracks.
+//
+// After every GuildMemberAdd event the invites of the guild are fetched again,
+// and a GuildMemberJoinedViaInvite event is sent with the invite whose uses went up.
+// As the invites are fetched over REST, that event is always sent asynchronously.
+// The event is sent for every GuildMemberAdd, with a nil Invite when the
+// guild is not tracked yet or its invites could not be fetched.
+type InviteTracker struct {
+	sync.RWMutex
+
+	guilds map[string]*trackedGuild
+}
+
+// trackedGuild holds the invites of a single guild.
+type trackedGuild struct {
+	sync.Mutex
+
+	// Joins are handled one at a time, without holding the lock of the
+	// guild while invites are fetched.
+	joins sync.Mutex
+
+	invites map[string]*Invite
+
+	// Invites deleted since the last member joined; an invite reaching its
+	// maximum uses is deleted as the member joins with it.
+	deleted map[string]*Invite
+
+	// Invites created, or nil for deleted, while the invites are fetched
+	// after a join. They are applied over the fetched invites.
+	changed map[string]*Invite
+
+	vanityCode string
+	vanityUses int
+}
+
+// NewInviteTracker creates an empty InviteTracker.
+func NewInviteTracker() *InviteTracker {
+	return &InviteTracker{
+		guilds: make(map[string]*trackedGuild),
+	}
+}
+
+// Invites returns copies of the tracked invites of a guild.
+// guildID : The ID of a Guild.
+func (t *InviteTracker) Invites(guildID string) ([]*Invite, error) {
+	if t == nil {
+		return nil, ErrNilState
+	}
+
+	tg := t.guild(guildID)
+	if tg == nil {
+		return nil, ErrStateNotFound
+	}
+
+	tg.Lock()
+	defer tg.Unlock()
+
+	invites := make([]*Invite, 0, len(tg.invites))
+	for _, i := range tg.invites {
+		ic := *i
+		invites = append(invites, &ic)
+	}
+
+	return invites, nil
+}
+
+func (t *InviteTracker) guild(guildID string) *trackedGuild {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.guilds[guildID]
+}
+
+// onInterface updates the tracker with an event. Invite changes are applied
+// straight away, fetching invites is done in a separate goroutine.
+func (t *InviteTracker) onInterface(s *Session, i interface{}) {
+	switch e := i.(type) {
+	case *GuildCreate:
+		go t.seed(s, e.ID, e.VanityURLCode)
+	case *GuildDelete:
+		t.Lock()
+		delete(t.guilds, e.ID)
+		t.Unlock()
+	case *InviteCreate:
+		tg := t.guild(e.GuildID)
+		if tg == nil || e.Invite == nil {
+			return
+		}
+
+		tg.Lock()
+		ic := *e.Invite
+		tg.invites[ic.Code] = &ic
+		if tg.changed != nil {
+			tg.changed[ic.Code] = &ic
+		}
+		tg.Unlock()
+	case *InviteDelete:
+		tg := t.guild(e.GuildID)
+		if tg == nil {
+			return
+		}
+
+		tg.Lock()
+		if invite, ok := tg.invites[e.Code]; ok {
+			tg.deleted[e.Code] = invite
+			delete(tg.invites, e.Code)
+		}
+		if tg.changed != nil {
+			tg.changed[e.Code] = nil
+		}
+		tg.Unlock()
+	case *GuildMemberAdd:
+		go t.memberAdd(s, e.Member)
+	}
+}
+
+// seed fetches the invites of a guild to start tracking it.
+func (t *InviteTracker) seed(s *Session, guildID, vanityCode string) {
+	invites, err := s.GuildInvites(guildID)
+	if err != nil {
+		s.log(LogWarning, "error fetching invites of guild %s, not tracking it, %s", guildID, err)
+		return
+	}
+
+	tg := &trackedGuild{
+		invites: make(map[string]*Invite),
+		deleted: make(map[string]*Invite),
+	}
+	for _, i := range invites {
+		tg.invites[i.Code] = i
+	}
+
+	if vanityCode != "" {
+		vanity, err := s.GuildVanityURL(guildID)
+		if err == nil {
+			tg.vanityCode = vanity.Code
+			tg.vanityUses = vanity.Uses
+		}
+	}
+
+	t.Lock()
+	t.guilds[guildID] = tg
+	t.Unlock()
+}
+
+// memberAdd works out the invite a new member used and sends a
+// GuildMemberJoinedViaInvite event.
+func (t *InviteTracker) memberAdd(s *Session, m *Member) {
+	e := &GuildMemberJoinedViaInvite{Member: m}
+
+	tg := t.guild(m.GuildID)
+	if tg == nil {
+		s.handleEvent(guildMemberJoinedViaInviteEventType, e)
+		return
+	}
+
+	// Joins are handled one at a time per guild, so that every
+	// join is compared against the uses after the previous one.
+	tg.joins.Lock()
+	defer tg.joins.Unlock()
+
+	tg.Lock()
+	tg.changed = make(map[string]*Invite)
+	tg.Unlock()
+
+	invites, err := s.GuildInvites(m.GuildID)
+	if err != nil {
+		tg.Lock()
+		tg.changed = nil
+		tg.Unlock()
+
+		s.log(LogWarning, "error fetching invites of guild %s, %s", m.GuildID, err)
+		s.handleEvent(guildMemberJoinedViaInviteEventType, e)
+		return
+	}
+
+	tg.Lock()
+	e.Invite = usedInvite(tg.invites, tg.deleted, invites)
+	vanityCode, vanityUses := tg.vanityCode, tg.vanityUses
+	tg.Unlock()
+
+	if e.Invite == nil && vanityCode != "" {
+		vanity, err := s.GuildVanityURL(m.GuildID)
+		if err == nil && vanity.Uses > vanityUses {
+			vanityUses = vanity.Uses
+			e.Invite = vanity
+			e.Vanity = true
+		}
+	}
+
+	tg.Lock()
+	tg.vanityUses = vanityUses
+
+	tg.invites = make(map[string]*Invite, len(invites))
+	for _, i := range invites {
+		tg.invites[i.Code] = i
+	}
+
+	// Keep the changes made while fetching
+	for code, i := range tg.changed {
+		if i != nil {
+			tg.invites[code] = i
+		} else {
+			delete(tg.invites, code)
+		}
+	}
+	tg.deleted = make(map[string]*Invite)
+	tg.changed = nil
+
+	tg.Unlock()
+
+	s.handleEvent(guildMemberJoinedViaInviteEventType, e)
+}
+
+// usedInvite compares the known invites of a guild with freshly fetched ones
+// and returns the invite that was most likely used to join.
+// known   : The invites of the guild before the member joined.
+// deleted : The invites deleted since the last member joined.
+// current : The invites of the guild after the member joined.
+func usedInvite(known, deleted map[string]*Invite, current []*Invite) *Invite {
+	for _, i := range current {
+		uses := 0
+		if k, ok := known[i.Code]; ok {
+			uses = k.Uses
+		}
+
+		if i.Uses > uses {
+			return i
+		}
+	}
+
+	// An invite with a single use left is deleted when it is used,
+	// either the gateway told us already or it is just missing now.
+	candidates := make([]*Invite, 0, len(deleted))
+	for _, i := range deleted {
+		candidates = append(candidates, i)
+	}
+	for code, i := range known {
+		if !containsInvite(current, code) {
+			candidates = append(candidates, i)
+		}
+	}
+
+	for _, i := range candidates {
+		if i.MaxUses > 0 && i.Uses+1 >= i.MaxUses {
+			ic := *i
+			ic.Uses++
+			return &ic
+		}
+	}
+
+	return nil
+}
+
+func containsInvite(invites []*Invite, code string) bool {
+	for _, i := range invites {
+		if i.Code == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package discordgo
+
+import (
+	"testing"
+)
+
+func TestUsedInvite(t *testing.T) {
+	known := map[string]*Invite{
+		"a": {Code: "a", Uses: 1},
+		"b": {Code: "b", Uses: 5},
+		"c": {Code: "c", Uses: 2, MaxUses: 3},
+	}
+
+	i := usedInvite(known, nil, []*Invite{
+		{Code: "a", Uses: 1},
+		{Code: "b", Uses: 6},
+		{Code: "c", Uses: 2, MaxUses: 3},
+	})
+	if i == nil || i.Code != "b" {
+		t.Errorf("invite b should have been used, got %+v", i)
+	}
+
+	i = usedInvite(known, nil, []*Invite{
+		{Code: "a", Uses: 1},
+		{Code: "b", Uses: 5},
+		{Code: "d", Uses: 1},
+	})
+	if i == nil || i.Code != "d" {
+		t.Errorf("new invite d should have been used, got %+v", i)
+	}
+
+	i = usedInvite(known, nil, []*Invite{
+		{Code: "a", Uses: 1},
+		{Code: "b", Uses: 5},
+	})
+	if i == nil || i.Code != "c" || i.Uses != 3 {
+		t.Errorf("expired invite c should have been used, got %+v", i)
+	}
+
+	i = usedInvite(known, nil, []*Invite{
+		{Code: "a", Uses: 1},
+		{Code: "b", Uses: 5},
+		{Code: "c", Uses: 2, MaxUses: 3},
+	})
+	if i != nil {
+		t.Errorf("no invite should have been used, got %+v", i)
+	}
+}
+
+func TestInviteTrackerEvents(t *testing.T) {
+	tracker := NewInviteTracker()
+	tracker.guilds["1"] = &trackedGuild{
+		invites: map[string]*Invite{"a": {Code: "a", Uses: 2, MaxUses: 3}},
+		deleted: make(map[string]*Invite),
+	}
+
+	tracker.onInterface(nil, &InviteCreate{Invite: &Invite{Code: "b"}, GuildID: "1"})
+	tracker.onInterface(nil, &InviteDelete{Code: "a", GuildID: "1"})
+	tracker.onInterface(nil, &InviteCreate{GuildID: "1"})
+
+	invites, err := tracker.Invites("1")
+	if err != nil {
+		t.Fatalf("Invites returned error: %+v", err)
+	}
+	if len(invites) != 1 || invites[0].Code != "b" {
+		t.Errorf("only invite b should be tracked, got %+v", invites)
+	}
+
+	tg := tracker.guild("1")
+	i := usedInvite(tg.invites, tg.deleted, []*Invite{{Code: "b"}})
+	if i == nil || i.Code != "a" {
+		t.Errorf("deleted invite a should have been used, got %+v", i)
+	}
+
+	if _, err = tracker.Invites("2"); err != ErrStateNotFound {
+		t.Errorf("untracked guild should return ErrStateNotFound, got %+v", err)
+	}
+}
+
+func TestInviteTrackerUntrackedJoin(t *testing.T) {
+	s, _ := New()
+	s.SyncEvents = true
+
+	var joins []*GuildMemberJoinedViaInvite
+	s.AddHandler(func(s *Session, e *GuildMemberJoinedViaInvite) { joins = append(joins, e) })
+
+	NewInviteTracker().memberAdd(s, &Member{GuildID: "2", User: &User{ID: "3"}})
+	if len(joins) != 1 || joins[0].Invite != nil || joins[0].User.ID != "3" {
+		t.Errorf("a join to an untracked guild should be sent without an invite, got %+v", joins)
+	}
+}
@@ -0,0 +1,106 @@
+package discordgo
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A KV is a key-value store a KVState keeps its entities in.
+// Implementations must be safe for concurrent use.
+type KV interface {
+	// Get returns the value of a key, or ErrStateNotFound if it is not set.
+	Get(key string) ([]byte, error)
+
+	// Set sets the value of a key.
+	Set(key string, value []byte) error
+
+	// Delete removes a key, removing a key that is not set is not an error.
+	Delete(key string) error
+
+	// Scan calls fn for every key starting with prefix, in key order.
+	// Scanning stops at the first error returned by fn, which Scan returns.
+	// fn may change the KV while scanning.
+	Scan(prefix string, fn func(key string, value []byte) error) error
+}
+
+// A MemoryKV is a KV kept in memory, mostly useful for tests.
+type MemoryKV struct {
+	sync.RWMutex
+
+	data map[string][]byte
+}
+
+// NewMemoryKV creates an empty MemoryKV.
+func NewMemoryKV() *MemoryKV {
+	return &MemoryKV{
+		data: make(map[string][]byte),
+	}
+}
+
+// Get returns a copy of the value of a key.
+func (kv *MemoryKV) Get(key string) ([]byte, error) {
+	kv.RLock()
+	defer kv.RUnlock()
+
+	v, ok := kv.data[key]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+
+	return append([]byte(nil), v...), nil
+}
+
+// Set stores a copy of the value of a key.
+func (kv *MemoryKV) Set(key string, value []byte) error {
+	kv.Lock()
+	kv.data[key] = append([]byte(nil), value...)
+	kv.Unlock()
+
+	return nil
+}
+
+// Delete removes a key.
+func (kv *MemoryKV) Delete(key string) error {
+	kv.Lock()
+	delete(kv.data, key)
+	kv.Unlock()
+
+	return nil
+}
+
+// Scan calls fn for every key starting with prefix, in key order.
+// The keys are collected first, so fn may change the KV.
+func (kv *MemoryKV) Scan(prefix string, fn func(key string, value []byte) error) error {
+	kv.RLock()
+	keys := make([]string, 0)
+	for k := range kv.data {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	kv.RUnlock()
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v, err := kv.Get(k)
+		if err == ErrStateNotFound {
+			continue
+		}
+
+		if err = fn(k, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Len returns the number of keys in the KV.
+func (kv *MemoryKV) Len() int {
+	kv.RLock()
+	defer kv.RUnlock()
+
+	return len(kv.data)
+}
@@ -0,0 +1,1116 @@
+package discordgo
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// A KVState is a StateCache keeping its entities JSON encoded in a KV, so
+// that the cache can live in an external store. Events are handled exactly
+// like a State handles them, including the BeforeUpdate copies.
+//
+// Every lookup decodes a fresh copy of the entity, which later events never
+// change. Several processes can share a KV, as long as every guild is only
+// written to by the process receiving its events, e.g. one per shard.
+//
+// Entities are stored under the following keys:
+//
+//	ready                      the current user and session
+//	guild:<guild>              a guild, without its members, presences,
+//	                           voice states and channels
+//	member:<guild>:<user>      a member of a guild
+//	presence:<guild>:<user>    a presence in a guild
+//	voice:<guild>:<user>       a voice state in a guild
+//	channel:<channel>          a guild or private channel
+//	messages:<channel>         the last messages of a channel
+//	user:<user>                a user
+//	userguild:<user>:<guild>   set while a user is a member of a guild
+type KVState struct {
+	// MaxMessageCount represents how many messages per channel the state will store.
+	MaxMessageCount int
+	TrackChannels   bool
+	TrackEmojis     bool
+	TrackMembers    bool
+	TrackRoles      bool
+	TrackVoice      bool
+	TrackPresences  bool
+
+	kv KV
+
+	// mu serializes the changes to entities, which are read, merged and written back.
+	mu sync.Mutex
+
+	// The session set on the decoded entities.
+	session atomic.Value
+}
+
+// NewKVState creates a state storing its entities in kv.
+// kv : The store to keep the entities in.
+func NewKVState(kv KV) *KVState {
+	return &KVState{
+		kv:             kv,
+		TrackChannels:  true,
+		TrackEmojis:    true,
+		TrackMembers:   true,
+		TrackRoles:     true,
+		TrackVoice:     true,
+		TrackPresences: true,
+	}
+}
+
+// kvGuild is a guild as stored in a KV, with its channels referred to by ID.
+type kvGuild struct {
+	*Guild
+
+	ChannelIDs []string `json:"channel_ids"`
+}
+
+func kvGuildKey(guildID string) string {
+	return "guild:" + guildID
+}
+
+func kvMemberKey(guildID, userID string) string {
+	return "member:" + guildID + ":" + userID
+}
+
+func kvPresenceKey(guildID, userID string) string {
+	return "presence:" + guildID + ":" + userID
+}
+
+func kvVoiceKey(guildID, userID string) string {
+	return "voice:" + guildID + ":" + userID
+}
+
+func kvChannelKey(channelID string) string {
+	return "channel:" + channelID
+}
+
+func kvMessagesKey(channelID string) string {
+	return "messages:" + channelID
+}
+
+func kvUserKey(userID string) string {
+	return "user:" + userID
+}
+
+func kvUserGuildKey(userID, guildID string) string {
+	return "userguild:" + userID + ":" + guildID
+}
+
+const kvReadyKey = "ready"
+
+func (s *KVState) get(key string, v interface{}) error {
+	b, err := s.kv.Get(key)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+func (s *KVState) set(key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return s.kv.Set(key, b)
+}
+
+func (s *KVState) exists(key string) error {
+	_, err := s.kv.Get(key)
+	return err
+}
+
+// scan decodes every value under a prefix into the value returned by next.
+func (s *KVState) scan(prefix string, next func() interface{}) error {
+	return s.kv.Scan(prefix, func(_ string, value []byte) error {
+		return json.Unmarshal(value, next())
+	})
+}
+
+// keys returns every key under a prefix, without the prefix.
+func (s *KVState) keys(prefix string) ([]string, error) {
+	var keys []string
+	err := s.kv.Scan(prefix, func(key string, _ []byte) error {
+		keys = append(keys, strings.TrimPrefix(key, prefix))
+		return nil
+	})
+	return keys, err
+}
+
+func (s *KVState) deletePrefix(prefix string) error {
+	keys, err := s.keys(prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		if err = s.kv.Delete(prefix + k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *KVState) setSession(se *Session) {
+	if se != nil {
+		s.session.Store(se)
+	}
+}
+
+func (s *KVState) getSession() *Session {
+	se, _ := s.session.Load().(*Session)
+	return se
+}
+
+func (s *KVState) options() stateOptions {
+	return stateOptions{
+		MaxMessageCount: s.MaxMessageCount,
+		TrackChannels:   s.TrackChannels,
+		TrackEmojis:     s.TrackEmojis,
+		TrackMembers:    s.TrackMembers,
+		TrackRoles:      s.TrackRoles,
+		TrackVoice:      s.TrackVoice,
+		TrackPresences:  s.TrackPresences,
+	}
+}
+
+// view calls f straight away, as decoded entities are never shared.
+func (s *KVState) view(id string, f func()) {
+	f()
+}
+
+// guildIDs returns the IDs of the guilds in the KV.
+func (s *KVState) guildIDs() ([]string, error) {
+	return s.keys(kvGuildKey(""))
+}
+
+func (s *KVState) guildRecord(guildID string) (*kvGuild, error) {
+	g := &kvGuild{}
+	if err := s.get(kvGuildKey(guildID), g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// guildSummary gets a guild by ID from its record alone, without its
+// members, presences, voice states and channels.
+func (s *KVState) guildSummary(guildID string) (*Guild, error) {
+	rec, err := s.guildRecord(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	if se := s.getSession(); se != nil {
+		se.setSession(rec.Guild)
+	}
+
+	return rec.Guild, nil
+}
+
+func (s *KVState) putGuild(g *kvGuild) error {
+	gc := *g.Guild
+	gc.Members = nil
+	gc.Presences = nil
+	gc.VoiceStates = nil
+	gc.Channels = nil
+
+	return s.set(kvGuildKey(gc.ID), &kvGuild{Guild: &gc, ChannelIDs: g.ChannelIDs})
+}
+
+func (s *KVState) putMember(member *Member) error {
+	if err := s.set(kvMemberKey(member.GuildID, member.User.ID), member); err != nil {
+		return err
+	}
+	if err := s.set(kvUserKey(member.User.ID), member.User); err != nil {
+		return err
+	}
+	return s.kv.Set(kvUserGuildKey(member.User.ID, member.GuildID), []byte("{}"))
+}
+
+// removeMember removes a member, and its user once it is in no guild at all.
+func (s *KVState) removeMember(guildID, userID string) error {
+	if err := s.kv.Delete(kvMemberKey(guildID, userID)); err != nil {
+		return err
+	}
+	if err := s.kv.Delete(kvUserGuildKey(userID, guildID)); err != nil {
+		return err
+	}
+
+	guilds, err := s.keys(kvUserGuildKey(userID, ""))
+	if err != nil || len(guilds) > 0 {
+		return err
+	}
+
+	return s.kv.Delete(kvUserKey(userID))
+}
+
+func (s *KVState) removeChannel(channelID string) error {
+	if err := s.kv.Delete(kvChannelKey(channelID)); err != nil {
+		return err
+	}
+	return s.kv.Delete(kvMessagesKey(channelID))
+}
+
+// GuildAdd adds a guild to the current world state, or
+// updates it if it already exists.
+func (s *KVState) GuildAdd(guild *Guild, se *Session) error {
+	if s == nil {
+		return ErrNilState
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.setSession(se)
+	return s.guildAdd(guild)
+}
+
+// guildAdd stores a guild, dropping the channels and members of the stored
+// guild that are missing from it, like State.GuildAdd.
+func (s *KVState) guildAdd(guild *Guild) error {
+	old, err := s.guildRecord(guild.ID)
+	if err != nil && err != ErrStateNotFound {
+		return err
+	}
+	exists := err == nil
+
+	g := &kvGuild{Guild: guild}
+	if exists {
+		// Preserve the fields the new guild does not contain.
+		if guild.MemberCount == 0 {
+			guild.MemberCount = old.MemberCount
+		}
+		if guild.Roles == nil {
+			guild.Roles = old.Roles
+		}
+		if guild.Emojis == nil {
+			guild.Emojis = old.Emojis
+		}
+		g.ChannelIDs = old.ChannelIDs
+	}
+
+	if guild.Channels != nil {
+		channels := make(map[string]bool, len(guild.Channels))
+		g.ChannelIDs = make([]string, 0, len(guild.Channels))
+		for _, c := range guild.Channels {
+			if c.GuildID == "" {
+				c.GuildID = guild.ID
+			}
+			if err = s.set(kvChannelKey(c.ID), c); err != nil {
+				return err
+			}
+			channels[c.ID] = true
+			g.ChannelIDs = append(g.ChannelIDs, c.ID)
+		}
+
+		if exists {
+			for _, id := range old.ChannelIDs {
+				if !channels[id] {
+					if err = s.removeChannel(id); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	if guild.Members != nil {
+		members := make(map[string]bool, len(guild.Members))
+		for _, m := range guild.Members {
+			m.GuildID = guild.ID
+			if err = s.putMember(m); err != nil {
+				return err
+			}
+			members[m.User.ID] = true
+		}
+
+		// Large guilds are only sent with their online members,
+		// so the other known members are kept.
+		if exists && !guild.Large {
+			userIDs, err := s.keys(kvMemberKey(guild.ID, ""))
+			if err != nil {
+				return err
+			}
+			for _, id := range userIDs {
+				if !members[id] {
+					if err = s.removeMember(guild.ID, id); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	if guild.Presences != nil {
+		if err = s.deletePrefix(kvPresenceKey(guild.ID, "")); err != nil {
+			return err
+		}
+		for _, p := range guild.Presences {
+			if err = s.set(kvPresenceKey(guild.ID, p.User.ID), p); err != nil {
+				return err
+			}
+		}
+	}
+
+	if guild.VoiceStates != nil {
+		if err = s.deletePrefix(kvVoiceKey(guild.ID, "")); err != nil {
+			return err
+		}
+		for _, v := range guild.VoiceStates {
+			if err = s.set(kvVoiceKey(guild.ID, v.UserID), v); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.putGuild(g)
+}
+
+// GuildRemove removes a guild from current world state.
+func (s *KVState) GuildRemove(guild *Guild) error {
+	if s == nil {
+		return ErrNilState
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.guildRemove(guild.ID)
+}
+
+func (s *KVState) guildRemove(guildID string) error {
+	g, err := s.guildRecord(guildID)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range g.ChannelIDs {
+		if err = s.removeChannel(id); err != nil {
+			return err
+		}
+	}
+
+	userIDs, err := s.keys(kvMemberKey(guildID, ""))
+	if err != nil {
+		return err
+	}
+	for _, id := range userIDs {
+		if err = s.removeMember(guildID, id); err != nil {
+			return err
+		}
+	}
+
+	if err = s.deletePrefix(kvPresenceKey(guildID, "")); err != nil {
+		return err
+	}
+	if err = s.deletePrefix(kvVoiceKey(guildID, "")); err != nil {
+		return err
+	}
+
+	return s.kv.Delete(kvGuildKey(guildID))
+}
+
+// Guild gets a guild by ID, with all of its members, presences, voice
+// states and channels. Prefer the other lookups when only a part of the
+// guild is needed, as those are decoded from separate keys.
+func (s *KVState) Guild(guildID string) (*Guild, error) {
+	if s == nil {
+		return nil, ErrNilState
+	}
+
+	rec, err := s.guildRecord(guildID)
+	if err != nil {
+		return nil, err
+	}
+	g := rec.Guild
+
+	for _, id := range rec.ChannelIDs {
+		c, err := s.Channel(id)
+		if err != nil {
+			return nil, err
+		}
+		g.Channels = append(g.Channels, c)
+	}
+
+	err = s.scan(kvMemberKey(guildID, ""), func() interface{} {
+		m := &Member{}
+		g.Members = append(g.Members, m)
+		return m
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.scan(kvPresenceKey(guildID, ""), func() interface{} {
+		p := &Presence{}
+		g.Presences = append(g.Presences, p)
+		return p
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.scan(kvVoiceKey(guildID, ""), func() interface{} {
+		v := &VoiceState{}
+		g.VoiceStates = append(g.VoiceStates, v)
+		return v
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if se := s.getSession(); se != nil {
+		se.setSession(g)
+	}
+
+	return g, nil
+}
+
+// PresenceAdd adds a presence to the current world state, or
+// updates it if it already exists.
+func (s *KVState) PresenceAdd(guildID string, presence *Presence) error {
+	if s == nil {
+		return ErrNilState
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.exists(kvGuildKey(guildID)); err != nil {
+		return err
+	}
+
+	p := &Presence{}
+	err := s.get(kvPresenceKey(guildID, presence.User.ID), p)
+	if err == ErrStateNotFound {
+		return s.set(kvPresenceKey(guildID, presence.User.ID), presence)
+	}
+	if err != nil {
+		return err
+	}
+
+	mergePresence(p, presence)
+	return s.set(kvPresenceKey(guildID, presence.User.ID), p)
+}
+
+// PresenceRemove removes a presence from the current world state.
+func (s *KVState) PresenceRemove(guildID string, presence *Presence) error {
+	if s == nil {
+		return ErrNilState
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.exists(kvGuildKey(guildID)); err != nil {
+		return err
+	}
+	if err := s.exists(kvPresenceKey(guildID, presence.User.ID)); err != nil {
+		return err
+	}
+
+	return s.kv.Delete(kvPresenceKey(guildID, presence.User.ID))
+}
+
+// Presence gets a presence by ID from a guild.
+func (s *KVState) Presence(guildID, userID string) (*Presence, error) {
+	if s == nil {
+		return nil, ErrNilState
+	}
+
+	p := &Presence{}
+	if err := s.get(kvPresenceKey(guildID, userID), p); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// MemberAdd adds a member to the current world state, or
+// updates it if it already exists.
+func (s *KVState) MemberAdd(member *Member, se *Session) error {
+	if s == nil {
+		return ErrNilState
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.setSession(se)
+
+	if err := s.exists(kvGuildKey(member.GuildID)); err != nil {
+		return err
+	}
+
+	member.User.Session = se
+
+	old := &Member{}
+	err := s.get(kvMemberKey(member.GuildID, member.User.ID), old)
+	if err != nil && err != ErrStateNotFound {
+		return err
+	}
+	if err == nil && member.JoinedAt == "" {
+		member.JoinedAt = old.JoinedAt
+	}
+
+	return s.putMember(member)
+}
+
+// MemberRemove removes a member from current world state.
+func (s *KVState) MemberRemove(member *Member) error {
+	if s == nil {
+		return ErrNilState
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.exists(kvGuildKey(member.GuildID)); err != nil {
+		return err
+	}
+	if err := s.exists(kvMemberKey(member.GuildID, member.User.ID)); err != nil {
+		return err
+	}
+
+	return s.removeMember(member.GuildID, member.User.ID)
+}
+
+// Member gets a member by ID from a guild.
+func (s *KVState) Member(guildID, userID string) (*Member, error) {
+	if s == nil {
+		return nil, ErrNilState
+	}
+
+	m := &Member{}
+	if err := s.get(kvMemberKey(guildID, userID), m); err != nil {
+		return nil, err
+	}
+	m.User.Session = s.getSession()
+
+	return m, nil
+}
+
+// GetUser retrieves a user from the cache by ID
+func (s *KVState) GetUser(userID string) (*User, error) {
+	if s == nil {
+		return nil, ErrNilState
+	}
+
+	if userID == "@me" {
+		return s.MyUser(), nil
+	}
+
+	u := &User{}
+	if err := s.get(kvUserKey(userID), u); err != nil {
+		return nil, err
+	}
+
+	guilds, err := s.keys(kvUserGuildKey(userID, ""))
+	if err != nil {
+		return nil, err
+	}
+	u.guilds = guilds
+	u.Session = s.getSession()
+
+	return u, nil
+}
+
+// MyUser returns the bots user
+func (s *KVState) MyUser() *User {
+	r := &Ready{}
+	if s.get(kvReadyKey, r) != nil {
+		return nil
+	}
+	return r.User
+}
+
+// userUpdate replaces a cached user and returns the user from before the update.
+func (s *KVState) userUpdate(user *User) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := &User{}
+	if err := s.get(kvUserKey(user.ID), old); err != nil {
+		return nil, err
+	}
+
+	return old, s.set(kvUserKey(user.ID), user)
+}
+
+// memberCountAdd adds delta to the member count of a guild.
+func (s *KVState) memberCountAdd(guildID string, delta int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, err := s.guildRecord(guildID)
+	if err != nil {
+		return err
+	}
+
+	g.MemberCount += delta
+	return s.putGuild(g)
+}
+
+// RoleAdd adds a role to the current world state, or
+// updates it if it already exists.
+func (s *KVState) RoleAdd(guildID string, role *Role) error {
+	if s == nil {
+		return ErrNilState
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, err := s.guildRecord(guildID)
+	if err != nil {
+		return err
+	}
+
+	for i, r := range g.Roles {
+		if r.ID == role.ID {
+			g.Roles[i] = role
+			return s.putGuild(g)
+		}
+	}
+
+	g.Roles = append(g.Roles, role)
+	return s.putGuild(g)
+}
+
+// RoleRemove removes a role from current world state by ID.
+func (s *KVState) RoleRemove(guildID, roleID string) error {
+	if s == nil {
+		return ErrNilState
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, err := s.guildRecord(guildID)
+	if err != nil {
+		return err
+	}
+
+	for i, r := range g.Roles {
+		if r.ID == roleID {
+			g.Roles = append(g.Roles[:i], g.Roles[i+1:]...)
+			return s.putGuild(g)
+		}
+	}
+
+	return ErrStateNotFound
+}
+
+// Role gets a role by ID from a guild.
+func (s *KVState) Role(guildID, roleID string) (*Role, error) {
+	if s == nil {
+		return nil, ErrNilState
+	}
+
+	g, err := s.guildRecord(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range g.Roles {
+		if r.ID == roleID {
+			r.Session = s.getSession()
+			return r, nil
+		}
+	}
+
+	return nil, ErrStateNotFound
+}
+
+// ChannelAdd adds a channel to the current world state, or
+// updates it if it already exists.
+// Channels may exist either as PrivateChannels or inside
+// a guild.
+func (s *KVState) ChannelAdd(channel *Channel) error {
+	if s == nil {
+		return ErrNilState
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := &Channel{}
+	err := s.get(kvChannelKey(channel.ID), old)
+	if err == nil {
+		if channel.PermissionOverwrites == nil {
+			channel.PermissionOverwrites = old.PermissionOverwrites
+		}
+		return s.set(kvChannelKey(channel.ID), channel)
+	}
+	if err != ErrStateNotFound {
+		return err
+	}
+
+	if channel.Type != ChannelTypeDM && channel.Type != ChannelTypeGroupDM {
+		g, err := s.guildRecord(channel.GuildID)
+		if err != nil {
+			return err
+		}
+
+		g.ChannelIDs = append(g.ChannelIDs, channel.ID)
+		if err = s.putGuild(g); err != nil {
+			return err
+		}
+	}
+
+	return s.set(kvChannelKey(channel.ID), channel)
+}
+
+// ChannelRemove removes a channel from current world state.
+func (s *KVState) ChannelRemove(channel *Channel) error {
+	if s == nil {
+		return ErrNilState
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.exists(kvChannelKey(channel.ID)); err != nil {
+		return err
+	}
+
+	if channel.Type != ChannelTypeDM && channel.Type != ChannelTypeGroupDM {
+		g, err := s.guildRecord(channel.GuildID)
+		if err != nil {
+			return err
+		}
+
+		for i, id := range g.ChannelIDs {
+			if id == channel.ID {
+				g.ChannelIDs = append(g.ChannelIDs[:i], g.ChannelIDs[i+1:]...)
+				break
+			}
+		}
+		if err = s.putGuild(g); err != nil {
+			return err
+		}
+	}
+
+	return s.removeChannel(channel.ID)
+}
+
+// Channel gets a channel by ID, with its messages.
+func (s *KVState) Channel(channelID string) (*Channel, error) {
+	if s == nil {
+		return nil, ErrNilState
+	}
+
+	c := &Channel{}
+	if err := s.get(kvChannelKey(channelID), c); err != nil {
+		return nil, err
+	}
+
+	messages, err := s.messages(channelID)
+	if err != nil {
+		return nil, err
+	}
+	c.Messages = messages
+	c.Session = s.getSession()
+
+	return c, nil
+}
+
+// Emoji returns an emoji for a guild and emoji id.
+func (s *KVState) Emoji(guildID, emojiID string) (*Emoji, error) {
+	if s == nil {
+		return nil, ErrNilState
+	}
+
+	g, err := s.guildRecord(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range g.Emojis {
+		if e.ID == emojiID {
+			e.Session = s.getSession()
+			return e, nil
+		}
+	}
+
+	return nil, ErrStateNotFound
+}
+
+// EmojiAdd adds an emoji to the current world state.
+func (s *KVState) EmojiAdd(guildID string, emoji *Emoji) error {
+	return s.EmojisAdd(guildID, []*Emoji{emoji})
+}
+
+// EmojisAdd adds multiple emojis to the world state.
+func (s *KVState) EmojisAdd(guildID string, emojis []*Emoji) error {
+	if s == nil {
+		return ErrNilState
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, err := s.guildRecord(guildID)
+	if err != nil {
+		return err
+	}
+
+next:
+	for _, emoji := range emojis {
+		for i, e := range g.Emojis {
+			if e.ID == emoji.ID {
+				g.Emojis[i] = emoji
+				continue next
+			}
+		}
+		g.Emojis = append(g.Emojis, emoji)
+	}
+
+	return s.putGuild(g)
+}
+
+// messages returns the stored messages of a channel.
+func (s *KVState) messages(channelID string) ([]*Message, error) {
+	var messages []*Message
+
+	err := s.get(kvMessagesKey(channelID), &messages)
+	if err != nil && err != ErrStateNotFound {
+		return nil, err
+	}
+
+	se := s.getSession()
+	for _, m := range messages {
+		m.Session = se
+		if m.Author != nil {
+			m.Author.Session = se
+		}
+	}
+
+	return messages, nil
+}
+
+// MessageAdd adds a message to the current world state, or updates it if it exists.
+// If the channel cannot be found, the message is discarded.
+// Messages are kept in state up to s.MaxMessageCount per channel.
+func (s *KVState) MessageAdd(message *Message, se *Session) error {
+	if s == nil {
+		return ErrNilState
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.exists(kvChannelKey(message.ChannelID)); err != nil {
+		return err
+	}
+
+	messages, err := s.messages(message.ChannelID)
+	if err != nil {
+		return err
+	}
+
+	// If the message exists, merge in the new message contents.
+	for _, m := range messages {
+		if m.ID == message.ID {
+			mergeMessage(m, message)
+			return s.set(kvMessagesKey(message.ChannelID), messages)
+		}
+	}
+
+	messages = append(messages, message)
+
+	if len(messages) > s.MaxMessageCount {
+		messages = messages[len(messages)-s.MaxMessageCount:]
+	}
+	return s.set(kvMessagesKey(message.ChannelID), messages)
+}
+
+// MessageRemove removes a message from the world state.
+func (s *KVState) MessageRemove(message *Message) error {
+	if s == nil {
+		return ErrNilState
+	}
+
+	return s.messageRemoveByID(message.ChannelID, message.ID)
+}
+
+// messageRemoveByID removes a message by channelID and messageID from the world state.
+func (s *KVState) messageRemoveByID(channelID, messageID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.exists(kvChannelKey(channelID)); err != nil {
+		return err
+	}
+
+	messages, err := s.messages(channelID)
+	if err != nil {
+		return err
+	}
+
+	for i, m := range messages {
+		if m.ID == messageID {
+			messages = append(messages[:i], messages[i+1:]...)
+			return s.set(kvMessagesKey(channelID), messages)
+		}
+	}
+
+	return ErrStateNotFound
+}
+
+// reactionUpdate applies a reaction event to a stored message, and returns
+// its reactions from before the event.
+func (s *KVState) reactionUpdate(r *MessageReaction, change reactionChange) ([]*MessageReactions, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages, err := s.messages(r.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+
+	var myID string
+	if u := s.MyUser(); u != nil {
+		myID = u.ID
+	}
+
+	for _, m := range messages {
+		if m.ID == r.MessageID {
+			old := m.Reactions
+			m.Reactions = applyReaction(old, r, change, myID)
+			return old, s.set(kvMessagesKey(r.ChannelID), messages)
+		}
+	}
+
+	return nil, ErrStateNotFound
+}
+
+// Message gets a message by channel and message ID.
+func (s *KVState) Message(channelID, messageID string) (*Message, error) {
+	if s == nil {
+		return nil, ErrNilState
+	}
+
+	messages, err := s.messages(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range messages {
+		if m.ID == messageID {
+			return m, nil
+		}
+	}
+
+	return nil, ErrStateNotFound
+}
+
+// voiceState gets the voice state of a user in a guild.
+func (s *KVState) voiceState(guildID, userID string) (*VoiceState, error) {
+	v := &VoiceState{}
+	if err := s.get(kvVoiceKey(guildID, userID), v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (s *KVState) voiceStateUpdate(update *VoiceStateUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.exists(kvGuildKey(update.GuildID)); err != nil {
+		return err
+	}
+
+	// Handle Leaving Channel
+	if update.ChannelID == "" {
+		return s.kv.Delete(kvVoiceKey(update.GuildID, update.UserID))
+	}
+
+	return s.set(kvVoiceKey(update.GuildID, update.UserID), update.VoiceState)
+}
+
+// onReady stores the current user and session, and the guilds and private
+// channels of a Ready event.
+func (s *KVState) onReady(se *Session, r *Ready) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.setSession(se)
+
+	ready := &Ready{
+		Version:   r.Version,
+		SessionID: r.SessionID,
+		User:      r.User,
+	}
+
+	// We must track at least the current user for Voice, even
+	// if state is disabled, store the bare essentials.
+	if !se.StateEnabled {
+		return s.set(kvReadyKey, ready)
+	}
+
+	known, err := s.keys(kvGuildKey(""))
+	if err != nil {
+		return err
+	}
+
+	// Guilds already in the store are kept until their GUILD_CREATE
+	// is received, rather than being replaced by unavailable guilds.
+	inReady := make(map[string]bool, len(r.Guilds))
+	for _, g := range r.Guilds {
+		inReady[g.ID] = true
+
+		if g.Unavailable && s.exists(kvGuildKey(g.ID)) == nil {
+			continue
+		}
+		if err = s.guildAdd(g); err != nil {
+			return err
+		}
+	}
+
+	// Guilds the bot is no longer in are dropped.
+	for _, id := range known {
+		if !inReady[id] {
+			if err = s.guildRemove(id); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, c := range r.PrivateChannels {
+		if err = s.set(kvChannelKey(c.ID), c); err != nil {
+			return err
+		}
+	}
+
+	return s.set(kvReadyKey, ready)
+}
+
+// OnInterface handles all events related to states.
+func (s *KVState) OnInterface(se *Session, i interface{}) error {
+	if s == nil {
+		return ErrNilState
+	}
+
+	s.setSession(se)
+	return onStateEvent(s, se, i)
+}
+
+// UserColor returns the color of a user in a channel.
+// While colors are defined at a Guild level, determining for a channel is more useful in message handlers.
+// 0 is returned in cases of error, which is the color of @everyone.
+// userID    : The ID of the user to calculate the color for.
+// channelID : The ID of the channel to calculate the color for.
+func (s *KVState) UserColor(userID, channelID string) Color {
+	if s == nil {
+		return 0
+	}
+
+	return userColor(s, userID, channelID)
+}
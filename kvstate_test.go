@@ -0,0 +1,185 @@
+package discordgo
+
+import (
+	"testing"
+)
+
+func newKVState(t *testing.T, kv KV) (*KVState, *Session) {
+	se := &Session{StateEnabled: true}
+	state := NewKVState(kv)
+	state.MaxMessageCount = 10
+
+	err := state.OnInterface(se, &Ready{
+		SessionID: "session",
+		User:      &User{ID: "bot"},
+		Guilds: []*Guild{{
+			ID:          "1",
+			Name:        "guild",
+			MemberCount: 2,
+			Roles:       []*Role{{ID: "1", Name: "@everyone"}, {ID: "2", Name: "red", Color: 0xff0000, Position: 1}},
+			Channels:    []*Channel{{ID: "10", Name: "general", GuildID: "1"}},
+			Members:     []*Member{{GuildID: "1", User: &User{ID: "bot"}}, {GuildID: "1", User: &User{ID: "100"}, Roles: []string{"2"}}},
+			Presences:   []*Presence{{User: &User{ID: "100"}, Status: StatusOnline}},
+		}},
+		PrivateChannels: []*Channel{{ID: "20", Type: ChannelTypeDM}},
+	})
+	if err != nil {
+		t.Fatalf("OnInterface returned error: %+v", err)
+	}
+
+	return state, se
+}
+
+func TestKVStateLookups(t *testing.T) {
+	state, se := newKVState(t, NewMemoryKV())
+
+	if state.MyUser() == nil || state.MyUser().ID != "bot" {
+		t.Fatalf("MyUser should be the bot, got %+v", state.MyUser())
+	}
+
+	g, err := state.Guild("1")
+	if err != nil {
+		t.Fatalf("Guild returned error: %+v", err)
+	}
+	if g.Name != "guild" || len(g.Members) != 2 || len(g.Channels) != 1 || len(g.Presences) != 1 {
+		t.Errorf("guild was not stored whole: %+v", g)
+	}
+	if g.Session != se || g.Roles[0].Guild != g {
+		t.Errorf("guild should belong to the session")
+	}
+
+	if c, err := state.Channel("20"); err != nil || c.Type != ChannelTypeDM {
+		t.Errorf("private channel was not stored: %+v, %+v", c, err)
+	}
+	if u, err := state.GetUser("100"); err != nil || len(u.guilds) != 1 {
+		t.Errorf("user was not stored: %+v, %+v", u, err)
+	}
+	if color := state.UserColor("100", "10"); color != 0xff0000 {
+		t.Errorf("UserColor should be 0xff0000, got %x", color)
+	}
+
+	// Lookups return copies, which are not changed by later events.
+	m, _ := state.Member("1", "100")
+	m.Nick = "changed"
+	if m, _ = state.Member("1", "100"); m.Nick != "" {
+		t.Errorf("changing a looked up member should not change the state")
+	}
+}
+
+func TestKVStateEvents(t *testing.T) {
+	kv := NewMemoryKV()
+	state, se := newKVState(t, kv)
+
+	events := []interface{}{
+		&GuildMemberAdd{Member: &Member{GuildID: "1", User: &User{ID: "101"}}},
+		&GuildMemberUpdate{Member: &Member{GuildID: "1", User: &User{ID: "100"}, Nick: "nick"}},
+		&ChannelUpdate{Channel: &Channel{ID: "10", Name: "renamed", GuildID: "1"}},
+		&MessageCreate{Message: &Message{ID: "1000", ChannelID: "10", Content: "hello"}},
+		&MessageUpdate{Message: &Message{ID: "1000", ChannelID: "10", Content: "edited"}},
+		&PresenceUpdate{GuildID: "1", Presence: Presence{User: &User{ID: "100"}, Status: StatusIdle}},
+		&GuildRoleUpdate{GuildRole: &GuildRole{GuildID: "1", Role: &Role{ID: "2", Name: "blue"}}},
+		&VoiceStateUpdate{VoiceState: &VoiceState{GuildID: "1", UserID: "100", ChannelID: "10"}},
+	}
+	for _, e := range events {
+		if err := state.OnInterface(se, e); err != nil {
+			t.Fatalf("OnInterface(%T) returned error: %+v", e, err)
+		}
+	}
+
+	if g, _ := state.Guild("1"); g.MemberCount != 3 || len(g.Members) != 3 || len(g.VoiceStates) != 1 {
+		t.Errorf("guild should have 3 members and a voice state, got %d, %d and %d", g.MemberCount, len(g.Members), len(g.VoiceStates))
+	}
+	if before := events[1].(*GuildMemberUpdate).BeforeUpdate; before == nil || before.Nick != "" {
+		t.Errorf("member BeforeUpdate should be set, got %+v", before)
+	}
+	if before := events[2].(*ChannelUpdate).BeforeUpdate; before == nil || before.Name != "general" {
+		t.Errorf("channel BeforeUpdate should be set, got %+v", before)
+	}
+	if before := events[4].(*MessageUpdate).BeforeUpdate; before == nil || before.Content != "hello" {
+		t.Errorf("message BeforeUpdate should be set, got %+v", before)
+	}
+	if m, err := state.Message("10", "1000"); err != nil || m.Content != "edited" {
+		t.Errorf("message should be updated, got %+v, %+v", m, err)
+	}
+	if before := events[5].(*PresenceUpdate).BeforeUpdate; before == nil || before.Status != StatusOnline {
+		t.Errorf("presence BeforeUpdate should be set, got %+v", before)
+	}
+	if before := events[6].(*GuildRoleUpdate).BeforeUpdate; before == nil || before.Name != "red" {
+		t.Errorf("role BeforeUpdate should be set, got %+v", before)
+	}
+
+	err := state.OnInterface(se, &GuildMemberRemove{Member: &Member{GuildID: "1", User: &User{ID: "101"}}})
+	if err != nil {
+		t.Fatalf("OnInterface returned error: %+v", err)
+	}
+	if _, err = state.GetUser("101"); err != ErrStateNotFound {
+		t.Errorf("user of a removed member should be dropped, got %+v", err)
+	}
+
+	if err = state.OnInterface(se, &GuildDelete{Guild: &Guild{ID: "1"}}); err != nil {
+		t.Fatalf("OnInterface returned error: %+v", err)
+	}
+
+	// Only the ready key and the private channel are left.
+	if kv.Len() != 2 {
+		t.Errorf("guild should be removed from the KV, %d keys left", kv.Len())
+	}
+}
+
+func TestKVStateShared(t *testing.T) {
+	kv := NewMemoryKV()
+	writer, se := newKVState(t, kv)
+	reader := NewKVState(kv)
+
+	err := writer.OnInterface(se, &GuildMemberAdd{Member: &Member{GuildID: "1", User: &User{ID: "101"}}})
+	if err != nil {
+		t.Fatalf("OnInterface returned error: %+v", err)
+	}
+
+	if _, err = reader.Member("1", "101"); err != nil {
+		t.Errorf("reader should see the members added by the writer, got %+v", err)
+	}
+	if reader.MyUser() == nil {
+		t.Errorf("reader should see the user of the writer")
+	}
+}
+
+// A scanCountingKV counts the scans of a KV.
+type scanCountingKV struct {
+	KV
+	scans int
+}
+
+func (kv *scanCountingKV) Scan(prefix string, fn func(key string, value []byte) error) error {
+	kv.scans++
+	return kv.KV.Scan(prefix, fn)
+}
+
+func TestKVStateRoleEventsWithoutScans(t *testing.T) {
+	kv := &scanCountingKV{KV: NewMemoryKV()}
+	state, se := newKVState(t, kv)
+	kv.scans = 0
+
+	events := []interface{}{
+		&GuildRoleCreate{GuildRole: &GuildRole{GuildID: "1", Role: &Role{ID: "3", Name: "green"}}},
+		&GuildRoleUpdate{GuildRole: &GuildRole{GuildID: "1", Role: &Role{ID: "3", Name: "blue"}}},
+		&GuildRoleDelete{GuildID: "1", RoleID: "3"},
+		&GuildEmojisUpdate{GuildID: "1", Emojis: []*Emoji{{ID: "4", Name: "emoji"}}},
+	}
+	for _, e := range events {
+		if err := state.OnInterface(se, e); err != nil {
+			t.Fatalf("OnInterface(%T) returned error: %+v", e, err)
+		}
+	}
+	state.UserColor("100", "10")
+
+	if kv.scans != 0 {
+		t.Errorf("role and emoji events should only read the guild record, got %d scans", kv.scans)
+	}
+	if e := events[1].(*GuildRoleUpdate); e.BeforeUpdate == nil || e.BeforeUpdate.Name != "green" || e.Role.Guild == nil {
+		t.Errorf("role BeforeUpdate and guild should be set, got %+v", e)
+	}
+	if e := events[2].(*GuildRoleDelete); e.Role == nil || e.Role.Name != "blue" {
+		t.Errorf("deleted role should be set, got %+v", e.Role)
+	}
+}
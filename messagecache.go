@@ -0,0 +1,414 @@
+package discordgo
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A MessageCache holds the cached messages of all channels of a State,
+// indexed by ID. Messages are capped per channel by State.MaxMessageCount,
+// and can be capped over all channels and expired after a while too.
+//
+// Cached messages are never changed, an update replaces the cached message
+// with a merged copy, so the returned messages are safe to keep.
+// Messages past the TTL are no longer returned, and are evicted by the next
+// change to the cache.
+type MessageCache struct {
+	sync.Mutex
+
+	// MaxMessages caps the number of messages over all channels, the least
+	// recently stored messages are evicted first. Zero means no cap.
+	MaxMessages int
+
+	// TTL evicts the messages stored longer ago than it, zero keeps them
+	// until they are evicted by a cap.
+	TTL time.Duration
+
+	// DeletedRetention keeps deleted messages available to Deleted for this
+	// long after they were deleted, zero drops them straight away.
+	DeletedRetention time.Duration
+
+	// MaxRevisions is the number of earlier versions kept of every cached
+	// message as it is edited, zero keeps none.
+	MaxRevisions int
+
+	// TrackReactionUsers keeps the IDs of the users who reacted to every
+	// cached message, for the reactions added while it is cached.
+	TrackReactionUsers bool
+
+	messages map[string]*cachedMessage
+
+	// All cached messages, the most recently stored first.
+	order *list.List
+
+	// channel ID -> the cached messages of a channel, oldest first
+	channels map[string]*list.List
+
+	deleted map[string]*cachedMessage
+
+	// All deleted messages, the most recently deleted first.
+	deletedOrder *list.List
+
+	// The changes to the cached messages not taken by the State yet, which
+	// mirrors them into the Messages of its channels.
+	changes []messageChange
+}
+
+// A messageChange is a message added to, replaced in or removed from the
+// messages of a channel.
+type messageChange struct {
+	channelID string
+
+	// old is nil for an added message, and new for a removed message.
+	old, new *Message
+}
+
+type cachedMessage struct {
+	message *Message
+
+	// The earlier versions of the message, oldest first.
+	revisions []*MessageRevision
+
+	// reaction key -> user ID -> whether the user reacted
+	reactors map[string]map[string]bool
+
+	// When the message was last stored, or deleted.
+	stored time.Time
+
+	elem        *list.Element
+	channelElem *list.Element
+}
+
+// A MessageRevision is an earlier version of an edited message.
+type MessageRevision struct {
+	Content string `json:"content"`
+
+	Embeds []*MessageEmbed `json:"embeds"`
+
+	// When the version was made, empty for the original message.
+	EditedTimestamp Timestamp `json:"edited_timestamp"`
+}
+
+// NewMessageCache creates an empty MessageCache.
+func NewMessageCache() *MessageCache {
+	return &MessageCache{
+		messages:     make(map[string]*cachedMessage),
+		order:        list.New(),
+		channels:     make(map[string]*list.List),
+		deleted:      make(map[string]*cachedMessage),
+		deletedOrder: list.New(),
+	}
+}
+
+// Len returns the number of cached messages.
+func (c *MessageCache) Len() int {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	n := len(c.messages)
+	for e := c.order.Back(); e != nil && c.expired(e.Value.(*cachedMessage), now); e = e.Prev() {
+		n--
+	}
+	return n
+}
+
+// Message returns a cached message by ID.
+// messageID : The ID of a Message.
+func (c *MessageCache) Message(messageID string) (*Message, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	cm, ok := c.messages[messageID]
+	if !ok || c.expired(cm, time.Now()) {
+		return nil, ErrStateNotFound
+	}
+	return cm.message, nil
+}
+
+// ChannelMessages returns the cached messages of a channel, oldest first.
+// channelID : The ID of a Channel.
+func (c *MessageCache) ChannelMessages(channelID string) []*Message {
+	c.Lock()
+	defer c.Unlock()
+
+	l, ok := c.channels[channelID]
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	messages := make([]*Message, 0, l.Len())
+	for e := l.Front(); e != nil; e = e.Next() {
+		if cm := e.Value.(*cachedMessage); !c.expired(cm, now) {
+			messages = append(messages, cm.message)
+		}
+	}
+	return messages
+}
+
+// Deleted returns a message deleted less than DeletedRetention ago.
+// messageID : The ID of a Message.
+func (c *MessageCache) Deleted(messageID string) (*Message, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.expireDeleted(time.Now())
+
+	cm, ok := c.deleted[messageID]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+	return cm.message, nil
+}
+
+// Revisions returns the earlier versions of a cached or deleted message,
+// oldest first.
+// messageID : The ID of a Message.
+func (c *MessageCache) Revisions(messageID string) ([]*MessageRevision, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	c.expireDeleted(now)
+
+	cm, ok := c.messages[messageID]
+	if ok && c.expired(cm, now) {
+		return nil, ErrStateNotFound
+	}
+	if !ok {
+		cm, ok = c.deleted[messageID]
+	}
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+
+	return append([]*MessageRevision(nil), cm.revisions...), nil
+}
+
+// ReactionUsers returns the IDs of the users who reacted to a cached message
+// with an emoji, sorted. It needs TrackReactionUsers to be set.
+// messageID : The ID of a Message.
+// emojiID   : The ID of a custom emoji, or the unicode emoji itself.
+func (c *MessageCache) ReactionUsers(messageID, emojiID string) ([]string, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	cm, ok := c.messages[messageID]
+	if !ok || c.expired(cm, time.Now()) {
+		return nil, ErrStateNotFound
+	}
+
+	users := make([]string, 0, len(cm.reactors[emojiID]))
+	for id := range cm.reactors[emojiID] {
+		users = append(users, id)
+	}
+	sort.Strings(users)
+
+	return users, nil
+}
+
+// react applies a reaction event to a cached message, and returns its
+// reactions from before the event.
+// myID : The ID of the bot user.
+func (c *MessageCache) react(r *MessageReaction, change reactionChange, myID string) ([]*MessageReactions, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.expire(time.Now())
+
+	cm, ok := c.messages[r.MessageID]
+	if !ok || cm.message.ChannelID != r.ChannelID {
+		return nil, ErrStateNotFound
+	}
+	old := cm.message.Reactions
+
+	if c.TrackReactionUsers {
+		key := reactionKey(r.Emoji)
+		switch change {
+		case reactionAdd:
+			// Events replayed after a resume are only counted once.
+			if cm.reactors[key][r.UserID] {
+				return old, nil
+			}
+			if cm.reactors == nil {
+				cm.reactors = make(map[string]map[string]bool)
+			}
+			if cm.reactors[key] == nil {
+				cm.reactors[key] = make(map[string]bool)
+			}
+			cm.reactors[key][r.UserID] = true
+		case reactionRemove:
+			delete(cm.reactors[key], r.UserID)
+		case reactionRemoveEmoji:
+			delete(cm.reactors, key)
+		case reactionRemoveAll:
+			cm.reactors = nil
+		}
+	}
+
+	m := *cm.message
+	m.Reactions = applyReaction(old, r, change, myID)
+	c.changes = append(c.changes, messageChange{r.ChannelID, cm.message, &m})
+	cm.message = &m
+
+	return old, nil
+}
+
+// add caches a message, or merges it into the cached message with its ID.
+// perChannel : The maximum number of messages kept for the channel, 0 for no cap.
+func (c *MessageCache) add(message *Message, perChannel int) {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	c.expire(now)
+
+	if cm, ok := c.messages[message.ID]; ok {
+		old := cm.message
+		merged := *old
+		mergeMessage(&merged, message)
+
+		// Updates that only add embeds to a link are not edits.
+		edited := merged.Content != old.Content || merged.EditedTimestamp != old.EditedTimestamp
+		if c.MaxRevisions > 0 && edited {
+			cm.revisions = append(cm.revisions, &MessageRevision{
+				Content:         old.Content,
+				Embeds:          old.Embeds,
+				EditedTimestamp: old.EditedTimestamp,
+			})
+			if len(cm.revisions) > c.MaxRevisions {
+				cm.revisions = cm.revisions[len(cm.revisions)-c.MaxRevisions:]
+			}
+		}
+
+		c.changes = append(c.changes, messageChange{message.ChannelID, old, &merged})
+		cm.message = &merged
+		cm.stored = now
+		c.order.MoveToFront(cm.elem)
+		return
+	}
+
+	l, ok := c.channels[message.ChannelID]
+	if !ok {
+		l = list.New()
+		c.channels[message.ChannelID] = l
+	}
+
+	cm := &cachedMessage{message: message, stored: now}
+	cm.elem = c.order.PushFront(cm)
+	cm.channelElem = l.PushBack(cm)
+	c.messages[message.ID] = cm
+	c.changes = append(c.changes, messageChange{message.ChannelID, nil, message})
+
+	if perChannel > 0 {
+		for l.Len() > perChannel {
+			c.evict(l.Front().Value.(*cachedMessage))
+		}
+	}
+
+	if c.MaxMessages > 0 {
+		for len(c.messages) > c.MaxMessages {
+			c.evict(c.order.Back().Value.(*cachedMessage))
+		}
+	}
+}
+
+// remove removes a message from the cache, keeping it for DeletedRetention,
+// and returns it.
+func (c *MessageCache) remove(channelID, messageID string) (*Message, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	c.expire(now)
+
+	cm, ok := c.messages[messageID]
+	if !ok || cm.message.ChannelID != channelID {
+		return nil, ErrStateNotFound
+	}
+	c.evict(cm)
+
+	if c.DeletedRetention > 0 {
+		cm.stored = now
+		cm.elem = c.deletedOrder.PushFront(cm)
+		c.deleted[messageID] = cm
+	}
+
+	return cm.message, nil
+}
+
+// removeChannel drops all messages of a channel.
+func (c *MessageCache) removeChannel(channelID string) {
+	c.Lock()
+	defer c.Unlock()
+
+	l, ok := c.channels[channelID]
+	if !ok {
+		return
+	}
+
+	for l.Len() > 0 {
+		c.unlink(l.Front().Value.(*cachedMessage))
+	}
+}
+
+// unlink removes a cached message from all lists and maps.
+func (c *MessageCache) unlink(cm *cachedMessage) {
+	delete(c.messages, cm.message.ID)
+	c.order.Remove(cm.elem)
+
+	l := c.channels[cm.message.ChannelID]
+	l.Remove(cm.channelElem)
+	if l.Len() == 0 {
+		delete(c.channels, cm.message.ChannelID)
+	}
+}
+
+// evict removes a cached message from all lists and maps, and records the
+// change to its channel.
+func (c *MessageCache) evict(cm *cachedMessage) {
+	c.unlink(cm)
+	c.changes = append(c.changes, messageChange{cm.message.ChannelID, cm.message, nil})
+}
+
+// takeChanges returns the changes to the cached messages since it was last
+// called.
+func (c *MessageCache) takeChanges() []messageChange {
+	c.Lock()
+	defer c.Unlock()
+
+	changes := c.changes
+	c.changes = nil
+	return changes
+}
+
+// expired reports whether a cached message is past the TTL.
+func (c *MessageCache) expired(cm *cachedMessage, now time.Time) bool {
+	return c.TTL > 0 && now.Sub(cm.stored) > c.TTL
+}
+
+// expire evicts the messages past their TTL, and the deleted messages past
+// the DeletedRetention. Only the changes to the cache expire messages, so
+// that the State sees every evicted message.
+func (c *MessageCache) expire(now time.Time) {
+	for e := c.order.Back(); e != nil && c.expired(e.Value.(*cachedMessage), now); e = c.order.Back() {
+		c.evict(e.Value.(*cachedMessage))
+	}
+
+	c.expireDeleted(now)
+}
+
+// expireDeleted evicts the deleted messages past the DeletedRetention.
+func (c *MessageCache) expireDeleted(now time.Time) {
+	for e := c.deletedOrder.Back(); e != nil; e = c.deletedOrder.Back() {
+		cm := e.Value.(*cachedMessage)
+		if now.Sub(cm.stored) <= c.DeletedRetention {
+			break
+		}
+		c.deletedOrder.Remove(e)
+		delete(c.deleted, cm.message.ID)
+	}
+}
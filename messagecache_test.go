@@ -0,0 +1,242 @@
+package discordgo
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMessageCacheCaps(t *testing.T) {
+	c := NewMessageCache()
+	c.MaxMessages = 3
+
+	c.add(&Message{ID: "1", ChannelID: "a"}, 2)
+	c.add(&Message{ID: "2", ChannelID: "a"}, 2)
+	c.add(&Message{ID: "3", ChannelID: "a"}, 2)
+	if _, err := c.Message("1"); err != ErrStateNotFound {
+		t.Errorf("oldest message of the channel should be evicted, got %+v", err)
+	}
+
+	c.add(&Message{ID: "4", ChannelID: "b"}, 2)
+	c.add(&Message{ID: "2", ChannelID: "a", Content: "edited"}, 2)
+	c.add(&Message{ID: "5", ChannelID: "b"}, 2)
+
+	// Message 3 was stored least recently, as 2 was edited.
+	if _, err := c.Message("3"); err != ErrStateNotFound {
+		t.Errorf("least recently stored message should be evicted, got %+v", err)
+	}
+	if m, err := c.Message("2"); err != nil || m.Content != "edited" {
+		t.Errorf("message should be merged, got %+v, %+v", m, err)
+	}
+	if messages := c.ChannelMessages("b"); len(messages) != 2 || messages[0].ID != "4" {
+		t.Errorf("channel b should have messages 4 and 5, got %+v", messages)
+	}
+}
+
+func TestMessageCacheExpiry(t *testing.T) {
+	c := NewMessageCache()
+	c.TTL = time.Minute
+	c.DeletedRetention = time.Minute
+
+	c.add(&Message{ID: "1", ChannelID: "a", Content: "old"}, 0)
+	c.add(&Message{ID: "2", ChannelID: "a", Content: "deleted"}, 0)
+	c.add(&Message{ID: "3", ChannelID: "a"}, 0)
+
+	if _, err := c.remove("a", "2"); err != nil {
+		t.Fatalf("remove returned error: %+v", err)
+	}
+	if m, err := c.Deleted("2"); err != nil || m.Content != "deleted" {
+		t.Errorf("deleted message should be retained, got %+v, %+v", m, err)
+	}
+
+	c.messages["1"].stored = time.Now().Add(-time.Hour)
+	c.order.MoveToBack(c.messages["1"].elem)
+	c.deleted["2"].stored = time.Now().Add(-time.Hour)
+
+	if _, err := c.Message("1"); err != ErrStateNotFound {
+		t.Errorf("expired message should be evicted, got %+v", err)
+	}
+	if _, err := c.Deleted("2"); err != ErrStateNotFound {
+		t.Errorf("deleted message should be dropped after the retention, got %+v", err)
+	}
+	if c.Len() != 1 {
+		t.Errorf("cache should hold 1 message, got %d", c.Len())
+	}
+}
+
+func TestStateMessageBeforeDelete(t *testing.T) {
+	state := NewState()
+	state.MaxMessageCount = 10
+	kv := NewKVState(NewMemoryKV())
+	kv.MaxMessageCount = 10
+
+	for _, st := range []StateCache{state, kv} {
+		se := &Session{StateEnabled: true, State: st}
+		st.OnInterface(se, &Ready{User: &User{ID: "bot"}, PrivateChannels: []*Channel{{ID: "a", Type: ChannelTypeDM}}})
+
+		for _, id := range []string{"1", "2", "3"} {
+			st.OnInterface(se, &MessageCreate{Message: &Message{ID: id, ChannelID: "a", Content: "content " + id}})
+		}
+
+		d := &MessageDelete{Message: &Message{ID: "1", ChannelID: "a"}}
+		st.OnInterface(se, d)
+		if d.BeforeDelete == nil || d.BeforeDelete.Content != "content 1" {
+			t.Errorf("%T: MessageDelete should have the deleted message, got %+v", st, d.BeforeDelete)
+		}
+		if err := st.OnInterface(se, &MessageDelete{Message: &Message{ID: "1", ChannelID: "a"}}); err != ErrStateNotFound {
+			t.Errorf("%T: deleting an unknown message should return ErrStateNotFound, got %+v", st, err)
+		}
+
+		b := &MessageDeleteBulk{ChannelID: "a", Messages: []string{"2", "3", "4"}}
+		st.OnInterface(se, b)
+		if len(b.BeforeDelete) != 2 {
+			t.Errorf("%T: MessageDeleteBulk should have 2 deleted messages, got %d", st, len(b.BeforeDelete))
+		}
+		if _, err := st.Message("a", "2"); err != ErrStateNotFound {
+			t.Errorf("%T: message should be removed, got %+v", st, err)
+		}
+
+		st.OnInterface(se, &MessageCreate{Message: &Message{ID: "5", ChannelID: "a"}})
+		if c, err := st.Channel("a"); err != nil || len(c.Messages) != 1 || c.Messages[0].ID != "5" {
+			t.Errorf("%T: channel should have its messages, got %+v, %+v", st, c, err)
+		}
+	}
+}
+
+func TestStateChannelMessages(t *testing.T) {
+	se := &Session{StateEnabled: true}
+	state := NewState()
+	state.MaxMessageCount = 2
+	state.OnInterface(se, &Ready{User: &User{ID: "bot"}, PrivateChannels: []*Channel{{ID: "a", Type: ChannelTypeDM}}})
+
+	ids := func() (ids []string) {
+		c, _ := state.Channel("a")
+		for _, m := range c.Messages {
+			ids = append(ids, m.ID+":"+m.Content)
+		}
+		return ids
+	}
+	check := func(step string, want ...string) {
+		if got := ids(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: channel messages should be %v, got %v", step, want, got)
+		}
+	}
+
+	for _, id := range []string{"1", "2", "3"} {
+		state.OnInterface(se, &MessageCreate{Message: &Message{ID: id, ChannelID: "a", Content: "x"}})
+	}
+	check("add", "2:x", "3:x")
+
+	state.OnInterface(se, &MessageUpdate{Message: &Message{ID: "2", ChannelID: "a", Content: "y"}})
+	check("update", "2:y", "3:x")
+
+	state.OnInterface(se, &ChannelUpdate{Channel: &Channel{ID: "a", Type: ChannelTypeDM, Name: "renamed"}})
+	check("channel update", "2:y", "3:x")
+
+	state.OnInterface(se, &MessageDelete{Message: &Message{ID: "3", ChannelID: "a"}})
+	check("delete", "2:y")
+
+	// Expired messages leave the channel with the next change to the cache.
+	state.Messages.TTL = time.Millisecond
+	time.Sleep(5 * time.Millisecond)
+	state.OnInterface(se, &MessageDelete{Message: &Message{ID: "4", ChannelID: "a"}})
+	check("expire")
+}
+
+func TestStateMessageRevisions(t *testing.T) {
+	se := &Session{StateEnabled: true}
+	state := NewState()
+	state.MaxMessageCount = 10
+	state.Messages.MaxRevisions = 2
+	state.Messages.DeletedRetention = time.Minute
+	state.OnInterface(se, &Ready{User: &User{ID: "bot"}, PrivateChannels: []*Channel{{ID: "a", Type: ChannelTypeDM}}})
+
+	state.OnInterface(se, &MessageCreate{Message: &Message{ID: "1", ChannelID: "a", Content: "first"}})
+	state.OnInterface(se, &MessageUpdate{Message: &Message{ID: "1", ChannelID: "a", Embeds: []*MessageEmbed{{URL: "x"}}}})
+	edits := []struct {
+		content string
+		edited  Timestamp
+	}{
+		{"second", "2020-01-01T00:00:00+00:00"},
+		{"third", "2020-01-02T00:00:00+00:00"},
+		{"fourth", "2020-01-03T00:00:00+00:00"},
+	}
+	for _, e := range edits {
+		state.OnInterface(se, &MessageUpdate{Message: &Message{ID: "1", ChannelID: "a", Content: e.content, EditedTimestamp: e.edited}})
+	}
+
+	revisions, err := state.MessageRevisions("a", "1")
+	if err != nil {
+		t.Fatalf("MessageRevisions returned error: %+v", err)
+	}
+	if len(revisions) != 2 || revisions[0].Content != "second" || revisions[1].Content != "third" {
+		t.Errorf("the last 2 earlier versions should be kept, got %+v", revisions)
+	}
+	if len(revisions[0].Embeds) != 1 {
+		t.Errorf("revision should keep its embeds, got %+v", revisions[0].Embeds)
+	}
+
+	state.OnInterface(se, &MessageDelete{Message: &Message{ID: "1", ChannelID: "a"}})
+	if revisions, err = state.MessageRevisions("a", "1"); err != nil || len(revisions) != 2 {
+		t.Errorf("revisions of a deleted message should be kept, got %+v, %+v", revisions, err)
+	}
+	if _, err = state.MessageRevisions("b", "1"); err != ErrStateNotFound {
+		t.Errorf("revisions in another channel should not be found, got %+v", err)
+	}
+}
+
+func TestStateMessageReactions(t *testing.T) {
+	state := NewState()
+	state.MaxMessageCount = 10
+	state.Messages.TrackReactionUsers = true
+	kv := NewKVState(NewMemoryKV())
+	kv.MaxMessageCount = 10
+
+	for _, st := range []StateCache{state, kv} {
+		se := &Session{StateEnabled: true, State: st}
+		st.OnInterface(se, &Ready{User: &User{ID: "bot"}, PrivateChannels: []*Channel{{ID: "a", Type: ChannelTypeDM}}})
+		st.OnInterface(se, &MessageCreate{Message: &Message{ID: "1", ChannelID: "a"}})
+
+		reaction := func(userID, emoji string) *MessageReaction {
+			return &MessageReaction{UserID: userID, MessageID: "1", ChannelID: "a", Emoji: &Emoji{Name: emoji}}
+		}
+		st.OnInterface(se, &MessageReactionAdd{MessageReaction: reaction("bot", "a")})
+		st.OnInterface(se, &MessageReactionAdd{MessageReaction: reaction("100", "a")})
+		st.OnInterface(se, &MessageReactionAdd{MessageReaction: reaction("100", "b")})
+
+		m, _ := st.Message("a", "1")
+		if len(m.Reactions) != 2 || m.Reactions[0].Count != 2 || !m.Reactions[0].Me || m.Reactions[1].Me {
+			t.Errorf("%T: reactions should be counted, got %+v", st, m.Reactions)
+		}
+
+		r := &MessageReactionRemove{MessageReaction: reaction("bot", "a")}
+		st.OnInterface(se, r)
+		if len(r.BeforeUpdate) != 2 || r.BeforeUpdate[0].Count != 2 {
+			t.Errorf("%T: BeforeUpdate should have the earlier reactions, got %+v", st, r.BeforeUpdate)
+		}
+		if m, _ = st.Message("a", "1"); m.Reactions[0].Count != 1 || m.Reactions[0].Me {
+			t.Errorf("%T: removing a reaction should be counted, got %+v", st, m.Reactions[0])
+		}
+
+		st.OnInterface(se, &MessageReactionRemoveEmoji{MessageReaction: reaction("", "a")})
+		if m, _ = st.Message("a", "1"); len(m.Reactions) != 1 || m.Reactions[0].Emoji.Name != "b" {
+			t.Errorf("%T: removing an emoji should drop its reactions, got %+v", st, m.Reactions)
+		}
+
+		st.OnInterface(se, &MessageReactionRemoveAll{MessageReaction: reaction("", "")})
+		if m, _ = st.Message("a", "1"); len(m.Reactions) != 0 {
+			t.Errorf("%T: removing all reactions should drop them, got %+v", st, m.Reactions)
+		}
+	}
+
+	se := &Session{StateEnabled: true, State: state}
+	for i := 0; i < 2; i++ {
+		state.OnInterface(se, &MessageReactionAdd{MessageReaction: &MessageReaction{UserID: "100", MessageID: "1", ChannelID: "a", Emoji: &Emoji{Name: "c"}}})
+	}
+	if users, err := state.MessageReactionUsers("a", "1", "c"); err != nil || len(users) != 1 || users[0] != "100" {
+		t.Errorf("reaction users should be tracked once, got %+v, %+v", users, err)
+	}
+	if m, _ := state.Message("a", "1"); m.Reactions[0].Count != 1 {
+		t.Errorf("a repeated reaction should be counted once, got %d", m.Reactions[0].Count)
+	}
+}
@@ -0,0 +1,446 @@
+package discordgo
+
+import (
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Flags of the header type of an Ogg page.
+const (
+	oggFlagContinued = 1
+	oggFlagBOS       = 2
+	oggFlagEOS       = 4
+)
+
+const oggPageHeaderSize = 27
+
+// oggCRCTable is the table of the CRC32 of Ogg pages, which uses the
+// polynomial 0x04c11db7 without bit reflection.
+var oggCRCTable = func() (t [256]uint32) {
+	for i := range t {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		t[i] = r
+	}
+	return
+}()
+
+func oggCRC(crc uint32, b []byte) uint32 {
+	for _, c := range b {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^c]
+	}
+	return crc
+}
+
+// opusPacketSamples returns the number of 48kHz samples of an opus packet, as
+// told by its TOC byte, see RFC 6716 section 3.1. It returns 0 for an
+// invalid packet.
+func opusPacketSamples(p []byte) int {
+	if len(p) == 0 {
+		return 0
+	}
+
+	var size int
+	switch config := p[0] >> 3; {
+	case config < 12: // SILK
+		size = []int{480, 960, 1920, 2880}[config%4]
+	case config < 16: // Hybrid
+		size = []int{480, 960}[config%2]
+	default: // CELT
+		size = []int{120, 240, 480, 960}[config%4]
+	}
+
+	switch p[0] & 3 {
+	case 0:
+		return size
+	case 1, 2:
+		return 2 * size
+	}
+
+	if len(p) < 2 {
+		return 0
+	}
+	return int(p[1]&0x3F) * size
+}
+
+// An OggReader reads the opus packets of an Ogg Opus stream.
+type OggReader struct {
+	// Channels and PreSkip are read from the OpusHead header of the stream.
+	Channels int
+	PreSkip  int
+
+	r        io.Reader
+	serial   uint32
+	segments []byte
+	body     []byte
+	seg      int
+	off      int
+	headers  int
+}
+
+// NewOggReader creates an OggReader, and reads the headers of the stream.
+func NewOggReader(r io.Reader) (*OggReader, error) {
+	o := &OggReader{r: r}
+
+	for i := 0; i < 2; i++ {
+		p, err := o.readPacket()
+		if err != nil || o.headers == 0 {
+			return nil, ErrOggInvalid
+		}
+
+		if err = o.readHeader(p); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// ReadPacket returns the next opus packet of the stream, or io.EOF once it
+// ended. The headers of chained streams are skipped.
+func (o *OggReader) ReadPacket() ([]byte, error) {
+	for {
+		p, err := o.readPacket()
+		if err != nil {
+			return nil, err
+		}
+
+		if o.headers == 0 {
+			return p, nil
+		}
+
+		if err = o.readHeader(p); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readHeader reads a header packet of the stream, the OpusHead header
+// followed by the OpusTags header.
+func (o *OggReader) readHeader(p []byte) error {
+	switch o.headers {
+	case 2:
+		if len(p) < 19 || string(p[:8]) != "OpusHead" {
+			return ErrOggInvalid
+		}
+		o.Channels = int(p[9])
+		o.PreSkip = int(binary.LittleEndian.Uint16(p[10:]))
+	case 1:
+		if len(p) < 8 || string(p[:8]) != "OpusTags" {
+			return ErrOggInvalid
+		}
+	}
+
+	o.headers--
+	return nil
+}
+
+// readPacket returns the next packet of the Ogg stream.
+func (o *OggReader) readPacket() ([]byte, error) {
+	var p []byte
+	var started bool
+
+	for {
+		for o.seg < len(o.segments) {
+			l := int(o.segments[o.seg])
+			o.seg++
+
+			p = append(p, o.body[o.off:o.off+l]...)
+			o.off += l
+			started = true
+
+			if l < 255 {
+				return p, nil
+			}
+		}
+
+		continued, err := o.readPage()
+		if err == io.EOF && started {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Drop a packet not continued on this page
+		if !continued {
+			p, started = nil, false
+		}
+	}
+}
+
+// readPage reads the next Ogg page of the stream, and returns whether it
+// continues the last packet of the previous page.
+func (o *OggReader) readPage() (bool, error) {
+	for {
+		var h [oggPageHeaderSize]byte
+		if _, err := io.ReadFull(o.r, h[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return false, ErrOggInvalid
+			}
+			return false, err
+		}
+
+		if string(h[:4]) != "OggS" || h[4] != 0 {
+			return false, ErrOggInvalid
+		}
+
+		segments := make([]byte, h[26])
+		if _, err := io.ReadFull(o.r, segments); err != nil {
+			return false, ErrOggInvalid
+		}
+
+		size := 0
+		for _, l := range segments {
+			size += int(l)
+		}
+
+		body := make([]byte, size)
+		if _, err := io.ReadFull(o.r, body); err != nil {
+			return false, ErrOggInvalid
+		}
+
+		crc := binary.LittleEndian.Uint32(h[22:])
+		binary.LittleEndian.PutUint32(h[22:], 0)
+		if oggCRC(oggCRC(oggCRC(0, h[:]), segments), body) != crc {
+			return false, ErrOggInvalid
+		}
+
+		// Follow the first stream, or the stream chained after it
+		serial := binary.LittleEndian.Uint32(h[14:])
+		if h[5]&oggFlagBOS != 0 {
+			o.serial = serial
+			o.headers = 2
+		} else if serial != o.serial {
+			continue
+		}
+
+		o.segments, o.body, o.seg, o.off = segments, body, 0, 0
+		return h[5]&oggFlagContinued != 0, nil
+	}
+}
+
+// An OggWriter writes opus packets into an Ogg Opus stream.
+type OggWriter struct {
+	w        io.Writer
+	serial   uint32
+	sequence uint32
+	granule  uint64
+	segments []byte
+	body     []byte
+	packets  int
+}
+
+// NewOggWriter creates an OggWriter, and writes the headers of the stream.
+// w        : The writer of the stream.
+// channels : The number of channels of the packets, 2 for Discord audio.
+func NewOggWriter(w io.Writer, channels int) (*OggWriter, error) {
+	o := &OggWriter{w: w, serial: rand.Uint32()}
+
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[8] = 1 // Version
+	head[9] = byte(channels)
+	binary.LittleEndian.PutUint32(head[12:], voiceSampleRate)
+
+	o.add(head)
+	if err := o.flush(oggFlagBOS); err != nil {
+		return nil, err
+	}
+
+	vendor := "discordgo"
+	tags := make([]byte, 8+4+len(vendor)+4)
+	copy(tags, "OpusTags")
+	binary.LittleEndian.PutUint32(tags[8:], uint32(len(vendor)))
+	copy(tags[12:], vendor)
+
+	o.add(tags)
+	if err := o.flush(0); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// WritePacket writes an opus packet.
+func (o *OggWriter) WritePacket(p []byte) error {
+	samples := opusPacketSamples(p)
+	if samples == 0 {
+		return ErrOpusPacket
+	}
+
+	if len(o.segments)+len(p)/255+1 > 255 {
+		if err := o.flush(0); err != nil {
+			return err
+		}
+	}
+
+	o.add(p)
+	o.granule += uint64(samples)
+
+	// Pages hold a second of 20ms packets
+	if o.packets >= 50 {
+		return o.flush(0)
+	}
+
+	return nil
+}
+
+// WriteSilence writes silence, rounded to 20ms.
+func (o *OggWriter) WriteSilence(d time.Duration) error {
+	for n := (d + 10*time.Millisecond) / (20 * time.Millisecond); n > 0; n-- {
+		if err := o.WritePacket(opusSilenceFrame); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close writes the last page of the stream. It does not close the writer of
+// the stream.
+func (o *OggWriter) Close() error {
+	return o.flush(oggFlagEOS)
+}
+
+// add adds a packet to the current page.
+func (o *OggWriter) add(p []byte) {
+	for l := len(p); ; l -= 255 {
+		if l < 255 {
+			o.segments = append(o.segments, byte(l))
+			break
+		}
+		o.segments = append(o.segments, 255)
+	}
+
+	o.body = append(o.body, p...)
+	o.packets++
+}
+
+// flush writes the current page.
+func (o *OggWriter) flush(flags byte) error {
+	page := make([]byte, oggPageHeaderSize, oggPageHeaderSize+len(o.segments)+len(o.body))
+	copy(page, "OggS")
+	page[5] = flags
+	binary.LittleEndian.PutUint64(page[6:], o.granule)
+	binary.LittleEndian.PutUint32(page[14:], o.serial)
+	binary.LittleEndian.PutUint32(page[18:], o.sequence)
+	page[26] = byte(len(o.segments))
+
+	page = append(append(page, o.segments...), o.body...)
+	binary.LittleEndian.PutUint32(page[22:], oggCRC(0, page))
+
+	o.sequence++
+	o.segments, o.body, o.packets = o.segments[:0], o.body[:0], 0
+
+	_, err := o.w.Write(page)
+	return err
+}
+
+// PlayOggOpus sends the audio of an Ogg Opus stream to a voice connection,
+// until the stream ends or stop is closed. The packets of the stream must be
+// as long as the frames sent by the voice connection, 20ms unless FrameSize
+// is set.
+// r    : The Ogg Opus stream.
+// stop : Closed to stop playing, can be nil.
+func (v *VoiceConnection) PlayOggOpus(r io.Reader, stop <-chan struct{}) error {
+	o, err := NewOggReader(r)
+	if err != nil {
+		return err
+	}
+
+	return v.playOpus(o.ReadPacket, stop)
+}
+
+// An OggRecorder records received voice packets, such as the packets of
+// OpusRecv, into an Ogg Opus stream per SSRC. The gaps between the packets of
+// an SSRC are recorded as silence.
+type OggRecorder struct {
+	sync.Mutex
+
+	create     func(ssrc uint32, userID string) (io.WriteCloser, error)
+	recordings map[uint32]*oggRecording
+}
+
+// An oggRecording is the recording of an SSRC.
+type oggRecording struct {
+	w         io.WriteCloser
+	ogg       *OggWriter
+	timestamp uint32 // the timestamp expected of the next packet
+}
+
+// NewOggRecorder creates an OggRecorder.
+// create : Returns the writer of the audio of an SSRC, on its first packet.
+func NewOggRecorder(create func(ssrc uint32, userID string) (io.WriteCloser, error)) *OggRecorder {
+	return &OggRecorder{
+		create:     create,
+		recordings: make(map[uint32]*oggRecording),
+	}
+}
+
+// Record records a received packet. Packets older than the last packet
+// recorded for their SSRC are dropped.
+func (r *OggRecorder) Record(p *Packet) error {
+	r.Lock()
+	defer r.Unlock()
+
+	rec, ok := r.recordings[p.SSRC]
+	if !ok {
+		w, err := r.create(p.SSRC, p.UserID)
+		if err != nil {
+			return err
+		}
+
+		ogg, err := NewOggWriter(w, 2)
+		if err != nil {
+			w.Close()
+			return err
+		}
+
+		rec = &oggRecording{w: w, ogg: ogg, timestamp: p.Timestamp}
+		r.recordings[p.SSRC] = rec
+	}
+
+	gap := int32(p.Timestamp - rec.timestamp)
+	if gap < 0 {
+		return nil
+	}
+
+	if err := rec.ogg.WriteSilence(time.Duration(gap) * time.Second / voiceSampleRate); err != nil {
+		return err
+	}
+
+	if err := rec.ogg.WritePacket(p.Opus); err != nil {
+		return err
+	}
+
+	rec.timestamp = p.Timestamp + uint32(opusPacketSamples(p.Opus))
+	return nil
+}
+
+// Close ends the recordings, and closes their writers.
+func (r *OggRecorder) Close() (err error) {
+	r.Lock()
+	defer r.Unlock()
+
+	for ssrc, rec := range r.recordings {
+		if e := rec.ogg.Close(); e != nil && err == nil {
+			err = e
+		}
+		if e := rec.w.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(r.recordings, ssrc)
+	}
+
+	return
+}
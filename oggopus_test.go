@@ -0,0 +1,217 @@
+package discordgo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+func TestOggCRC(t *testing.T) {
+	// The check value of CRC-32 with polynomial 0x04c11db7, no reflection
+	// and no final xor.
+	if crc := oggCRC(0, []byte("123456789")); crc != 0x89a1897f {
+		t.Errorf("CRC should be 0x89a1897f, got %#x", crc)
+	}
+}
+
+func TestOpusPacketSamples(t *testing.T) {
+	tests := []struct {
+		packet  []byte
+		samples int
+	}{
+		{[]byte{0xF8, 0xFF, 0xFE}, 960}, // CELT 20ms
+		{[]byte{0xFC, 0x00}, 960},       // CELT 20ms stereo
+		{[]byte{0xE0}, 120},             // CELT 2.5ms
+		{[]byte{0x18}, 2880},            // SILK 60ms
+		{[]byte{0x61}, 960},             // Hybrid 10ms, 2 frames
+		{[]byte{0xFB, 0x03}, 2880},      // CELT 20ms, 3 frames
+		{[]byte{0xFB}, 0},               // missing frame count
+		{nil, 0},
+	}
+
+	for _, test := range tests {
+		if samples := opusPacketSamples(test.packet); samples != test.samples {
+			t.Errorf("packet %x should have %d samples, got %d", test.packet, test.samples, samples)
+		}
+	}
+}
+
+// oggGranules returns the granule positions of the pages of an Ogg stream.
+func oggGranules(t *testing.T, b []byte) (granules []uint64) {
+	for len(b) > 0 {
+		if len(b) < oggPageHeaderSize || string(b[:4]) != "OggS" {
+			t.Fatalf("invalid ogg page %x", b)
+		}
+
+		size := oggPageHeaderSize + int(b[26])
+		for _, l := range b[oggPageHeaderSize:size] {
+			size += int(l)
+		}
+
+		granules = append(granules, binary.LittleEndian.Uint64(b[6:]))
+		b = b[size:]
+	}
+	return
+}
+
+func TestOggWriterReader(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewOggWriter(&buf, 2)
+	if err != nil {
+		t.Fatalf("NewOggWriter returned error: %+v", err)
+	}
+
+	// Packets spanning several segments, and enough packets for several
+	// pages.
+	var packets [][]byte
+	for i := 0; i < 120; i++ {
+		p := bytes.Repeat([]byte{byte(i)}, 1+i*5)
+		p[0] = 0xFC
+		packets = append(packets, p)
+
+		if err = w.WritePacket(p); err != nil {
+			t.Fatalf("WritePacket returned error: %+v", err)
+		}
+	}
+	if err = w.WriteSilence(45e6); err != nil {
+		t.Fatalf("WriteSilence returned error: %+v", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close returned error: %+v", err)
+	}
+
+	granules := oggGranules(t, buf.Bytes())
+	if len(granules) < 5 || granules[0] != 0 || granules[1] != 0 || granules[len(granules)-1] != 122*960 {
+		t.Errorf("header pages should have granule 0 and the last page %d, got %v", 122*960, granules)
+	}
+
+	r, err := NewOggReader(&buf)
+	if err != nil {
+		t.Fatalf("NewOggReader returned error: %+v", err)
+	}
+	if r.Channels != 2 || r.PreSkip != 0 {
+		t.Errorf("stream should have 2 channels and no pre-skip, got %d and %d", r.Channels, r.PreSkip)
+	}
+
+	for _, want := range append(packets, opusSilenceFrame, opusSilenceFrame) {
+		p, err := r.ReadPacket()
+		if err != nil || !bytes.Equal(p, want) {
+			t.Fatalf("packet should be %x, got %x, %+v", want, p, err)
+		}
+	}
+
+	if _, err = r.ReadPacket(); err != io.EOF {
+		t.Errorf("stream should end, got %+v", err)
+	}
+}
+
+func TestOggReaderInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewOggWriter(&buf, 2)
+	w.WritePacket(opusSilenceFrame)
+	w.Close()
+
+	b := buf.Bytes()
+	b[len(b)-1] ^= 1
+
+	r, err := NewOggReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("NewOggReader returned error: %+v", err)
+	}
+	if _, err = r.ReadPacket(); err != ErrOggInvalid {
+		t.Errorf("page with a wrong CRC should be invalid, got %+v", err)
+	}
+
+	if _, err = NewOggReader(bytes.NewReader([]byte("OggS"))); err != ErrOggInvalid {
+		t.Errorf("truncated stream should be invalid, got %+v", err)
+	}
+}
+
+type nopWriteCloser struct {
+	*bytes.Buffer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestOggRecorder(t *testing.T) {
+	files := make(map[uint32]*bytes.Buffer)
+	users := make(map[uint32]string)
+
+	rec := NewOggRecorder(func(ssrc uint32, userID string) (io.WriteCloser, error) {
+		files[ssrc] = &bytes.Buffer{}
+		users[ssrc] = userID
+		return nopWriteCloser{files[ssrc]}, nil
+	})
+
+	opus := []byte{0xFC, 1, 2, 3}
+	for _, p := range []*Packet{
+		{SSRC: 1, UserID: "a", Timestamp: 1000, Opus: opus},
+		{SSRC: 2, UserID: "b", Timestamp: 5000, Opus: opus},
+		{SSRC: 1, UserID: "a", Timestamp: 1960, Opus: opus},
+		{SSRC: 1, UserID: "a", Timestamp: 1000, Opus: opus}, // late
+		{SSRC: 1, UserID: "a", Timestamp: 1960 + 4*960, Opus: opus},
+	} {
+		if err := rec.Record(p); err != nil {
+			t.Fatalf("Record returned error: %+v", err)
+		}
+	}
+
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close returned error: %+v", err)
+	}
+
+	if len(files) != 2 || users[1] != "a" || users[2] != "b" {
+		t.Fatalf("a recording should be made per SSRC, got %v", users)
+	}
+
+	r, err := NewOggReader(files[1])
+	if err != nil {
+		t.Fatalf("NewOggReader returned error: %+v", err)
+	}
+
+	// The gap of 3 packets is recorded as silence.
+	for i, want := range [][]byte{opus, opus, opusSilenceFrame, opusSilenceFrame, opusSilenceFrame, opus} {
+		p, err := r.ReadPacket()
+		if err != nil || !bytes.Equal(p, want) {
+			t.Errorf("packet %d should be %x, got %x, %+v", i, want, p, err)
+		}
+	}
+
+	if granules := oggGranules(t, files[2].Bytes()); granules[len(granules)-1] != 960 {
+		t.Errorf("recording of SSRC 2 should be one packet long, got granules %v", granules)
+	}
+}
+
+func TestPlayOggOpus(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewOggWriter(&buf, 2)
+	w.WritePacket([]byte{0xFC, 1})
+	w.WritePacket([]byte{0xFC, 2})
+	w.Close()
+	stream := buf.Bytes()
+
+	v := &VoiceConnection{}
+	if err := v.PlayOggOpus(bytes.NewReader(stream), nil); err != ErrVoiceNotReady {
+		t.Errorf("playing on an unconnected voice connection should fail, got %+v", err)
+	}
+
+	v.OpusSend = make(chan []byte, 2)
+	if err := v.PlayOggOpus(bytes.NewReader(stream), nil); err != nil {
+		t.Fatalf("PlayOggOpus returned error: %+v", err)
+	}
+	if p := <-v.OpusSend; !bytes.Equal(p, []byte{0xFC, 1}) {
+		t.Errorf("first packet should be sent first, got %x", p)
+	}
+	if p := <-v.OpusSend; !bytes.Equal(p, []byte{0xFC, 2}) {
+		t.Errorf("second packet should be sent second, got %x", p)
+	}
+
+	buf.Reset()
+	w, _ = NewOggWriter(&buf, 2)
+	w.WritePacket([]byte{0xE0})
+	w.Close()
+	if err := v.PlayOggOpus(&buf, nil); err != ErrOpusFrameSize {
+		t.Errorf("playing 2.5ms packets should fail, got %+v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package discordgo
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// A RecordedEvent is a single raw gateway payload as written by an EventRecorder.
+type RecordedEvent struct {
+	Operation  int             `json:"op"`
+	Sequence   int64           `json:"s"`
+	Type       string          `json:"t"`
+	RawData    json.RawMessage `json:"d"`
+	ReceivedAt time.Time       `json:"received_at"`
+}
+
+// An EventRecorder writes raw gateway payloads as JSON lines.
+// Assign it to Session.Recorder to start recording.
+type EventRecorder struct {
+	sync.Mutex
+
+	closer  io.Closer
+	encoder *json.Encoder
+}
+
+// NewEventRecorder creates an EventRecorder that writes to w.
+func NewEventRecorder(w io.Writer) *EventRecorder {
+	return &EventRecorder{
+		encoder: json.NewEncoder(w),
+	}
+}
+
+// OpenEventRecorder creates an EventRecorder that appends to the file at path,
+// creating it if it does not exist.
+// path : the path of the JSONL file to record to
+func OpenEventRecorder(path string) (*EventRecorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	r := NewEventRecorder(f)
+	r.closer = f
+	return r, nil
+}
+
+// Record writes the given event to the recorder, stamped with the current time.
+func (r *EventRecorder) Record(e *Event) error {
+	return r.write(&RecordedEvent{
+		Operation:  e.Operation,
+		Sequence:   e.Sequence,
+		Type:       e.Type,
+		RawData:    e.RawData,
+		ReceivedAt: time.Now().UTC(),
+	})
+}
+
+func (r *EventRecorder) write(re *RecordedEvent) error {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.encoder.Encode(re)
+}
+
+// Close closes the underlying file if the recorder was created with OpenEventRecorder.
+func (r *EventRecorder) Close() error {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.closer == nil {
+		return nil
+	}
+
+	err := r.closer.Close()
+	r.closer = nil
+	return err
+}
+
+// An EventReplayer feeds recorded gateway payloads back through a Session,
+// as if they were received from Discord, without any network access.
+type EventReplayer struct {
+	// Speed is the factor by which the original timing between events is
+	// sped up. 1 replays at the original speed, 2 at twice the speed.
+	// 0 replays all events without any delay.
+	Speed float64
+
+	r     io.Reader
+	sleep func(time.Duration)
+}
+
+// NewEventReplayer creates an EventReplayer that reads recorded events from r.
+func NewEventReplayer(r io.Reader) *EventReplayer {
+	return &EventReplayer{
+		r:     r,
+		sleep: time.Sleep,
+	}
+}
+
+// ReplayFile replays the recorded events in the file at path through the given session.
+// s     : the Session to dispatch the events on
+// path  : the path of the JSONL file to replay
+// speed : the factor by which the original timing between events is sped up, 0 for no delays
+func ReplayFile(s *Session, path string, speed float64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	replayer := NewEventReplayer(f)
+	replayer.Speed = speed
+	return replayer.Replay(s)
+}
+
+// Replay dispatches every recorded event through the given session, so that
+// the state and all registered event handlers see them as they would live.
+// Only Dispatch (Op 0) events are replayed; heartbeats and other
+// connection management payloads are skipped.
+// The gateway sequence of the session is not changed, so events can be
+// replayed into a connected session.
+func (r *EventReplayer) Replay(s *Session) error {
+	if s.State == nil {
+		return ErrNilState
+	}
+
+	decoder := json.NewDecoder(bufio.NewReader(r.r))
+
+	var last time.Time
+	for {
+		var re RecordedEvent
+		err := decoder.Decode(&re)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if r.Speed > 0 && !last.IsZero() && re.ReceivedAt.After(last) {
+			r.sleep(time.Duration(float64(re.ReceivedAt.Sub(last)) / r.Speed))
+		}
+		last = re.ReceivedAt
+
+		if re.Operation != 0 {
+			continue
+		}
+
+		s.dispatch(&Event{
+			Operation: re.Operation,
+			Sequence:  re.Sequence,
+			Type:      re.Type,
+			RawData:   re.RawData,
+		})
+	}
+}
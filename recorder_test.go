@@ -0,0 +1,104 @@
+package discordgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEventRecorderReplay(t *testing.T) {
+	var buf bytes.Buffer
+	rec := NewEventRecorder(&buf)
+
+	events := []*Event{
+		{Operation: 11},
+		{Operation: 0, Sequence: 1, Type: "READY", RawData: json.RawMessage(`{"v":6,"session_id":"abc","user":{"id":"1","username":"bot"},"guilds":[],"private_channels":[]}`)},
+		{Operation: 0, Sequence: 2, Type: "GUILD_CREATE", RawData: json.RawMessage(`{"id":"10","name":"guild","channels":[{"id":"20","name":"general","type":0}],"members":[{"user":{"id":"1","username":"bot"}}]}`)},
+		{Operation: 0, Sequence: 3, Type: "MESSAGE_CREATE", RawData: json.RawMessage(`{"id":"30","channel_id":"20","guild_id":"10","content":"hello","author":{"id":"1"}}`)},
+	}
+	for _, e := range events {
+		if err := rec.Record(e); err != nil {
+			t.Fatalf("Record returned error: %+v", err)
+		}
+	}
+
+	s, _ := New()
+	s.SyncEvents = true
+	s.State.(*State).MaxMessageCount = 10
+
+	var created []*MessageCreate
+	s.AddHandler(func(s *Session, m *MessageCreate) {
+		created = append(created, m)
+	})
+
+	if err := NewEventReplayer(&buf).Replay(s); err != nil {
+		t.Fatalf("Replay returned error: %+v", err)
+	}
+
+	if s.sessionID != "abc" {
+		t.Errorf("sessionID should be abc, got %q", s.sessionID)
+	}
+
+	g, err := s.State.Guild("10")
+	if err != nil {
+		t.Fatalf("guild was not replayed into the state: %+v", err)
+	}
+	if g.Name != "guild" {
+		t.Errorf("guild name should be guild, got %q", g.Name)
+	}
+
+	m, err := s.State.Message("20", "30")
+	if err != nil {
+		t.Fatalf("message was not replayed into the state: %+v", err)
+	}
+	if m.Content != "hello" {
+		t.Errorf("message content should be hello, got %q", m.Content)
+	}
+
+	if len(created) != 1 {
+		t.Errorf("MessageCreate handler should have been called once, got %d", len(created))
+	}
+}
+
+func TestEventReplayerSpeed(t *testing.T) {
+	var buf bytes.Buffer
+	rec := NewEventRecorder(&buf)
+
+	start := time.Now().UTC()
+	for i, at := range []time.Duration{0, 400 * time.Millisecond, 400 * time.Millisecond, time.Second} {
+		rec.write(&RecordedEvent{Operation: 0, Sequence: int64(i + 1), Type: "RESUMED", RawData: json.RawMessage(`{}`), ReceivedAt: start.Add(at)})
+	}
+
+	s, _ := New()
+	s.SyncEvents = true
+
+	var replayed []string
+	s.AddHandler(func(s *Session, e *Event) {
+		replayed = append(replayed, "event "+strconv.FormatInt(e.Sequence, 10))
+	})
+
+	// The sequence of the live session is kept.
+	*s.sequence = 42
+
+	replayer := NewEventReplayer(&buf)
+	replayer.Speed = 4
+	replayer.sleep = func(d time.Duration) {
+		replayed = append(replayed, "sleep "+d.String())
+	}
+
+	if err := replayer.Replay(s); err != nil {
+		t.Fatalf("Replay returned error: %+v", err)
+	}
+
+	if *s.sequence != 42 {
+		t.Errorf("replaying should not change the sequence of the session, got %d", *s.sequence)
+	}
+
+	want := []string{"event 1", "sleep 100ms", "event 2", "event 3", "sleep 150ms", "event 4"}
+	if !reflect.DeepEqual(replayed, want) {
+		t.Errorf("events should be replayed at 4x speed as %v, got %v", want, replayed)
+	}
+}
@@ -354,6 +354,12 @@ func (s *Session) Guild(guildID string) (st *Guild, err error) {
 		}
 	}
 
+	return s.FetchGuild(guildID)
+}
+
+// FetchGuild returns a Guild structure of a specific Guild using the discord api.
+// guildID   : The ID of a Guild
+func (s *Session) FetchGuild(guildID string) (st *Guild, err error) {
 	body, err := s.RequestWithBucketID("GET", EndpointGuild(guildID), nil, EndpointGuild(guildID))
 	if err != nil {
 		return
@@ -844,6 +850,19 @@ func (s *Session) GuildInvites(guildID string) (st []*Invite, err error) {
 	return
 }
 
+// GuildVanityURL returns the vanity URL code of a guild and its uses,
+// as an Invite with only the Code and Uses fields set.
+// guildID   : The ID of a Guild.
+func (s *Session) GuildVanityURL(guildID string) (st *Invite, err error) {
+	body, err := s.RequestWithBucketID("GET", EndpointGuildVanityURL(guildID), nil, EndpointGuildVanityURL(guildID))
+	if err != nil {
+		return
+	}
+
+	err = unmarshal(body, &st)
+	return
+}
+
 // GuildRoles returns all roles for a given guild.
 // guildID   : The ID of a Guild.
 func (s *Session) GuildRoles(guildID string) (st []*Role, err error) {
@@ -107,6 +107,14 @@ func (r *Role) IsDefault() bool {
 
 // GetMembers returns a slice with all members in the guild with this role
 func (r *Role) GetMembers() (members []*Member, err error) {
+	if r.Session != nil {
+		if st, ok := r.Session.State.(*State); ok {
+			if indexed, err := st.MembersWithRole(r.Guild.ID, r.ID); err == nil {
+				return indexed, nil
+			}
+		}
+	}
+
 	allMembers := r.Guild.Members
 	for _, m := range allMembers {
 		for _, roleID := range m.Roles {
@@ -15,11 +15,22 @@ package discordgo
 import (
 	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// stateShardCount is the number of locks guild data is sharded over.
+const stateShardCount = 64
+
 // A State contains the current known state.
 // As discord sends this in a READY blob, it seems reasonable to simply
 // use that struct as the data store.
+//
+// The embedded RWMutex only guards the Ready fields, such as the Guilds and
+// PrivateChannels slices. The contents of a guild, and the messages of its
+// channels, are guarded by one of a set of sharded locks picked by guild ID,
+// so that events of different guilds do not contend. Lookups of guilds,
+// channels, members and users by ID take no lock at all.
 type State struct {
 	sync.RWMutex
 	Ready
@@ -33,10 +44,48 @@ type State struct {
 	TrackVoice      bool
 	TrackPresences  bool
 
-	guildMap   map[string]*Guild
-	channelMap map[string]*Channel
-	memberMap  map[string]map[string]*Member
-	userMap    map[string]*User
+	// MemberCachePolicy decides which members are kept while TrackMembers
+	// is on, nil keeps every member.
+	MemberCachePolicy *MemberCachePolicy
+
+	// Messages holds the cached messages of all channels.
+	Messages *MessageCache
+
+	// CopyOnRead makes lookups return deep copies, taken under the locks that
+	// guard the state, so they can be read while later events are handled.
+	// The state then stores copies of the entities of events as well, so the
+	// events given to handlers are not changed by later events either.
+	// Messages are the exception: the state never changes a cached message,
+	// an update replaces it, so the messages of events and lookups are shared
+	// with State.Messages and must not be modified.
+	// Looking up a guild, or one of its roles or emojis, copies the whole
+	// guild, which is slow for large guilds. The Ready fields still hold the
+	// stored entities. Set it before opening the session.
+	CopyOnRead bool
+
+	shards [stateShardCount]sync.RWMutex
+
+	guildMap   sync.Map // map[string]*Guild
+	channelMap sync.Map // map[string]*Channel
+	shardIDMap sync.Map // map[string]string, the shard ID of every channel
+	memberMap  sync.Map // map[string]*sync.Map of map[string]*Member
+	userMap    sync.Map // map[string]*User
+	lruMap     sync.Map // map[string]*memberLRU
+	indexMap   sync.Map // map[string]*guildIndex
+
+	// userMu guards the users in the userMap, and the guilds of every user.
+	userMu sync.Mutex
+
+	// The ID of the bot user, readable under any lock.
+	myID atomic.Value
+
+	// messagesMu orders the changes of the message cache mirrored into the
+	// Messages of the channels.
+	messagesMu sync.Mutex
+
+	// When expired members were last evicted.
+	sweepMu   sync.Mutex
+	lastSweep time.Time
 }
 
 // NewState creates an empty state.
@@ -52,32 +101,89 @@ func NewState() *State {
 		TrackRoles:     true,
 		TrackVoice:     true,
 		TrackPresences: true,
-		guildMap:       make(map[string]*Guild),
-		channelMap:     make(map[string]*Channel),
-		memberMap:      make(map[string]map[string]*Member),
-		userMap:        make(map[string]*User),
+		Messages:       NewMessageCache(),
 	}
 }
 
 // MyUser returns the bots user
 func (s *State) MyUser() *User {
-	return s.User
+	if !s.CopyOnRead {
+		return s.User
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+	s.userMu.Lock()
+	defer s.userMu.Unlock()
+
+	return copyUser(s.User)
 }
 
-func (s *State) addUser(guildID string, user *User) {
-	if _, ok := s.userMap[user.ID]; !ok {
-		s.userMap[user.ID] = user
+func (s *State) setMyID(u *User) {
+	if u != nil {
+		s.myID.Store(u.ID)
 	}
+}
 
-	if !Contains(s.userMap[user.ID].guilds, guildID) {
-		s.userMap[user.ID].guilds = append(s.userMap[user.ID].guilds, guildID)
+// shard returns the lock guarding the data of a guild, or of a private
+// channel when given its channel ID.
+func (s *State) shard(id string) *sync.RWMutex {
+	// FNV-1a, inlined to not allocate on every lookup.
+	h := uint32(2166136261)
+	for i := 0; i < len(id); i++ {
+		h ^= uint32(id[i])
+		h *= 16777619
 	}
+	return &s.shards[h%stateShardCount]
+}
 
-	user.guilds = s.userMap[user.ID].guilds
+// channelShard returns the lock guarding the messages of a channel.
+func (s *State) channelShard(c *Channel) *sync.RWMutex {
+	return s.shard(channelShardID(c))
+}
+
+// storeChannel adds a channel to the lookup maps.
+func (s *State) storeChannel(c *Channel) {
+	c.Messages = s.Messages.ChannelMessages(c.ID)
+	s.shardIDMap.Store(c.ID, channelShardID(c))
+	s.channelMap.Store(c.ID, c)
+}
+
+// deleteChannel removes a channel from the lookup maps.
+func (s *State) deleteChannel(channelID string) {
+	s.channelMap.Delete(channelID)
+	s.shardIDMap.Delete(channelID)
+}
+
+// members returns the member map of a guild.
+func (s *State) members(guildID string) (*sync.Map, bool) {
+	members, ok := s.memberMap.Load(guildID)
+	if !ok {
+		return nil, false
+	}
+	return members.(*sync.Map), true
+}
+
+func (s *State) addUser(guildID string, user *User) {
+	s.userMu.Lock()
+	defer s.userMu.Unlock()
+
+	u, _ := s.userMap.LoadOrStore(user.ID, user)
+	stored := u.(*User)
+
+	if !Contains(stored.guilds, guildID) {
+		stored.guilds = append(stored.guilds, guildID)
+	}
+
+	user.guilds = stored.guilds
 }
 
 func (s *State) removeUser(guildID, userID string) {
-	if u, ok := s.userMap[userID]; ok {
+	s.userMu.Lock()
+	defer s.userMu.Unlock()
+
+	if v, ok := s.userMap.Load(userID); ok {
+		u := v.(*User)
 		for i := 0; i < len(u.guilds); i++ {
 			if u.guilds[i] == guildID {
 				u.guilds = append(u.guilds[:i], u.guilds[i+1:]...)
@@ -85,18 +191,18 @@ func (s *State) removeUser(guildID, userID string) {
 			}
 		}
 		if len(u.guilds) == 0 {
-			delete(s.userMap, userID)
+			s.userMap.Delete(userID)
 		}
 	}
 }
 
 func (s *State) createMemberMap(guild *Guild) {
-	members := make(map[string]*Member)
+	members := &sync.Map{}
 	for _, m := range guild.Members {
-		members[m.User.ID] = m
+		members.Store(m.User.ID, m)
 		s.addUser(guild.ID, m.User)
 	}
-	s.memberMap[guild.ID] = members
+	s.memberMap.Store(guild.ID, members)
 }
 
 // GuildAdd adds a guild to the current world state, or
@@ -106,23 +212,40 @@ func (s *State) GuildAdd(guild *Guild, se *Session) error {
 		return ErrNilState
 	}
 
-	s.Lock()
-	defer s.Unlock()
+	if s.CopyOnRead {
+		guild = copyGuild(guild)
+	}
+
+	lock := s.shard(guild.ID)
+	lock.Lock()
+
+	// The session is set before the users of the guild can be shared
+	// with other guilds through the userMap.
+	se.setSession(guild)
+
+	v, exists := s.guildMap.Load(guild.ID)
+	if exists {
+		s.reconcileGuild(v.(*Guild), guild)
+	}
+	reindex := !exists || guild.Members != nil || guild.VoiceStates != nil
 
 	// Update the channels to point to the right guild, adding them to the channelMap as we go
 	for _, c := range guild.Channels {
-		s.channelMap[c.ID] = c
+		s.storeChannel(c)
 	}
 
 	// If this guild contains a new member slice, we must regenerate the member map so the pointers stay valid
 	if guild.Members != nil {
 		s.createMemberMap(guild)
-	} else if _, ok := s.memberMap[guild.ID]; !ok {
+		s.resetMemberLRU(guild, time.Now())
+	} else {
 		// Even if we have no new member slice, we still initialize the member map for this guild if it doesn't exist
-		s.memberMap[guild.ID] = make(map[string]*Member)
+		s.memberMap.LoadOrStore(guild.ID, &sync.Map{})
 	}
 
-	if g, ok := s.guildMap[guild.ID]; ok {
+	if exists {
+		g := v.(*Guild)
+
 		// We are about to replace `g` in the state with `guild`, but first we need to
 		// make sure we preserve any fields that the `guild` doesn't contain from `g`.
 		if guild.MemberCount == 0 {
@@ -147,15 +270,22 @@ func (s *State) GuildAdd(guild *Guild, se *Session) error {
 			guild.VoiceStates = g.VoiceStates
 		}
 		*g = *guild
+		if reindex {
+			s.indexGuild(g)
+		}
 
 		se.setSession(g)
+		lock.Unlock()
 		return nil
 	}
 
-	se.setSession(guild)
+	s.indexGuild(guild)
+	s.guildMap.Store(guild.ID, guild)
+	lock.Unlock()
 
+	s.Lock()
 	s.Guilds = append(s.Guilds, guild)
-	s.guildMap[guild.ID] = guild
+	s.Unlock()
 
 	return nil
 }
@@ -166,21 +296,19 @@ func (s *State) GuildRemove(guild *Guild) error {
 		return ErrNilState
 	}
 
-	_, err := s.Guild(guild.ID)
+	g, err := s.guild(guild.ID)
 	if err != nil {
 		return err
 	}
 
+	lock := s.shard(guild.ID)
+	lock.Lock()
+	s.forgetGuild(g)
+	lock.Unlock()
+
 	s.Lock()
 	defer s.Unlock()
 
-	delete(s.guildMap, guild.ID)
-
-	for _, m := range guild.Members {
-		s.removeUser(guild.ID, m.User.ID)
-	}
-	delete(s.memberMap, guild.ID)
-
 	for i, g := range s.Guilds {
 		if g.ID == guild.ID {
 			s.Guilds = append(s.Guilds[:i], s.Guilds[i+1:]...)
@@ -191,6 +319,62 @@ func (s *State) GuildRemove(guild *Guild) error {
 	return nil
 }
 
+// forgetGuild removes a guild, its members and its channels from the lookup maps.
+func (s *State) forgetGuild(g *Guild) {
+	s.guildMap.Delete(g.ID)
+	for _, m := range g.Members {
+		s.removeUser(g.ID, m.User.ID)
+	}
+	s.memberMap.Delete(g.ID)
+	s.lruMap.Delete(g.ID)
+	s.indexMap.Delete(g.ID)
+	for _, c := range g.Channels {
+		s.deleteChannel(c.ID)
+		s.Messages.removeChannel(c.ID)
+	}
+}
+
+// reconcileGuild drops the channels and members of a stored guild that are
+// missing from a full copy of it, such as a GUILD_CREATE received after the
+// state was loaded from a snapshot.
+func (s *State) reconcileGuild(old, guild *Guild) {
+	if guild.Channels != nil {
+		channels := make(map[string]bool, len(guild.Channels))
+		for _, c := range guild.Channels {
+			channels[c.ID] = true
+		}
+		for _, c := range old.Channels {
+			if !channels[c.ID] {
+				s.deleteChannel(c.ID)
+				s.Messages.removeChannel(c.ID)
+			}
+		}
+	}
+
+	if guild.Members == nil {
+		return
+	}
+
+	members := make(map[string]bool, len(guild.Members))
+	for _, m := range guild.Members {
+		members[m.User.ID] = true
+	}
+
+	for _, m := range old.Members {
+		if members[m.User.ID] {
+			continue
+		}
+
+		// Large guilds are only sent with their online members,
+		// so the other known members are kept.
+		if guild.Large {
+			guild.Members = append(guild.Members, m)
+		} else {
+			s.removeUser(guild.ID, m.User.ID)
+		}
+	}
+}
+
 // Guild gets a guild by ID.
 // Useful for querying if @me is in a guild:
 //     _, err := discordgo.Session.State.Guild(guildID)
@@ -200,11 +384,26 @@ func (s *State) Guild(guildID string) (*Guild, error) {
 		return nil, ErrNilState
 	}
 
-	s.RLock()
-	defer s.RUnlock()
+	g, err := s.guild(guildID)
+	if err != nil || !s.CopyOnRead {
+		return g, err
+	}
+
+	s.viewCopy(guildID, func() {
+		g = copyGuild(g)
+	})
+	return g, nil
+}
 
-	if g, ok := s.guildMap[guildID]; ok {
-		return g, nil
+// guild gets a stored guild by ID.
+// guildSummary gets a guild by ID, the State always has all of it.
+func (s *State) guildSummary(guildID string) (*Guild, error) {
+	return s.Guild(guildID)
+}
+
+func (s *State) guild(guildID string) (*Guild, error) {
+	if g, ok := s.guildMap.Load(guildID); ok {
+		return g.(*Guild), nil
 	}
 
 	return nil, ErrStateNotFound
@@ -217,48 +416,22 @@ func (s *State) PresenceAdd(guildID string, presence *Presence) error {
 		return ErrNilState
 	}
 
-	guild, err := s.Guild(guildID)
+	guild, err := s.guild(guildID)
 	if err != nil {
 		return err
 	}
 
-	s.Lock()
-	defer s.Unlock()
+	if s.CopyOnRead {
+		presence = copyPresence(presence)
+	}
+
+	lock := s.shard(guildID)
+	lock.Lock()
+	defer lock.Unlock()
 
 	for i, p := range guild.Presences {
 		if p.User.ID == presence.User.ID {
-			//guild.Presences[i] = presence
-
-			//Update status
-			guild.Presences[i].Game = presence.Game
-			guild.Presences[i].Roles = presence.Roles
-			if presence.Status != "" {
-				guild.Presences[i].Status = presence.Status
-			}
-			if presence.Nick != "" {
-				guild.Presences[i].Nick = presence.Nick
-			}
-
-			//Update the optionally sent user information
-			//ID Is a mandatory field so you should not need to check if it is empty
-			guild.Presences[i].User.ID = presence.User.ID
-
-			if presence.User.Avatar != "" {
-				guild.Presences[i].User.Avatar = presence.User.Avatar
-			}
-			if presence.User.Discriminator != "" {
-				guild.Presences[i].User.Discriminator = presence.User.Discriminator
-			}
-			if presence.User.Email != "" {
-				guild.Presences[i].User.Email = presence.User.Email
-			}
-			if presence.User.Token != "" {
-				guild.Presences[i].User.Token = presence.User.Token
-			}
-			if presence.User.Username != "" {
-				guild.Presences[i].User.Username = presence.User.Username
-			}
-
+			mergePresence(guild.Presences[i], presence)
 			return nil
 		}
 	}
@@ -267,19 +440,57 @@ func (s *State) PresenceAdd(guildID string, presence *Presence) error {
 	return nil
 }
 
+// mergePresence applies a presence update to a stored presence.
+func mergePresence(p, presence *Presence) {
+	//Update status
+	p.Game = presence.Game
+	p.Activities = presence.Activities
+	p.Roles = presence.Roles
+	if presence.Status != "" {
+		p.Status = presence.Status
+	}
+	if presence.Nick != "" {
+		p.Nick = presence.Nick
+	}
+
+	//Update the optionally sent user information
+	//ID Is a mandatory field so you should not need to check if it is empty
+	//The user is replaced rather than changed, as it can be shared with a member
+	u := *p.User
+	u.ID = presence.User.ID
+
+	if presence.User.Avatar != "" {
+		u.Avatar = presence.User.Avatar
+	}
+	if presence.User.Discriminator != "" {
+		u.Discriminator = presence.User.Discriminator
+	}
+	if presence.User.Email != "" {
+		u.Email = presence.User.Email
+	}
+	if presence.User.Token != "" {
+		u.Token = presence.User.Token
+	}
+	if presence.User.Username != "" {
+		u.Username = presence.User.Username
+	}
+	p.User = &u
+}
+
 // PresenceRemove removes a presence from the current world state.
 func (s *State) PresenceRemove(guildID string, presence *Presence) error {
 	if s == nil {
 		return ErrNilState
 	}
 
-	guild, err := s.Guild(guildID)
+	guild, err := s.guild(guildID)
 	if err != nil {
 		return err
 	}
 
-	s.Lock()
-	defer s.Unlock()
+	lock := s.shard(guildID)
+	lock.Lock()
+	defer lock.Unlock()
 
 	for i, p := range guild.Presences {
 		if p.User.ID == presence.User.ID {
@@ -297,13 +508,20 @@ func (s *State) Presence(guildID, userID string) (*Presence, error) {
 		return nil, ErrNilState
 	}
 
-	guild, err := s.Guild(guildID)
+	guild, err := s.guild(guildID)
 	if err != nil {
 		return nil, err
 	}
 
+	lock := s.shard(guildID)
+	lock.RLock()
+	defer lock.RUnlock()
+
 	for _, p := range guild.Presences {
 		if p.User.ID == userID {
+			if s.CopyOnRead {
+				return copyPresence(p), nil
+			}
 			return p, nil
 		}
 	}
@@ -320,35 +538,49 @@ func (s *State) MemberAdd(member *Member, se *Session) error {
 		return ErrNilState
 	}
 
-	guild, err := s.Guild(member.GuildID)
+	guild, err := s.guild(member.GuildID)
 	if err != nil {
 		return err
 	}
 
-	s.Lock()
-	defer s.Unlock()
+	if s.CopyOnRead {
+		member = copyMember(member)
+	}
+
+	lock := s.shard(member.GuildID)
+	lock.Lock()
+	defer lock.Unlock()
 
-	members, ok := s.memberMap[member.GuildID]
+	members, ok := s.members(member.GuildID)
 	if !ok {
 		return ErrStateNotFound
 	}
 
 	member.User.Session = se
-	m, ok := members[member.User.ID]
+	v, ok := members.Load(member.User.ID)
 	if !ok {
-		members[member.User.ID] = member
+		members.Store(member.User.ID, member)
 		guild.Members = append(guild.Members, member)
+		s.indexMember(member)
 	} else {
+		m := v.(*Member)
+
 		// We are about to replace `m` in the state with `member`, but first we need to
 		// make sure we preserve any fields that the `member` doesn't contain from `m`.
 		if member.JoinedAt == "" {
 			member.JoinedAt = m.JoinedAt
 		}
+		s.unindexMember(member.GuildID, m)
 		*m = *member
+		s.indexMember(m)
 	}
 
 	s.addUser(member.GuildID, member.User)
 
+	now := time.Now()
+	s.touchMember(member.GuildID, member.User.ID, now)
+	s.evictMembers(guild, now)
+
 	return nil
 }
 
@@ -358,26 +590,29 @@ func (s *State) MemberRemove(member *Member) error {
 		return ErrNilState
 	}
 
-	guild, err := s.Guild(member.GuildID)
+	guild, err := s.guild(member.GuildID)
 	if err != nil {
 		return err
 	}
 
-	s.Lock()
-	defer s.Unlock()
+	lock := s.shard(member.GuildID)
+	lock.Lock()
+	defer lock.Unlock()
 
 	s.removeUser(member.GuildID, member.User.ID)
+	s.forgetMember(member.GuildID, member.User.ID)
 
-	members, ok := s.memberMap[member.GuildID]
+	members, ok := s.members(member.GuildID)
 	if !ok {
 		return ErrStateNotFound
 	}
 
-	_, ok = members[member.User.ID]
+	m, ok := members.Load(member.User.ID)
 	if !ok {
 		return ErrStateNotFound
 	}
-	delete(members, member.User.ID)
+	members.Delete(member.User.ID)
+	s.unindexMember(member.GuildID, m.(*Member))
 
 	for i, m := range guild.Members {
 		if m.User.ID == member.User.ID {
@@ -395,17 +630,27 @@ func (s *State) Member(guildID, userID string) (*Member, error) {
 		return nil, ErrNilState
 	}
 
-	s.RLock()
-	defer s.RUnlock()
+	m, err := s.member(guildID, userID)
+	if err != nil || !s.CopyOnRead {
+		return m, err
+	}
+
+	s.viewCopy(guildID, func() {
+		m = copyMember(m)
+	})
+	return m, nil
+}
 
-	members, ok := s.memberMap[guildID]
+// member gets a stored member by guild and user ID.
+func (s *State) member(guildID, userID string) (*Member, error) {
+	members, ok := s.members(guildID)
 	if !ok {
 		return nil, ErrStateNotFound
 	}
 
-	m, ok := members[userID]
+	m, ok := members.Load(userID)
 	if ok {
-		return m, nil
+		return m.(*Member), nil
 	}
 
 	return nil, ErrStateNotFound
@@ -418,17 +663,27 @@ func (s *State) GetUser(userID string) (*User, error) {
 	}
 
 	if userID == "@me" {
-		return s.User, nil
+		return s.MyUser(), nil
 	}
 
-	s.RLock()
-	defer s.RUnlock()
+	u, err := s.user(userID)
+	if err != nil || !s.CopyOnRead {
+		return u, err
+	}
 
-	user, ok := s.userMap[userID]
+	s.userMu.Lock()
+	defer s.userMu.Unlock()
+
+	return copyUser(u), nil
+}
+
+// user gets a stored user by ID.
+func (s *State) user(userID string) (*User, error) {
+	user, ok := s.userMap.Load(userID)
 	if !ok {
 		return nil, ErrStateNotFound
 	}
-	return user, nil
+	return user.(*User), nil
 }
 
 // RoleAdd adds a role to the current world state, or
@@ -438,13 +693,18 @@ func (s *State) RoleAdd(guildID string, role *Role) error {
 		return ErrNilState
 	}
 
-	guild, err := s.Guild(guildID)
+	guild, err := s.guild(guildID)
 	if err != nil {
 		return err
 	}
 
-	s.Lock()
-	defer s.Unlock()
+	if s.CopyOnRead {
+		role = copyRole(role, guild)
+	}
+
+	lock := s.shard(guildID)
+	lock.Lock()
+	defer lock.Unlock()
 
 	for i, r := range guild.Roles {
 		if r.ID == role.ID {
@@ -463,13 +723,14 @@ func (s *State) RoleRemove(guildID, roleID string) error {
 		return ErrNilState
 	}
 
-	guild, err := s.Guild(guildID)
+	guild, err := s.guild(guildID)
 	if err != nil {
 		return err
 	}
 
-	s.Lock()
-	defer s.Unlock()
+	lock := s.shard(guildID)
+	lock.Lock()
+	defer lock.Unlock()
 
 	for i, r := range guild.Roles {
 		if r.ID == roleID {
@@ -492,8 +753,9 @@ func (s *State) Role(guildID, roleID string) (*Role, error) {
 		return nil, err
 	}
 
-	s.RLock()
-	defer s.RUnlock()
+	lock := s.shard(guildID)
+	lock.RLock()
+	defer lock.RUnlock()
 
 	for _, r := range guild.Roles {
 		if r.ID == roleID {
@@ -513,34 +775,44 @@ func (s *State) ChannelAdd(channel *Channel) error {
 		return ErrNilState
 	}
 
-	s.Lock()
-	defer s.Unlock()
+	if s.CopyOnRead {
+		channel = copyChannel(channel)
+	}
 
 	// If the channel exists, replace it
-	if c, ok := s.channelMap[channel.ID]; ok {
-		if channel.Messages == nil {
-			channel.Messages = c.Messages
-		}
+	if v, ok := s.channelMap.Load(channel.ID); ok {
+		c := v.(*Channel)
+
+		lock := s.channelShard(c)
+		lock.Lock()
+		defer lock.Unlock()
+
 		if channel.PermissionOverwrites == nil {
 			channel.PermissionOverwrites = c.PermissionOverwrites
 		}
+		channel.Messages = c.Messages
 
 		*c = *channel
 		return nil
 	}
 
 	if channel.Type == ChannelTypeDM || channel.Type == ChannelTypeGroupDM {
+		s.Lock()
 		s.PrivateChannels = append(s.PrivateChannels, channel)
+		s.Unlock()
 	} else {
-		guild, ok := s.guildMap[channel.GuildID]
-		if !ok {
-			return ErrStateNotFound
+		guild, err := s.guild(channel.GuildID)
+		if err != nil {
+			return err
 		}
 
+		lock := s.shard(guild.ID)
+		lock.Lock()
 		guild.Channels = append(guild.Channels, channel)
+		lock.Unlock()
 	}
 
-	s.channelMap[channel.ID] = channel
+	s.storeChannel(channel)
 
 	return nil
 }
@@ -551,7 +823,7 @@ func (s *State) ChannelRemove(channel *Channel) error {
 		return ErrNilState
 	}
 
-	_, err := s.Channel(channel.ID)
+	_, err := s.channel(channel.ID)
 	if err != nil {
 		return err
 	}
@@ -567,13 +839,14 @@ func (s *State) ChannelRemove(channel *Channel) error {
 			}
 		}
 	} else {
-		guild, err := s.Guild(channel.GuildID)
+		guild, err := s.guild(channel.GuildID)
 		if err != nil {
 			return err
 		}
 
-		s.Lock()
-		defer s.Unlock()
+		lock := s.shard(guild.ID)
+		lock.Lock()
+		defer lock.Unlock()
 
 		for i, c := range guild.Channels {
 			if c.ID == channel.ID {
@@ -583,7 +856,8 @@ func (s *State) ChannelRemove(channel *Channel) error {
 		}
 	}
 
-	delete(s.channelMap, channel.ID)
+	s.deleteChannel(channel.ID)
+	s.Messages.removeChannel(channel.ID)
 
 	return nil
 }
@@ -606,11 +880,27 @@ func (s *State) Channel(channelID string) (*Channel, error) {
 		return nil, ErrNilState
 	}
 
-	s.RLock()
-	defer s.RUnlock()
+	c, err := s.channel(channelID)
+	if err != nil || !s.CopyOnRead {
+		return c, err
+	}
 
-	if c, ok := s.channelMap[channelID]; ok {
-		return c, nil
+	// The channel itself can not be read for its guild ID without the lock.
+	id, ok := s.shardIDMap.Load(channelID)
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+
+	s.viewCopy(id.(string), func() {
+		c = copyChannel(c)
+	})
+	return c, nil
+}
+
+// channel gets a stored channel by ID.
+func (s *State) channel(channelID string) (*Channel, error) {
+	if c, ok := s.channelMap.Load(channelID); ok {
+		return c.(*Channel), nil
 	}
 
 	return nil, ErrStateNotFound
@@ -627,8 +917,9 @@ func (s *State) Emoji(guildID, emojiID string) (*Emoji, error) {
 		return nil, err
 	}
 
-	s.RLock()
-	defer s.RUnlock()
+	lock := s.shard(guildID)
+	lock.RLock()
+	defer lock.RUnlock()
 
 	for _, e := range guild.Emojis {
 		if e.ID == emojiID {
@@ -645,13 +936,18 @@ func (s *State) EmojiAdd(guildID string, emoji *Emoji) error {
 		return ErrNilState
 	}
 
-	guild, err := s.Guild(guildID)
+	guild, err := s.guild(guildID)
 	if err != nil {
 		return err
 	}
 
-	s.Lock()
-	defer s.Unlock()
+	if s.CopyOnRead {
+		emoji = copyEmoji(emoji, guild)
+	}
+
+	lock := s.shard(guildID)
+	lock.Lock()
+	defer lock.Unlock()
 
 	for i, e := range guild.Emojis {
 		if e.ID == emoji.ID {
@@ -682,49 +978,188 @@ func (s *State) MessageAdd(message *Message, se *Session) error {
 		return ErrNilState
 	}
 
-	c, err := s.Channel(message.ChannelID)
-	if err != nil {
+	if _, err := s.channel(message.ChannelID); err != nil {
 		return err
 	}
 
-	s.Lock()
-	defer s.Unlock()
+	s.Messages.add(message, s.MaxMessageCount)
+	s.syncChannelMessages()
+	return nil
+}
 
-	// If the message exists, merge in the new message contents.
-	for _, m := range c.Messages {
-		if m.ID == message.ID {
-			if message.Content != "" {
-				m.Content = message.Content
-			}
-			if message.EditedTimestamp != "" {
-				m.EditedTimestamp = message.EditedTimestamp
-			}
-			if message.Mentions != nil {
-				m.Mentions = message.Mentions
-			}
-			if message.Embeds != nil {
-				m.Embeds = message.Embeds
-			}
-			if message.Attachments != nil {
-				m.Attachments = message.Attachments
+// syncChannelMessages applies the changes of the message cache to the
+// Messages of the channels.
+func (s *State) syncChannelMessages() {
+	s.messagesMu.Lock()
+	defer s.messagesMu.Unlock()
+
+	for _, change := range s.Messages.takeChanges() {
+		c, err := s.channel(change.channelID)
+		if err != nil {
+			continue
+		}
+
+		lock := s.channelShard(c)
+		lock.Lock()
+		c.Messages = applyMessageChange(c.Messages, change)
+		lock.Unlock()
+	}
+}
+
+// applyMessageChange applies a change of the message cache to the messages
+// of its channel.
+func applyMessageChange(messages []*Message, change messageChange) []*Message {
+	if change.old == nil {
+		return append(messages, change.new)
+	}
+
+	// Changes are mostly to the newest messages, and evictions to the oldest.
+	i := -1
+	if len(messages) > 0 && messages[0] == change.old {
+		i = 0
+	} else {
+		for j := len(messages) - 1; j >= 0; j-- {
+			if messages[j] == change.old {
+				i = j
+				break
 			}
-			if message.Timestamp != "" {
-				m.Timestamp = message.Timestamp
+		}
+	}
+
+	switch {
+	case i < 0:
+		return messages
+	case change.new != nil:
+		messages[i] = change.new
+		return messages
+	case i == 0:
+		return messages[1:]
+	default:
+		return append(messages[:i], messages[i+1:]...)
+	}
+}
+
+// mergeMessage applies a message update to a stored message.
+func mergeMessage(m, message *Message) {
+	if message.Content != "" {
+		m.Content = message.Content
+	}
+	if message.EditedTimestamp != "" {
+		m.EditedTimestamp = message.EditedTimestamp
+	}
+	if message.Mentions != nil {
+		m.Mentions = message.Mentions
+	}
+	if message.Embeds != nil {
+		m.Embeds = message.Embeds
+	}
+	if message.Attachments != nil {
+		m.Attachments = message.Attachments
+	}
+	if message.Timestamp != "" {
+		m.Timestamp = message.Timestamp
+	}
+	if message.Author != nil {
+		m.Author = message.Author
+	}
+}
+
+// reactionChange is the change a reaction event makes to a message.
+type reactionChange int
+
+const (
+	reactionAdd reactionChange = iota
+	reactionRemove
+	reactionRemoveAll
+	reactionRemoveEmoji
+)
+
+// reactionKey returns the key reactions with an emoji are grouped by.
+func reactionKey(e *Emoji) string {
+	if e == nil {
+		return ""
+	}
+	if e.ID != "" {
+		return e.ID
+	}
+	return e.Name
+}
+
+// applyReaction returns the reactions of a message after a reaction event.
+// The given reactions are left untouched, so they can be kept as they were.
+// myID : The ID of the bot user, whose reactions set Me.
+func applyReaction(reactions []*MessageReactions, r *MessageReaction, change reactionChange, myID string) []*MessageReactions {
+	if change == reactionRemoveAll {
+		return nil
+	}
+
+	key := reactionKey(r.Emoji)
+	updated := make([]*MessageReactions, 0, len(reactions)+1)
+	found := false
+
+	for _, mr := range reactions {
+		if reactionKey(mr.Emoji) != key {
+			updated = append(updated, mr)
+			continue
+		}
+		found = true
+
+		mc := *mr
+		switch change {
+		case reactionAdd:
+			mc.Count++
+			if r.UserID == myID {
+				mc.Me = true
 			}
-			if message.Author != nil {
-				m.Author = message.Author
+		case reactionRemove:
+			mc.Count--
+			if r.UserID == myID {
+				mc.Me = false
 			}
+		case reactionRemoveEmoji:
+			mc.Count = 0
+		}
 
-			return nil
+		if mc.Count > 0 {
+			updated = append(updated, &mc)
 		}
 	}
 
-	c.Messages = append(c.Messages, message)
+	if !found && change == reactionAdd {
+		updated = append(updated, &MessageReactions{
+			Count: 1,
+			Me:    r.UserID == myID,
+			Emoji: r.Emoji,
+		})
+	}
+
+	return updated
+}
+
+// reactionUpdate applies a reaction event to a cached message, and returns
+// its reactions from before the event.
+func (s *State) reactionUpdate(r *MessageReaction, change reactionChange) ([]*MessageReactions, error) {
+	myID, _ := s.myID.Load().(string)
+	old, err := s.Messages.react(r, change, myID)
+	s.syncChannelMessages()
+	return old, err
+}
+
+// MessageReactionUsers returns the IDs of the users who reacted to a message
+// with an emoji. Set Messages.TrackReactionUsers to keep them.
+// channelID : The ID of a Channel.
+// messageID : The ID of a Message.
+// emojiID   : The ID of a custom emoji, or the unicode emoji itself.
+func (s *State) MessageReactionUsers(channelID, messageID, emojiID string) ([]string, error) {
+	if s == nil {
+		return nil, ErrNilState
+	}
 
-	if len(c.Messages) > s.MaxMessageCount {
-		c.Messages = c.Messages[len(c.Messages)-s.MaxMessageCount:]
+	if _, err := s.Message(channelID, messageID); err != nil {
+		return nil, err
 	}
-	return nil
+
+	return s.Messages.ReactionUsers(messageID, emojiID)
 }
 
 // MessageRemove removes a message from the world state.
@@ -738,44 +1173,44 @@ func (s *State) MessageRemove(message *Message) error {
 
 // messageRemoveByID removes a message by channelID and messageID from the world state.
 func (s *State) messageRemoveByID(channelID, messageID string) error {
-	c, err := s.Channel(channelID)
-	if err != nil {
-		return err
-	}
-
-	s.Lock()
-	defer s.Unlock()
-
-	for i, m := range c.Messages {
-		if m.ID == messageID {
-			c.Messages = append(c.Messages[:i], c.Messages[i+1:]...)
-			return nil
-		}
-	}
-
-	return ErrStateNotFound
+	_, err := s.Messages.remove(channelID, messageID)
+	s.syncChannelMessages()
+	return err
 }
 
 func (s *State) voiceStateUpdate(update *VoiceStateUpdate) error {
-	guild, err := s.Guild(update.GuildID)
+	guild, err := s.guild(update.GuildID)
 	if err != nil {
 		return err
 	}
 
-	s.Lock()
-	defer s.Unlock()
+	lock := s.shard(update.GuildID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	index := s.index(update.GuildID)
 
 	// Handle Leaving Channel
 	if update.ChannelID == "" {
 		for i, state := range guild.VoiceStates {
 			if state.UserID == update.UserID {
 				guild.VoiceStates = append(guild.VoiceStates[:i], guild.VoiceStates[i+1:]...)
+				if index != nil {
+					index.removeVoiceState(state)
+				}
 				return nil
 			}
 		}
 	} else {
+		if index != nil {
+			index.addVoiceState(update.VoiceState)
+		}
+
 		for i, state := range guild.VoiceStates {
 			if state.UserID == update.UserID {
+				if index != nil && state.ChannelID != update.ChannelID {
+					index.removeVoiceState(state)
+				}
 				guild.VoiceStates[i] = update.VoiceState
 				return nil
 			}
@@ -787,27 +1222,62 @@ func (s *State) voiceStateUpdate(update *VoiceStateUpdate) error {
 	return nil
 }
 
+// voiceState gets the voice state of a user in a guild.
+func (s *State) voiceState(guildID, userID string) (*VoiceState, error) {
+	guild, err := s.guild(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := s.shard(guildID)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	return guild.GetVoiceState(userID)
+}
+
 // Message gets a message by channel and message ID.
 func (s *State) Message(channelID, messageID string) (*Message, error) {
 	if s == nil {
 		return nil, ErrNilState
 	}
 
-	c, err := s.Channel(channelID)
+	m, err := s.Messages.Message(messageID)
+	if err != nil || m.ChannelID != channelID {
+		return nil, ErrStateNotFound
+	}
+
+	return m, nil
+}
+
+// MessageRevisions returns the earlier versions of a message, oldest first.
+// Set Messages.MaxRevisions to keep them.
+// channelID : The ID of a Channel.
+// messageID : The ID of a Message.
+func (s *State) MessageRevisions(channelID, messageID string) ([]*MessageRevision, error) {
+	if s == nil {
+		return nil, ErrNilState
+	}
+
+	m, err := s.Messages.Message(messageID)
 	if err != nil {
-		return nil, err
+		m, err = s.Messages.Deleted(messageID)
+	}
+	if err != nil || m.ChannelID != channelID {
+		return nil, ErrStateNotFound
 	}
 
-	s.RLock()
-	defer s.RUnlock()
+	return s.Messages.Revisions(messageID)
+}
 
-	for _, m := range c.Messages {
-		if m.ID == messageID {
-			return m, nil
-		}
+// ChannelMessages returns the cached messages of a channel, oldest first.
+// channelID : The ID of a Channel.
+func (s *State) ChannelMessages(channelID string) []*Message {
+	if s == nil {
+		return nil
 	}
 
-	return nil, ErrStateNotFound
+	return s.Messages.ChannelMessages(channelID)
 }
 
 // OnReady takes a Ready event and updates all internal state.
@@ -816,6 +1286,10 @@ func (s *State) onReady(se *Session, r *Ready) (err error) {
 		return ErrNilState
 	}
 
+	if s.CopyOnRead {
+		r = copyReady(r)
+	}
+
 	s.Lock()
 	defer s.Unlock()
 
@@ -829,23 +1303,58 @@ func (s *State) onReady(se *Session, r *Ready) (err error) {
 		}
 
 		s.Ready = ready
+		s.setMyID(r.User)
 
 		return nil
 	}
 
-	s.Ready = *r
+	// Guilds already in the state, e.g. loaded from a snapshot, are kept
+	// until their GUILD_CREATE is received, rather than being replaced by
+	// the unavailable guilds sent in the READY.
+	guilds := make([]*Guild, 0, len(r.Guilds))
+	ready := make(map[string]bool, len(r.Guilds))
+	for _, g := range r.Guilds {
+		ready[g.ID] = true
 
-	for _, g := range s.Guilds {
-		s.guildMap[g.ID] = g
+		if v, ok := s.guildMap.Load(g.ID); ok {
+			if g.Unavailable {
+				guilds = append(guilds, v.(*Guild))
+				continue
+			}
+			s.reconcileGuild(v.(*Guild), g)
+		}
+
+		s.guildMap.Store(g.ID, g)
 		s.createMemberMap(g)
 
+		lock := s.shard(g.ID)
+		lock.Lock()
+		s.resetMemberLRU(g, time.Now())
+		s.indexGuild(g)
+		lock.Unlock()
+
 		for _, c := range g.Channels {
-			s.channelMap[c.ID] = c
+			s.storeChannel(c)
+		}
+		guilds = append(guilds, g)
+	}
+
+	// Guilds the bot is no longer in are dropped.
+	for _, g := range s.Guilds {
+		if !ready[g.ID] {
+			lock := s.shard(g.ID)
+			lock.Lock()
+			s.forgetGuild(g)
+			lock.Unlock()
 		}
 	}
 
+	s.Ready = *r
+	s.Guilds = guilds
+	s.setMyID(r.User)
+
 	for _, c := range s.PrivateChannels {
-		s.channelMap[c.ID] = c
+		s.storeChannel(c)
 	}
 
 	return nil
@@ -857,6 +1366,123 @@ func (s *State) OnInterface(se *Session, i interface{}) (err error) {
 		return ErrNilState
 	}
 
+	s.sweepMembers()
+
+	return onStateEvent(s, se, i)
+}
+
+// stateOptions decide what a state cache keeps of the events it handles.
+type stateOptions struct {
+	MaxMessageCount int
+	TrackChannels   bool
+	TrackEmojis     bool
+	TrackMembers    bool
+	TrackRoles      bool
+	TrackVoice      bool
+	TrackPresences  bool
+}
+
+func (s *State) options() stateOptions {
+	return stateOptions{
+		MaxMessageCount: s.MaxMessageCount,
+		TrackChannels:   s.TrackChannels,
+		TrackEmojis:     s.TrackEmojis,
+		TrackMembers:    s.TrackMembers,
+		TrackRoles:      s.TrackRoles,
+		TrackVoice:      s.TrackVoice,
+		TrackPresences:  s.TrackPresences,
+	}
+}
+
+// guildIDs returns the IDs of the guilds in the state.
+func (s *State) guildIDs() ([]string, error) {
+	var ids []string
+	s.guildMap.Range(func(k, _ interface{}) bool {
+		ids = append(ids, k.(string))
+		return true
+	})
+	return ids, nil
+}
+
+// view calls f with the lock of a guild, or of a private channel when given
+// its channel ID, held for reading.
+func (s *State) view(id string, f func()) {
+	lock := s.shard(id)
+	lock.RLock()
+	f()
+	lock.RUnlock()
+}
+
+// memberCountAdd adds delta to the member count of a guild.
+func (s *State) memberCountAdd(guildID string, delta int) error {
+	guild, err := s.guild(guildID)
+	if err != nil {
+		return err
+	}
+
+	lock := s.shard(guild.ID)
+	lock.Lock()
+	guild.MemberCount += delta
+	lock.Unlock()
+
+	return nil
+}
+
+// userUpdate replaces a cached user, keeping the guilds it is known in,
+// and returns a copy of the user from before the update.
+func (s *State) userUpdate(user *User) (*User, error) {
+	old, err := s.user(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.userMu.Lock()
+	defer s.userMu.Unlock()
+
+	oldCopy := *old
+	guilds := old.guilds
+	*old = *user
+	old.guilds = guilds
+
+	return &oldCopy, nil
+}
+
+// stateBackend is a state cache whose events are merged by onStateEvent,
+// the caches only differ in how they store the merged entities.
+type stateBackend interface {
+	StateCache
+
+	options() stateOptions
+	onReady(se *Session, r *Ready) error
+	guildIDs() ([]string, error)
+
+	// view calls f while the data of a guild, or of a private channel
+	// when given its channel ID, is safe to copy.
+	view(id string, f func())
+
+	// guildSummary gets a guild with its roles and emojis, but not
+	// necessarily its members, presences, voice states and channels.
+	guildSummary(guildID string) (*Guild, error)
+
+	memberCountAdd(guildID string, delta int) error
+	voiceState(guildID, userID string) (*VoiceState, error)
+	voiceStateUpdate(update *VoiceStateUpdate) error
+	messageRemoveByID(channelID, messageID string) error
+	reactionUpdate(r *MessageReaction, change reactionChange) ([]*MessageReactions, error)
+	userUpdate(user *User) (*User, error)
+}
+
+// channelShardID returns the ID a channel's data is guarded under.
+func channelShardID(c *Channel) string {
+	if c.GuildID != "" {
+		return c.GuildID
+	}
+	return c.ID
+}
+
+// onStateEvent merges an event into a state cache, and fills in the
+// BeforeUpdate copies of update events.
+func onStateEvent(s stateBackend, se *Session, i interface{}) (err error) {
 	r, ok := i.(*Ready)
 	if ok {
 		return s.onReady(se, r)
@@ -866,14 +1492,18 @@ func (s *State) OnInterface(se *Session, i interface{}) (err error) {
 		return nil
 	}
 
+	opts := s.options()
+
 	switch t := i.(type) {
 	case *GuildCreate:
 		err = s.GuildAdd(t.Guild, se)
 	case *GuildUpdate:
-		oldGuild, err := s.Guild(t.ID)
+		oldGuild, err := s.guildSummary(t.ID)
 		if err == nil {
-			oldCopy := *oldGuild
-			t.BeforeUpdate = &oldCopy
+			s.view(t.ID, func() {
+				oldCopy := *oldGuild
+				t.BeforeUpdate = &oldCopy
+			})
 		}
 
 		err = s.GuildAdd(t.Guild, se)
@@ -881,42 +1511,40 @@ func (s *State) OnInterface(se *Session, i interface{}) (err error) {
 		err = s.GuildRemove(t.Guild)
 	case *GuildMemberAdd:
 		// Updates the MemberCount of the guild.
-		guild, err := s.Guild(t.Member.GuildID)
-		if err != nil {
+		if err := s.memberCountAdd(t.Member.GuildID, 1); err != nil {
 			return err
 		}
-		guild.MemberCount++
 
 		// Caches member if tracking is enabled.
-		if s.TrackMembers {
+		if opts.TrackMembers {
 			err = s.MemberAdd(t.Member, se)
 		}
 	case *GuildMemberUpdate:
-		if s.TrackMembers {
+		if opts.TrackMembers {
 			oldMember, err := s.Member(t.GuildID, t.GetID())
 			if err == nil {
-				oldCopy := *oldMember
-				t.BeforeUpdate = &oldCopy
+				s.view(t.GuildID, func() {
+					oldCopy := *oldMember
+					t.BeforeUpdate = &oldCopy
+				})
 			}
 
 			err = s.MemberAdd(t.Member, se)
 		}
 	case *GuildMemberRemove:
 		// Updates the MemberCount of the guild.
-		guild, err := s.Guild(t.Member.GuildID)
-		if err != nil {
+		if err := s.memberCountAdd(t.Member.GuildID, -1); err != nil {
 			return err
 		}
-		guild.MemberCount--
 
 		// Removes member from the cache if tracking is enabled.
-		if s.TrackMembers {
+		if opts.TrackMembers {
 			err = s.MemberRemove(t.Member)
 		}
 
 		t.Member.User.Session = se
 	case *GuildMembersChunk:
-		if s.TrackMembers {
+		if opts.TrackMembers {
 			for i := range t.Members {
 				t.Members[i].GuildID = t.GuildID
 				err = s.MemberAdd(t.Members[i], se)
@@ -924,66 +1552,72 @@ func (s *State) OnInterface(se *Session, i interface{}) (err error) {
 		}
 	case *GuildRoleCreate:
 		t.Role.Session = se
-		g, _ := se.State.Guild(t.GuildID)
+		g, _ := s.guildSummary(t.GuildID)
 		t.Role.Guild = g
 
-		if s.TrackRoles {
+		if opts.TrackRoles {
 			err = s.RoleAdd(t.GuildID, t.Role)
 		}
 	case *GuildRoleUpdate:
 		t.Role.Session = se
-		g, _ := se.State.Guild(t.GuildID)
+		g, _ := s.guildSummary(t.GuildID)
 		t.Role.Guild = g
 
-		if s.TrackRoles {
-			oldRole, err := g.GetRole(t.Role.ID)
-			if err == nil {
-				oldCopy := *oldRole
-				t.BeforeUpdate = &oldCopy
-			}
+		if opts.TrackRoles && g != nil {
+			s.view(g.ID, func() {
+				oldRole, err := g.GetRole(t.Role.ID)
+				if err == nil {
+					oldCopy := *oldRole
+					t.BeforeUpdate = &oldCopy
+				}
+			})
 
 			err = s.RoleAdd(t.GuildID, t.Role)
 		}
 	case *GuildRoleDelete:
-		if s.TrackRoles {
-			g, err := s.Guild(t.GuildID)
+		if opts.TrackRoles {
+			g, err := s.guildSummary(t.GuildID)
 			if err == nil {
-				r, err := g.GetRole(t.RoleID)
-				if err == nil {
-					t.Role = r
-				}
+				s.view(g.ID, func() {
+					r, err := g.GetRole(t.RoleID)
+					if err == nil {
+						t.Role = r
+					}
+				})
 			}
 
 			err = s.RoleRemove(t.GuildID, t.RoleID)
 		}
 	case *GuildEmojisUpdate:
-		g, _ := se.State.Guild(t.GuildID)
+		g, _ := s.guildSummary(t.GuildID)
 		for _, e := range t.Emojis {
 			e.Session = se
 			e.Guild = g
 		}
-		if s.TrackEmojis {
+		if opts.TrackEmojis {
 			err = s.EmojisAdd(t.GuildID, t.Emojis)
 		}
 	case *ChannelCreate:
 		t.Channel.Session = se
-		if s.TrackChannels {
+		if opts.TrackChannels {
 			err = s.ChannelAdd(t.Channel)
 		}
 	case *ChannelUpdate:
 		t.Channel.Session = se
-		if s.TrackChannels {
+		if opts.TrackChannels {
 			oldChannel, err := s.Channel(t.ID)
 			if err == nil {
-				oldCopy := *oldChannel
-				t.BeforeUpdate = &oldCopy
+				s.view(channelShardID(oldChannel), func() {
+					oldCopy := *oldChannel
+					t.BeforeUpdate = &oldCopy
+				})
 			}
 
 			err = s.ChannelAdd(t.Channel)
 		}
 	case *ChannelDelete:
 		t.Channel.Session = se
-		if s.TrackChannels {
+		if opts.TrackChannels {
 			err = s.ChannelRemove(t.Channel)
 		}
 	case *MessageCreate:
@@ -999,7 +1633,7 @@ func (s *State) OnInterface(se *Session, i interface{}) (err error) {
 			u.Session = se
 		}
 
-		if s.MaxMessageCount != 0 {
+		if opts.MaxMessageCount != 0 {
 			err = s.MessageAdd(t.Message, se)
 		}
 	case *MessageUpdate:
@@ -1015,54 +1649,67 @@ func (s *State) OnInterface(se *Session, i interface{}) (err error) {
 			u.Session = se
 		}
 
-		if s.MaxMessageCount != 0 {
+		if opts.MaxMessageCount != 0 {
 			var old *Message
+			var c *Channel
 			old, err = s.Message(t.ChannelID, t.ID)
 			if err == nil {
-				oldCopy := *old
-				t.BeforeUpdate = &oldCopy
+				c, err = s.Channel(t.ChannelID)
+			}
+			if err == nil {
+				s.view(channelShardID(c), func() {
+					oldCopy := *old
+					t.BeforeUpdate = &oldCopy
+				})
 			}
 
 			err = s.MessageAdd(t.Message, se)
 		}
 	case *MessageDelete:
-		if s.MaxMessageCount != 0 {
+		if opts.MaxMessageCount != 0 {
+			if old, oerr := s.Message(t.ChannelID, t.ID); oerr == nil {
+				t.BeforeDelete = old
+			}
+
 			err = s.MessageRemove(t.Message)
 		}
 		t.Session = se
 	case *MessageDeleteBulk:
-		if s.MaxMessageCount != 0 {
+		if opts.MaxMessageCount != 0 {
 			for _, mID := range t.Messages {
+				old, err := s.Message(t.ChannelID, mID)
+				if err == nil {
+					t.BeforeDelete = append(t.BeforeDelete, old)
+				}
+
 				_ = s.messageRemoveByID(t.ChannelID, mID)
 			}
 		}
 	case *VoiceStateUpdate:
-		if s.TrackVoice {
-			g, err := s.Guild(t.GuildID)
+		if opts.TrackVoice {
+			oldState, err := s.voiceState(t.GuildID, t.UserID)
 			if err == nil {
-				oldState, err := g.GetVoiceState(t.UserID)
-				if err == nil {
+				s.view(t.GuildID, func() {
 					oldCopy := *oldState
 					t.BeforeUpdate = &oldCopy
-				}
+				})
 			}
 
 			err = s.voiceStateUpdate(t)
 		}
 	case *PresenceUpdate:
-		if s.TrackPresences {
-			g, err := s.Guild(t.GuildID)
+		if opts.TrackPresences {
+			oldPresence, err := s.Presence(t.GuildID, t.User.ID)
 			if err == nil {
-				oldPresence, err := g.GetPresence(t.User.ID)
-				if err == nil {
+				s.view(t.GuildID, func() {
 					oldCopy := *oldPresence
 					t.BeforeUpdate = &oldCopy
-				}
-
-				_ = s.PresenceAdd(g.ID, &t.Presence)
+				})
 			}
+
+			_ = s.PresenceAdd(t.GuildID, &t.Presence)
 		}
-		if s.TrackMembers {
+		if opts.TrackMembers {
 			if t.Status == StatusOffline {
 				return
 			}
@@ -1080,6 +1727,16 @@ func (s *State) OnInterface(se *Session, i interface{}) (err error) {
 				}
 
 			} else {
+				// The update is applied to a copy, MemberAdd then
+				// replaces the stored member under the guild lock.
+				var mc Member
+				var uc User
+				s.view(t.GuildID, func() {
+					mc = *m
+					uc = *m.User
+				})
+				m = &mc
+				m.User = &uc
 
 				if t.Nick != "" {
 					m.Nick = t.Nick
@@ -1101,13 +1758,29 @@ func (s *State) OnInterface(se *Session, i interface{}) (err error) {
 
 	case *MessageReactionAdd:
 		t.Session = se
+		if opts.MaxMessageCount != 0 {
+			t.BeforeUpdate, _ = s.reactionUpdate(t.MessageReaction, reactionAdd)
+		}
+	case *MessageReactionRemove:
+		t.Session = se
+		if opts.MaxMessageCount != 0 {
+			t.BeforeUpdate, _ = s.reactionUpdate(t.MessageReaction, reactionRemove)
+		}
+	case *MessageReactionRemoveAll:
+		t.Session = se
+		if opts.MaxMessageCount != 0 {
+			t.BeforeUpdate, _ = s.reactionUpdate(t.MessageReaction, reactionRemoveAll)
+		}
+	case *MessageReactionRemoveEmoji:
+		t.Session = se
+		if opts.MaxMessageCount != 0 {
+			t.BeforeUpdate, _ = s.reactionUpdate(t.MessageReaction, reactionRemoveEmoji)
+		}
 	case *UserUpdate:
 		t.Session = se
-		oldUser, err := s.GetUser(t.ID)
+		oldUser, err := s.userUpdate(t.User)
 		if err == nil {
-			oldCopy := *oldUser
-			t.BeforeUpdate = &oldCopy
-			*oldUser = *t.User
+			t.BeforeUpdate = oldUser
 		}
 	}
 
@@ -1124,12 +1797,17 @@ func (s *State) UserColor(userID, channelID string) Color {
 		return 0
 	}
 
+	return userColor(s, userID, channelID)
+}
+
+// userColor works out the color of a user in a channel from a state cache.
+func userColor(s stateBackend, userID, channelID string) Color {
 	channel, err := s.Channel(channelID)
 	if err != nil {
 		return 0
 	}
 
-	guild, err := s.Guild(channel.GuildID)
+	guild, err := s.guildSummary(channel.GuildID)
 	if err != nil {
 		return 0
 	}
@@ -0,0 +1,233 @@
+package discordgo
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newBenchState returns a state holding the given number of guilds, each with
+// a channel and the given number of members.
+func newBenchState(tb testing.TB, guilds, members int) (*State, *Session) {
+	se := &Session{StateEnabled: true}
+	state := NewState()
+
+	for g := 0; g < guilds; g++ {
+		guildID := strconv.Itoa(g)
+		guild := &Guild{
+			ID:       guildID,
+			Channels: []*Channel{{ID: "c" + guildID, GuildID: guildID}},
+		}
+		for m := 0; m < members; m++ {
+			guild.Members = append(guild.Members, &Member{
+				GuildID: guildID,
+				User:    &User{ID: strconv.Itoa(m)},
+			})
+		}
+
+		if err := state.GuildAdd(guild, se); err != nil {
+			tb.Fatalf("GuildAdd returned error: %+v", err)
+		}
+	}
+
+	return state, se
+}
+
+func TestStateConcurrentGuilds(t *testing.T) {
+	state, se := newBenchState(t, 8, 10)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(guildID string) {
+			defer wg.Done()
+
+			for m := 10; m < 110; m++ {
+				member := &Member{GuildID: guildID, User: &User{ID: strconv.Itoa(m)}}
+				if err := state.MemberAdd(member, se); err != nil {
+					t.Errorf("MemberAdd returned error: %+v", err)
+				}
+				state.PresenceAdd(guildID, &Presence{User: &User{ID: strconv.Itoa(m)}, Status: StatusOnline})
+				state.Member(guildID, strconv.Itoa(m-1))
+				state.Channel("c" + guildID)
+			}
+		}(strconv.Itoa(g))
+	}
+	wg.Wait()
+
+	for g := 0; g < 8; g++ {
+		guild, err := state.Guild(strconv.Itoa(g))
+		if err != nil {
+			t.Fatalf("Guild returned error: %+v", err)
+		}
+		if len(guild.Members) != 110 || len(guild.Presences) != 100 {
+			t.Errorf("guild %d should have 110 members and 100 presences, got %d and %d", g, len(guild.Members), len(guild.Presences))
+		}
+	}
+
+	u, err := state.GetUser("5")
+	if err != nil {
+		t.Fatalf("GetUser returned error: %+v", err)
+	}
+	if len(u.guilds) != 8 {
+		t.Errorf("user should be in 8 guilds, got %d", len(u.guilds))
+	}
+}
+
+// BenchmarkStateReadParallel measures lookups of guilds, channels and members.
+func BenchmarkStateReadParallel(b *testing.B) {
+	state, _ := newBenchState(b, 64, 100)
+
+	var n int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(atomic.AddInt64(&n, 1))
+		for pb.Next() {
+			guildID := strconv.Itoa(i % 64)
+			state.Guild(guildID)
+			state.Channel("c" + guildID)
+			state.Member(guildID, strconv.Itoa(i%100))
+			i++
+		}
+	})
+}
+
+// BenchmarkStateMixedParallel measures lookups while presence and member
+// updates are applied to the same guilds, as on a busy shard.
+func BenchmarkStateMixedParallel(b *testing.B) {
+	state, se := newBenchState(b, 64, 100)
+
+	var n int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(atomic.AddInt64(&n, 1))
+		for pb.Next() {
+			guildID := strconv.Itoa(i % 64)
+			userID := strconv.Itoa(i % 100)
+
+			if i%4 == 0 {
+				state.PresenceAdd(guildID, &Presence{User: &User{ID: userID}, Status: StatusOnline})
+				state.MemberAdd(&Member{GuildID: guildID, User: &User{ID: userID}}, se)
+			} else {
+				state.Channel("c" + guildID)
+				state.Member(guildID, userID)
+			}
+			i++
+		}
+	})
+}
+
+func TestStateMemberCachePolicyRelease(t *testing.T) {
+	se := &Session{StateEnabled: true}
+	state := NewState()
+	state.MemberCachePolicy = &MemberCachePolicy{MaxPerGuild: 1, KeepInVoice: true}
+	state.setMyID(&User{ID: "bot"})
+
+	err := state.GuildAdd(&Guild{
+		ID: "1",
+		Members: []*Member{
+			{GuildID: "1", User: &User{ID: "bot"}},
+			{GuildID: "1", User: &User{ID: "talker"}},
+		},
+		VoiceStates: []*VoiceState{{GuildID: "1", ChannelID: "2", UserID: "talker"}},
+	}, se)
+	if err != nil {
+		t.Fatalf("GuildAdd returned error: %+v", err)
+	}
+	if _, err = state.Member("1", "talker"); err != nil {
+		t.Fatalf("member in voice should be kept, got %+v", err)
+	}
+
+	// Once out of voice, the member is evicted by the next full pass.
+	state.OnInterface(se, &VoiceStateUpdate{VoiceState: &VoiceState{GuildID: "1", UserID: "talker"}})
+	state.EvictMembers()
+	if _, err = state.Member("1", "talker"); err != ErrStateNotFound {
+		t.Errorf("member out of voice should be evicted, got %+v", err)
+	}
+}
+
+func BenchmarkStateMemberAddOverKept(b *testing.B) {
+	se := &Session{StateEnabled: true}
+	state := NewState()
+	state.MemberCachePolicy = &MemberCachePolicy{MaxPerGuild: 100, KeepWithRoles: true}
+
+	// More members with roles than the cap, which are never evicted
+	g := &Guild{ID: "1"}
+	for i := 0; i < 10000; i++ {
+		g.Members = append(g.Members, &Member{GuildID: "1", User: &User{ID: "kept" + strconv.Itoa(i)}, Roles: []string{"10"}})
+	}
+	if err := state.GuildAdd(g, se); err != nil {
+		b.Fatalf("GuildAdd returned error: %+v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		state.MemberAdd(&Member{GuildID: "1", User: &User{ID: strconv.Itoa(i)}}, se)
+	}
+}
+
+func TestStateMemberCachePolicy(t *testing.T) {
+	se := &Session{StateEnabled: true}
+	state := NewState()
+	state.MemberCachePolicy = &MemberCachePolicy{MaxPerGuild: 4, KeepWithRoles: true}
+	state.setMyID(&User{ID: "bot"})
+
+	for _, guildID := range []string{"1", "2"} {
+		err := state.GuildAdd(&Guild{
+			ID:      guildID,
+			OwnerID: "owner",
+			Members: []*Member{
+				{GuildID: guildID, User: &User{ID: "bot"}},
+				{GuildID: guildID, User: &User{ID: "owner"}},
+			},
+		}, se)
+		if err != nil {
+			t.Fatalf("GuildAdd returned error: %+v", err)
+		}
+	}
+
+	state.MemberAdd(&Member{GuildID: "1", User: &User{ID: "shared"}}, se)
+	state.MemberAdd(&Member{GuildID: "2", User: &User{ID: "shared"}}, se)
+	state.MemberAdd(&Member{GuildID: "1", User: &User{ID: "mod"}, Roles: []string{"10"}}, se)
+	state.MemberAdd(&Member{GuildID: "1", User: &User{ID: "new"}}, se)
+
+	// The cap of guild 1 evicts "shared", the least recently seen member
+	// that is not the bot, an owner or a member with roles.
+	g, _ := state.Guild("1")
+	if len(g.Members) != 4 {
+		t.Errorf("guild should have 4 members, got %d", len(g.Members))
+	}
+	if _, err := state.Member("1", "shared"); err != ErrStateNotFound {
+		t.Errorf("member should be evicted, got %+v", err)
+	}
+	for _, id := range []string{"bot", "owner", "mod", "new"} {
+		if _, err := state.Member("1", id); err != nil {
+			t.Errorf("member %s should be kept, got %+v", id, err)
+		}
+	}
+
+	u, err := state.GetUser("shared")
+	if err != nil || len(u.guilds) != 1 || u.guilds[0] != "2" {
+		t.Fatalf("user should still be known in guild 2, got %+v, %+v", u, err)
+	}
+
+	// MaxAge evicts everyone not seen recently, leaving the user in no guild.
+	state.MemberCachePolicy.MaxAge = time.Minute
+	g2, _ := state.Guild("2")
+	lock := state.shard("2")
+	lock.Lock()
+	state.evictMembers(g2, time.Now().Add(time.Hour))
+	lock.Unlock()
+
+	if _, err = state.Member("2", "shared"); err != ErrStateNotFound {
+		t.Errorf("expired member should be evicted, got %+v", err)
+	}
+	if _, err = state.GetUser("shared"); err != ErrStateNotFound {
+		t.Errorf("user in no guild should be dropped, got %+v", err)
+	}
+	if _, err = state.Member("2", "owner"); err != nil {
+		t.Errorf("owner should never be evicted, got %+v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package discordgo
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// CheckGuild compares a guild in the state with the API, along with its
+// channels, roles and emojis and a random sample of its members, and returns
+// the drifted entities. Unlike ResyncGuild it leaves the state as it is.
+// guildID : The ID of a Guild.
+// members : The number of members to compare, each of which takes a request.
+func (s *Session) CheckGuild(guildID string, members int) ([]*StateDrift, error) {
+	if s.State == nil {
+		return nil, ErrNilState
+	}
+
+	cached, err := snapshotGuild(s.State, guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	fetched, err := s.FetchGuild(guildID)
+	if isNotFound(err) {
+		return []*StateDrift{{Type: StateDriftGuild, GuildID: guildID, ID: guildID, Cached: cached}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	channels, err := s.GuildChannels(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	drift := diffGuild(cached, fetched, channels, nil)
+
+	sample := cached.Members
+	if len(sample) > members {
+		sample = make([]*Member, members)
+		for i, j := range rand.Perm(len(cached.Members))[:members] {
+			sample[i] = cached.Members[j]
+		}
+	}
+
+	fetchedMembers := make([]*Member, 0, len(sample))
+	for _, m := range sample {
+		fm, err := s.FetchGuildMember(guildID, m.User.ID)
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		fm.GuildID = guildID
+		fetchedMembers = append(fetchedMembers, fm)
+	}
+
+	return append(drift, diffMembers(guildID, sample, fetchedMembers)...), nil
+}
+
+// A StateChecker regularly compares a random guild in the state with the API,
+// to find out whether the state drifted from it because events were missed.
+// A GuildStateDrift event is sent for every guild found to have drifted.
+//
+// Checks take a few requests each, see Session.CheckGuild, so keep the
+// interval long enough to not use up the rate limits of the guild routes.
+type StateChecker struct {
+	sync.Mutex
+
+	// Interval is the time between two checks.
+	Interval time.Duration
+
+	// Members is the number of members compared per check.
+	Members int
+
+	// Resync resyncs the guilds found to have drifted with Session.ResyncGuild.
+	Resync bool
+
+	stop chan struct{}
+}
+
+// NewStateChecker creates a StateChecker checking a guild every interval.
+func NewStateChecker(interval time.Duration) *StateChecker {
+	return &StateChecker{
+		Interval: interval,
+		Members:  5,
+	}
+}
+
+// Start starts checking the state of a session in the background, until
+// Stop is called.
+func (c *StateChecker) Start(s *Session) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.stop != nil {
+		return
+	}
+
+	c.stop = make(chan struct{})
+	go c.run(s, c.stop)
+}
+
+// Stop stops the checks started by Start.
+func (c *StateChecker) Stop() {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
+
+func (c *StateChecker) run(s *Session, stop chan struct{}) {
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		if guildID, ok := randomGuildID(s.State); ok {
+			c.check(s, guildID)
+		}
+	}
+}
+
+// check checks a guild, and reports and resyncs it if it drifted.
+func (c *StateChecker) check(s *Session, guildID string) {
+	drift, err := s.CheckGuild(guildID, c.Members)
+	if err != nil {
+		s.log(LogWarning, "error checking the state of guild %s, %s", guildID, err)
+		return
+	}
+
+	if len(drift) == 0 {
+		return
+	}
+
+	s.handleEvent(guildStateDriftEventType, &GuildStateDrift{GuildID: guildID, Drift: drift})
+
+	if c.Resync {
+		if _, err = s.ResyncGuild(guildID); err != nil {
+			s.log(LogWarning, "error resyncing guild %s, %s", guildID, err)
+		}
+	}
+}
+
+// randomGuildID returns the ID of a random guild of a state cache.
+func randomGuildID(st StateCache) (string, bool) {
+	b, ok := st.(stateBackend)
+	if !ok {
+		return "", false
+	}
+
+	ids, err := b.guildIDs()
+	if err != nil || len(ids) == 0 {
+		return "", false
+	}
+
+	return ids[rand.Intn(len(ids))], true
+}
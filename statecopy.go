@@ -0,0 +1,184 @@
+package discordgo
+
+// The copy functions below return deep copies of state entities, for a State
+// with CopyOnRead set. Copying an entity held by the state needs the shard
+// lock guarding it, and the userMu of the state for the users of members,
+// which can be shared between guilds.
+// Copies never link back to the state: the guild of a copied role or emoji
+// is the copied guild, and copied members and channels look up their guild
+// again when asked for it.
+
+func copyUser(u *User) *User {
+	if u == nil {
+		return nil
+	}
+
+	uc := *u
+	uc.guilds = append([]string(nil), u.guilds...)
+	return &uc
+}
+
+func copyMember(m *Member) *Member {
+	mc := *m
+	mc.User = copyUser(m.User)
+	mc.Roles = append([]string(nil), m.Roles...)
+	mc.guild = nil
+	return &mc
+}
+
+func copyChannel(c *Channel) *Channel {
+	cc := *c
+	cc.guild = nil
+
+	if c.Recipients != nil {
+		cc.Recipients = make([]*User, len(c.Recipients))
+		for i, u := range c.Recipients {
+			cc.Recipients[i] = copyUser(u)
+		}
+	}
+
+	if c.PermissionOverwrites != nil {
+		cc.PermissionOverwrites = make([]*PermissionOverwrite, len(c.PermissionOverwrites))
+		for i, o := range c.PermissionOverwrites {
+			oc := *o
+			cc.PermissionOverwrites[i] = &oc
+		}
+	}
+
+	// Cached messages are never changed, so they are shared.
+	if c.Messages != nil {
+		cc.Messages = append([]*Message(nil), c.Messages...)
+	}
+
+	return &cc
+}
+
+func copyRole(r *Role, g *Guild) *Role {
+	rc := *r
+	rc.Guild = g
+	return &rc
+}
+
+func copyEmoji(e *Emoji, g *Guild) *Emoji {
+	ec := *e
+	ec.Roles = append([]string(nil), e.Roles...)
+	ec.Guild = g
+	return &ec
+}
+
+func copyPresence(p *Presence) *Presence {
+	pc := *p
+	pc.User = copyUser(p.User)
+	pc.Roles = append([]string(nil), p.Roles...)
+
+	if p.Game != nil {
+		game := *p.Game
+		pc.Game = &game
+	}
+
+	if p.Activities != nil {
+		pc.Activities = make([]*Activity, len(p.Activities))
+		for i, a := range p.Activities {
+			ac := *a
+			pc.Activities[i] = &ac
+		}
+	}
+
+	return &pc
+}
+
+func copyVoiceState(v *VoiceState) *VoiceState {
+	vc := *v
+	return &vc
+}
+
+func copyGuild(g *Guild) *Guild {
+	gc := *g
+	gc.Features = append([]string(nil), g.Features...)
+
+	if g.Roles != nil {
+		gc.Roles = make([]*Role, len(g.Roles))
+		for i, r := range g.Roles {
+			gc.Roles[i] = copyRole(r, &gc)
+		}
+	}
+
+	if g.Emojis != nil {
+		gc.Emojis = make([]*Emoji, len(g.Emojis))
+		for i, e := range g.Emojis {
+			gc.Emojis[i] = copyEmoji(e, &gc)
+		}
+	}
+
+	if g.Members != nil {
+		gc.Members = make([]*Member, len(g.Members))
+		for i, m := range g.Members {
+			gc.Members[i] = copyMember(m)
+		}
+	}
+
+	if g.Presences != nil {
+		gc.Presences = make([]*Presence, len(g.Presences))
+		for i, p := range g.Presences {
+			gc.Presences[i] = copyPresence(p)
+		}
+	}
+
+	if g.Channels != nil {
+		gc.Channels = make([]*Channel, len(g.Channels))
+		for i, c := range g.Channels {
+			gc.Channels[i] = copyChannel(c)
+		}
+	}
+
+	if g.VoiceStates != nil {
+		gc.VoiceStates = make([]*VoiceState, len(g.VoiceStates))
+		for i, v := range g.VoiceStates {
+			gc.VoiceStates[i] = copyVoiceState(v)
+		}
+	}
+
+	return &gc
+}
+
+func copyReady(r *Ready) *Ready {
+	rc := *r
+	rc.User = copyUser(r.User)
+
+	rc.Guilds = make([]*Guild, len(r.Guilds))
+	for i, g := range r.Guilds {
+		rc.Guilds[i] = copyGuild(g)
+	}
+
+	rc.PrivateChannels = make([]*Channel, len(r.PrivateChannels))
+	for i, c := range r.PrivateChannels {
+		rc.PrivateChannels[i] = copyChannel(c)
+	}
+
+	return &rc
+}
+
+// copyMembers replaces members of a guild with copies if CopyOnRead is set.
+// The shard lock of the guild must be held.
+func (s *State) copyMembers(members []*Member) {
+	if !s.CopyOnRead {
+		return
+	}
+
+	s.userMu.Lock()
+	for i, m := range members {
+		members[i] = copyMember(m)
+	}
+	s.userMu.Unlock()
+}
+
+// viewCopy calls f with the shard lock of id held for reading and the
+// userMu of the state held, so that f can copy the data guarded by them.
+func (s *State) viewCopy(id string, f func()) {
+	lock := s.shard(id)
+	lock.RLock()
+	s.userMu.Lock()
+	f()
+	s.userMu.Unlock()
+	lock.RUnlock()
+}
@@ -0,0 +1,299 @@
+package discordgo
+
+import (
+	"sort"
+	"strings"
+)
+
+// guildIndex holds the secondary indexes of a guild, it is guarded by the
+// shard lock of the guild.
+type guildIndex struct {
+	// role ID -> user ID -> member
+	roles map[string]map[string]*Member
+
+	// name bucket -> user ID -> member, see nameBucket
+	names map[string]map[string]*Member
+
+	// channel ID -> user ID -> voice state
+	voice map[string]map[string]*VoiceState
+}
+
+func newGuildIndex() *guildIndex {
+	return &guildIndex{
+		roles: make(map[string]map[string]*Member),
+		names: make(map[string]map[string]*Member),
+		voice: make(map[string]map[string]*VoiceState),
+	}
+}
+
+// nameBucket returns the bucket a lowercase name is indexed under, which is
+// its first two runes.
+func nameBucket(name string) string {
+	n := 0
+	for i := range name {
+		if n == 2 {
+			return name[:i]
+		}
+		n++
+	}
+	return name
+}
+
+// memberNames returns the lowercase names a member can be found by.
+func memberNames(m *Member) []string {
+	names := []string{strings.ToLower(m.User.Username)}
+	if m.Nick != "" {
+		names = append(names, strings.ToLower(m.Nick))
+	}
+	return names
+}
+
+func addIndexed(index map[string]map[string]*Member, key string, m *Member) {
+	members, ok := index[key]
+	if !ok {
+		members = make(map[string]*Member)
+		index[key] = members
+	}
+	members[m.User.ID] = m
+}
+
+func removeIndexed(index map[string]map[string]*Member, key string, m *Member) {
+	if members, ok := index[key]; ok {
+		delete(members, m.User.ID)
+		if len(members) == 0 {
+			delete(index, key)
+		}
+	}
+}
+
+func (i *guildIndex) addMember(m *Member) {
+	for _, roleID := range m.Roles {
+		addIndexed(i.roles, roleID, m)
+	}
+	for _, name := range memberNames(m) {
+		addIndexed(i.names, nameBucket(name), m)
+	}
+}
+
+func (i *guildIndex) removeMember(m *Member) {
+	for _, roleID := range m.Roles {
+		removeIndexed(i.roles, roleID, m)
+	}
+	for _, name := range memberNames(m) {
+		removeIndexed(i.names, nameBucket(name), m)
+	}
+}
+
+func (i *guildIndex) addVoiceState(v *VoiceState) {
+	states, ok := i.voice[v.ChannelID]
+	if !ok {
+		states = make(map[string]*VoiceState)
+		i.voice[v.ChannelID] = states
+	}
+	states[v.UserID] = v
+}
+
+func (i *guildIndex) removeVoiceState(v *VoiceState) {
+	if states, ok := i.voice[v.ChannelID]; ok {
+		delete(states, v.UserID)
+		if len(states) == 0 {
+			delete(i.voice, v.ChannelID)
+		}
+	}
+}
+
+// index returns the index of a guild, or nil if the guild is not indexed.
+func (s *State) index(guildID string) *guildIndex {
+	if i, ok := s.indexMap.Load(guildID); ok {
+		return i.(*guildIndex)
+	}
+	return nil
+}
+
+// indexGuild rebuilds the index of a guild from its members and voice
+// states. The shard lock of the guild must be held.
+func (s *State) indexGuild(guild *Guild) {
+	i := newGuildIndex()
+	for _, m := range guild.Members {
+		i.addMember(m)
+	}
+	for _, v := range guild.VoiceStates {
+		i.addVoiceState(v)
+	}
+	s.indexMap.Store(guild.ID, i)
+}
+
+// indexMember adds a member to the index of its guild. The shard lock of the
+// guild must be held.
+func (s *State) indexMember(m *Member) {
+	if i := s.index(m.GuildID); i != nil {
+		i.addMember(m)
+	}
+}
+
+// unindexMember removes a member from the index of its guild. The shard lock
+// of the guild must be held.
+func (s *State) unindexMember(guildID string, m *Member) {
+	if i := s.index(guildID); i != nil {
+		i.removeMember(m)
+	}
+}
+
+// MembersWithRole returns the members of a guild that have a role.
+// guildID : The ID of a Guild.
+// roleID  : The ID of a Role.
+func (s *State) MembersWithRole(guildID, roleID string) ([]*Member, error) {
+	if s == nil {
+		return nil, ErrNilState
+	}
+
+	lock := s.shard(guildID)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	i := s.index(guildID)
+	if i == nil {
+		return nil, ErrStateNotFound
+	}
+
+	members := make([]*Member, 0, len(i.roles[roleID]))
+	for _, m := range i.roles[roleID] {
+		members = append(members, m)
+	}
+	sortMembers(members)
+	s.copyMembers(members)
+
+	return members, nil
+}
+
+// MembersByName returns the members of a guild whose username or nickname
+// starts with a prefix, ignoring case, sorted by username.
+// guildID : The ID of a Guild.
+// prefix  : The start of the names to look for.
+// limit   : The maximum number of members to return, 0 for no limit.
+func (s *State) MembersByName(guildID, prefix string, limit int) ([]*Member, error) {
+	if s == nil {
+		return nil, ErrNilState
+	}
+
+	prefix = strings.ToLower(prefix)
+	bucket := nameBucket(prefix)
+
+	lock := s.shard(guildID)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	i := s.index(guildID)
+	if i == nil {
+		return nil, ErrStateNotFound
+	}
+
+	seen := make(map[string]bool)
+	var members []*Member
+
+	match := func(candidates map[string]*Member) {
+		for id, m := range candidates {
+			if seen[id] {
+				continue
+			}
+			for _, name := range memberNames(m) {
+				if strings.HasPrefix(name, prefix) {
+					seen[id] = true
+					members = append(members, m)
+					break
+				}
+			}
+		}
+	}
+
+	// Names shorter than a bucket key can be in several buckets.
+	if len([]rune(prefix)) < 2 {
+		for b, candidates := range i.names {
+			if strings.HasPrefix(b, prefix) {
+				match(candidates)
+			}
+		}
+	} else {
+		match(i.names[bucket])
+	}
+
+	sortMembers(members)
+	if limit > 0 && len(members) > limit {
+		members = members[:limit]
+	}
+	s.copyMembers(members)
+
+	return members, nil
+}
+
+// ChannelVoiceStates returns the voice states of the users connected to a
+// voice channel.
+// channelID : The ID of a Channel.
+func (s *State) ChannelVoiceStates(channelID string) ([]*VoiceState, error) {
+	if s == nil {
+		return nil, ErrNilState
+	}
+
+	c, err := s.Channel(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := s.shard(c.GuildID)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	i := s.index(c.GuildID)
+	if i == nil {
+		return nil, ErrStateNotFound
+	}
+
+	states := make([]*VoiceState, 0, len(i.voice[channelID]))
+	for _, v := range i.voice[channelID] {
+		if s.CopyOnRead {
+			v = copyVoiceState(v)
+		}
+		states = append(states, v)
+	}
+	sort.Slice(states, func(a, b int) bool {
+		return states[a].UserID < states[b].UserID
+	})
+
+	return states, nil
+}
+
+// MutualGuilds returns the guilds a user is known to be a member of.
+// userID : The ID of a User.
+func (s *State) MutualGuilds(userID string) ([]*Guild, error) {
+	if s == nil {
+		return nil, ErrNilState
+	}
+
+	u, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.userMu.Lock()
+	guildIDs := append([]string(nil), u.guilds...)
+	s.userMu.Unlock()
+
+	guilds := make([]*Guild, 0, len(guildIDs))
+	for _, id := range guildIDs {
+		if g, err := s.Guild(id); err == nil {
+			guilds = append(guilds, g)
+		}
+	}
+
+	return guilds, nil
+}
+
+func sortMembers(members []*Member) {
+	sort.Slice(members, func(a, b int) bool {
+		na, nb := strings.ToLower(members[a].User.Username), strings.ToLower(members[b].User.Username)
+		if na != nb {
+			return na < nb
+		}
+		return members[a].User.ID < members[b].User.ID
+	})
+}
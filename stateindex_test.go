@@ -0,0 +1,125 @@
+package discordgo
+
+import (
+	"fmt"
+	"testing"
+)
+
+func newIndexState(t *testing.T) (*State, *Session) {
+	se := &Session{StateEnabled: true}
+	state := NewState()
+	se.State = state
+
+	for _, guildID := range []string{"1", "2"} {
+		err := state.GuildAdd(&Guild{
+			ID:       guildID,
+			Channels: []*Channel{{ID: "v" + guildID, GuildID: guildID, Type: ChannelTypeGuildVoice}},
+			Members: []*Member{
+				{GuildID: guildID, User: &User{ID: "1", Username: "Foo"}, Roles: []string{"mod"}},
+				{GuildID: guildID, User: &User{ID: "2", Username: "bar"}, Nick: "food"},
+				{GuildID: guildID, User: &User{ID: "3", Username: "f"}},
+			},
+			VoiceStates: []*VoiceState{{GuildID: guildID, UserID: "1", ChannelID: "v" + guildID}},
+		}, se)
+		if err != nil {
+			t.Fatalf("GuildAdd returned error: %+v", err)
+		}
+	}
+
+	return state, se
+}
+
+func memberIDs(members []*Member) (ids []string) {
+	for _, m := range members {
+		ids = append(ids, m.User.ID)
+	}
+	return
+}
+
+func TestStateMembersByName(t *testing.T) {
+	state, se := newIndexState(t)
+
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{"fOo", "[2 1]"},
+		{"f", "[2 3 1]"},
+		{"food", "[2]"},
+		{"ba", "[2]"},
+		{"x", "[]"},
+	}
+	for _, test := range tests {
+		members, err := state.MembersByName("1", test.prefix, 0)
+		if err != nil {
+			t.Fatalf("MembersByName returned error: %+v", err)
+		}
+		if got := fmt.Sprint(memberIDs(members)); got != test.want {
+			t.Errorf("MembersByName(%q) = %s, want %s", test.prefix, got, test.want)
+		}
+	}
+
+	if members, _ := state.MembersByName("1", "f", 1); len(members) != 1 {
+		t.Errorf("MembersByName should apply the limit, got %d members", len(members))
+	}
+
+	// Nick changes move the member in the index.
+	state.OnInterface(se, &GuildMemberUpdate{Member: &Member{GuildID: "1", User: &User{ID: "2", Username: "bar"}, Nick: "baz"}})
+	if members, _ := state.MembersByName("1", "foo", 0); fmt.Sprint(memberIDs(members)) != "[1]" {
+		t.Errorf("old nick should not be found, got %v", memberIDs(members))
+	}
+}
+
+func TestStateMembersWithRole(t *testing.T) {
+	state, se := newIndexState(t)
+
+	state.OnInterface(se, &GuildMemberUpdate{Member: &Member{GuildID: "1", User: &User{ID: "3"}, Roles: []string{"mod"}}})
+	state.OnInterface(se, &GuildMemberRemove{Member: &Member{GuildID: "1", User: &User{ID: "1"}}})
+
+	members, err := state.MembersWithRole("1", "mod")
+	if err != nil || fmt.Sprint(memberIDs(members)) != "[3]" {
+		t.Errorf("MembersWithRole should return member 3, got %v, %+v", memberIDs(members), err)
+	}
+
+	g, _ := state.Guild("1")
+	role := &Role{ID: "mod", Guild: g, Session: se}
+	if members, _ = role.GetMembers(); len(members) != 1 {
+		t.Errorf("GetMembers should return 1 member, got %d", len(members))
+	}
+}
+
+func TestStateChannelVoiceStates(t *testing.T) {
+	state, se := newIndexState(t)
+
+	state.OnInterface(se, &VoiceStateUpdate{VoiceState: &VoiceState{GuildID: "1", UserID: "2", ChannelID: "v1"}})
+	state.OnInterface(se, &VoiceStateUpdate{VoiceState: &VoiceState{GuildID: "1", UserID: "1", ChannelID: "other"}})
+
+	states, err := state.ChannelVoiceStates("v1")
+	if err != nil || len(states) != 1 || states[0].UserID != "2" {
+		t.Errorf("only user 2 should be in v1, got %+v, %+v", states, err)
+	}
+
+	c, _ := state.Channel("v1")
+	c.Session = se
+	if members, _ := c.MembersInVoice(); fmt.Sprint(memberIDs(members)) != "[2]" {
+		t.Errorf("MembersInVoice should return member 2, got %v", memberIDs(members))
+	}
+
+	state.OnInterface(se, &VoiceStateUpdate{VoiceState: &VoiceState{GuildID: "1", UserID: "2"}})
+	if states, _ = state.ChannelVoiceStates("v1"); len(states) != 0 {
+		t.Errorf("v1 should be empty, got %+v", states)
+	}
+}
+
+func TestStateMutualGuilds(t *testing.T) {
+	state, se := newIndexState(t)
+
+	state.OnInterface(se, &GuildMemberRemove{Member: &Member{GuildID: "2", User: &User{ID: "3"}}})
+
+	if guilds, err := state.MutualGuilds("1"); err != nil || len(guilds) != 2 {
+		t.Errorf("user 1 should share 2 guilds, got %d, %+v", len(guilds), err)
+	}
+	if guilds, err := state.MutualGuilds("3"); err != nil || len(guilds) != 1 || guilds[0].ID != "1" {
+		t.Errorf("user 3 should only share guild 1, got %+v, %+v", guilds, err)
+	}
+}
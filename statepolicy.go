@@ -0,0 +1,303 @@
+package discordgo
+
+import (
+	"container/list"
+	"time"
+)
+
+// memberSweepInterval is how often a State with a MemberCachePolicy looks for
+// expired members, and members no longer kept, in all of its guilds.
+const memberSweepInterval = time.Minute
+
+// A MemberCachePolicy decides which members a State keeps while TrackMembers
+// is on. Members are evicted the least recently seen first, where a member is
+// seen whenever it is added or updated by an event. The bot user and the
+// owners of guilds are never evicted.
+//
+// Evicting a member drops its user as well once it is in no cached guild.
+// Set the policy before opening the session.
+type MemberCachePolicy struct {
+	// MaxAge evicts the members not seen for longer than it, zero keeps them forever.
+	MaxAge time.Duration
+
+	// MaxPerGuild caps the number of members kept per guild, zero means no cap.
+	MaxPerGuild int
+
+	// KeepWithRoles keeps the members with any role besides @everyone.
+	KeepWithRoles bool
+
+	// KeepInVoice keeps the members connected to a voice channel of the guild.
+	KeepInVoice bool
+}
+
+// memberLRU orders the members of a guild by when they were last seen, it is
+// guarded by the shard lock of the guild.
+type memberLRU struct {
+	// The most recently seen member is at the front.
+	order *list.List
+
+	// kept holds the members the policy kept when they were up for eviction,
+	// so that evictions skip them until they are seen again.
+	kept *list.List
+
+	index map[string]*list.Element
+}
+
+type seenMember struct {
+	userID string
+	seen   time.Time
+	kept   bool
+}
+
+func newMemberLRU() *memberLRU {
+	return &memberLRU{
+		order: list.New(),
+		kept:  list.New(),
+		index: make(map[string]*list.Element),
+	}
+}
+
+func (l *memberLRU) len() int {
+	return l.order.Len() + l.kept.Len()
+}
+
+func (l *memberLRU) touch(userID string, now time.Time) {
+	if e, ok := l.index[userID]; ok {
+		sm := e.Value.(*seenMember)
+		sm.seen = now
+		if sm.kept {
+			l.kept.Remove(e)
+			sm.kept = false
+			l.index[userID] = l.order.PushFront(sm)
+			return
+		}
+		l.order.MoveToFront(e)
+		return
+	}
+
+	l.index[userID] = l.order.PushFront(&seenMember{userID: userID, seen: now})
+}
+
+func (l *memberLRU) remove(userID string) {
+	if e, ok := l.index[userID]; ok {
+		if e.Value.(*seenMember).kept {
+			l.kept.Remove(e)
+		} else {
+			l.order.Remove(e)
+		}
+		delete(l.index, userID)
+	}
+}
+
+// keep moves a member out of the eviction order.
+func (l *memberLRU) keep(e *list.Element) {
+	sm := l.order.Remove(e).(*seenMember)
+	sm.kept = true
+	l.index[sm.userID] = l.kept.PushBack(sm)
+}
+
+// release moves a kept member back into the eviction order, at the place of
+// when it was last seen.
+func (l *memberLRU) release(e *list.Element) {
+	sm := l.kept.Remove(e).(*seenMember)
+	sm.kept = false
+
+	o := l.order.Back()
+	for o != nil && o.Value.(*seenMember).seen.Before(sm.seen) {
+		o = o.Prev()
+	}
+	if o == nil {
+		l.index[sm.userID] = l.order.PushFront(sm)
+	} else {
+		l.index[sm.userID] = l.order.InsertAfter(sm, o)
+	}
+}
+
+// memberLRU returns the member LRU of a guild, creating it if create is set.
+func (s *State) memberLRU(guildID string, create bool) *memberLRU {
+	if v, ok := s.lruMap.Load(guildID); ok {
+		return v.(*memberLRU)
+	}
+	if !create {
+		return nil
+	}
+
+	v, _ := s.lruMap.LoadOrStore(guildID, newMemberLRU())
+	return v.(*memberLRU)
+}
+
+// touchMember marks a member as seen. The shard lock of the guild must be held.
+func (s *State) touchMember(guildID, userID string, now time.Time) {
+	if s.MemberCachePolicy == nil {
+		return
+	}
+
+	s.memberLRU(guildID, true).touch(userID, now)
+}
+
+// forgetMember removes a member from the LRU of its guild. The shard lock of
+// the guild must be held.
+func (s *State) forgetMember(guildID, userID string) {
+	if l := s.memberLRU(guildID, false); l != nil {
+		l.remove(userID)
+	}
+}
+
+// resetMemberLRU rebuilds the LRU of a guild from its members, all seen now,
+// and evicts the members over the policy. The shard lock of the guild must be held.
+func (s *State) resetMemberLRU(guild *Guild, now time.Time) {
+	if s.MemberCachePolicy == nil {
+		return
+	}
+
+	l := newMemberLRU()
+	for _, m := range guild.Members {
+		l.touch(m.User.ID, now)
+	}
+	s.lruMap.Store(guild.ID, l)
+
+	s.evictMembers(guild, now)
+}
+
+// keepMember reports whether a member is never evicted.
+func (s *State) keepMember(p *MemberCachePolicy, guild *Guild, m *Member) bool {
+	if id, _ := s.myID.Load().(string); m.User.ID == id || m.User.ID == guild.OwnerID {
+		return true
+	}
+
+	if p.KeepWithRoles && len(m.Roles) > 0 {
+		return true
+	}
+
+	if p.KeepInVoice {
+		if _, err := guild.GetVoiceState(m.User.ID); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// evictMembers evicts the members of a guild that are expired or over the
+// cap of the policy. The shard lock of the guild must be held.
+func (s *State) evictMembers(guild *Guild, now time.Time) {
+	p := s.MemberCachePolicy
+	if p == nil || (p.MaxAge == 0 && p.MaxPerGuild == 0) {
+		return
+	}
+
+	l := s.memberLRU(guild.ID, false)
+	members, ok := s.members(guild.ID)
+	if l == nil || !ok {
+		return
+	}
+
+	evicted := make(map[string]bool)
+	count := l.len()
+
+	for e := l.order.Back(); e != nil; {
+		prev := e.Prev()
+		sm := e.Value.(*seenMember)
+
+		expired := p.MaxAge > 0 && now.Sub(sm.seen) > p.MaxAge
+		over := p.MaxPerGuild > 0 && count > p.MaxPerGuild
+		if !expired && !over {
+			break
+		}
+
+		v, ok := members.Load(sm.userID)
+		if !ok {
+			l.remove(sm.userID)
+		} else if m := v.(*Member); s.keepMember(p, guild, m) {
+			l.keep(e)
+		} else {
+			l.remove(sm.userID)
+			members.Delete(sm.userID)
+			s.unindexMember(guild.ID, m)
+			s.removeUser(guild.ID, sm.userID)
+			evicted[sm.userID] = true
+			count--
+		}
+
+		e = prev
+	}
+
+	if len(evicted) == 0 {
+		return
+	}
+
+	kept := make([]*Member, 0, len(guild.Members)-len(evicted))
+	for _, m := range guild.Members {
+		if !evicted[m.User.ID] {
+			kept = append(kept, m)
+		}
+	}
+	guild.Members = kept
+}
+
+// releaseMembers moves the members no longer kept by the policy, such as
+// members that left voice, back into the eviction order of a guild. The
+// shard lock of the guild must be held.
+func (s *State) releaseMembers(guild *Guild) {
+	l := s.memberLRU(guild.ID, false)
+	members, ok := s.members(guild.ID)
+	if l == nil || !ok {
+		return
+	}
+
+	for e := l.kept.Front(); e != nil; {
+		next := e.Next()
+		sm := e.Value.(*seenMember)
+
+		v, ok := members.Load(sm.userID)
+		if !ok {
+			l.remove(sm.userID)
+		} else if !s.keepMember(s.MemberCachePolicy, guild, v.(*Member)) {
+			l.release(e)
+		}
+
+		e = next
+	}
+}
+
+// EvictMembers evicts the members of every guild that are over the
+// MemberCachePolicy of the state, checking again the members it kept before.
+// It is called regularly while events are handled, so it rarely needs to be
+// called directly.
+func (s *State) EvictMembers() {
+	if s == nil || s.MemberCachePolicy == nil {
+		return
+	}
+
+	now := time.Now()
+	s.guildMap.Range(func(_, v interface{}) bool {
+		g := v.(*Guild)
+
+		lock := s.shard(g.ID)
+		lock.Lock()
+		s.releaseMembers(g)
+		s.evictMembers(g, now)
+		lock.Unlock()
+
+		return true
+	})
+}
+
+// sweepMembers evicts the members of all guilds over the policy, at most once
+// per memberSweepInterval.
+func (s *State) sweepMembers() {
+	p := s.MemberCachePolicy
+	if p == nil || (p.MaxAge == 0 && p.MaxPerGuild == 0) {
+		return
+	}
+
+	s.sweepMu.Lock()
+	if time.Since(s.lastSweep) < memberSweepInterval {
+		s.sweepMu.Unlock()
+		return
+	}
+	s.lastSweep = time.Now()
+	s.sweepMu.Unlock()
+
+	s.EvictMembers()
+}
@@ -0,0 +1,169 @@
+package discordgo
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// The tests in this file are meant to be run with -race, they apply events
+// to a state while its entities, and the events, are read by other goroutines.
+
+// raceEvents returns the events applied by the race tests, in order.
+func raceEvents(n int) []interface{} {
+	id := strconv.Itoa(n)
+	user := &User{ID: "100", Username: "user" + id}
+
+	return []interface{}{
+		&GuildUpdate{Guild: &Guild{ID: "1", Name: "guild " + id}},
+		&GuildMemberUpdate{Member: &Member{GuildID: "1", User: &User{ID: "100", Username: "user" + id}, Nick: "nick " + id, Roles: []string{"2"}}},
+		&GuildMemberAdd{Member: &Member{GuildID: "1", User: &User{ID: "200", Username: "new"}}},
+		&PresenceUpdate{GuildID: "1", Presence: Presence{User: user, Status: StatusIdle, Roles: []string{"2"}}},
+		&GuildRoleUpdate{GuildRole: &GuildRole{GuildID: "1", Role: &Role{ID: "2", Name: "role " + id}}},
+		&GuildEmojisUpdate{GuildID: "1", Emojis: []*Emoji{{ID: "3", Name: "emoji" + id}}},
+		&ChannelUpdate{Channel: &Channel{ID: "10", GuildID: "1", Name: "channel " + id, PermissionOverwrites: []*PermissionOverwrite{{ID: "2"}}}},
+		&VoiceStateUpdate{VoiceState: &VoiceState{GuildID: "1", UserID: "100", ChannelID: "11"}},
+		&MessageCreate{Message: &Message{ID: id, ChannelID: "10", Content: "message " + id, Author: &User{ID: "100"}}},
+		&MessageUpdate{Message: &Message{ID: id, ChannelID: "10", Content: "edited " + id}},
+		&MessageReactionAdd{MessageReaction: &MessageReaction{UserID: "100", MessageID: id, ChannelID: "10", Emoji: &Emoji{Name: "a"}}},
+		&UserUpdate{User: &User{ID: "bot", Username: "bot " + id}},
+		&VoiceStateUpdate{VoiceState: &VoiceState{GuildID: "1", UserID: "100"}},
+		&GuildMemberRemove{Member: &Member{GuildID: "1", User: &User{ID: "200"}}},
+	}
+}
+
+// readDeep reads all exported fields reachable from v.
+func readDeep(t *testing.T, v interface{}) {
+	if _, err := json.Marshal(v); err != nil {
+		t.Errorf("could not read %T: %+v", v, err)
+	}
+}
+
+func newRaceState(t *testing.T, st StateCache) *Session {
+	se := &Session{StateEnabled: true, State: st}
+
+	err := st.OnInterface(se, &Ready{
+		User: &User{ID: "bot", Username: "bot"},
+		Guilds: []*Guild{{
+			ID:       "1",
+			Name:     "guild",
+			Roles:    []*Role{{ID: "1", Name: "@everyone"}, {ID: "2", Name: "role"}},
+			Emojis:   []*Emoji{{ID: "3", Name: "emoji"}},
+			Channels: []*Channel{{ID: "10", GuildID: "1", Name: "general"}, {ID: "11", GuildID: "1", Type: ChannelTypeGuildVoice}},
+			Members: []*Member{
+				{GuildID: "1", User: &User{ID: "bot", Username: "bot"}},
+				{GuildID: "1", User: &User{ID: "100", Username: "user"}, Roles: []string{"2"}},
+			},
+			Presences: []*Presence{{User: &User{ID: "100"}, Status: StatusOnline}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("OnInterface returned error: %+v", err)
+	}
+
+	return se
+}
+
+func TestStateRaceCopyOnRead(t *testing.T) {
+	state := NewState()
+	state.MaxMessageCount = 10
+	state.CopyOnRead = true
+	kv := NewKVState(NewMemoryKV())
+	kv.MaxMessageCount = 10
+
+	for _, st := range []StateCache{state, kv} {
+		se := newRaceState(t, st)
+
+		// Handled events are passed on to a handler, which reads them
+		// while the next events are applied.
+		handled := make(chan interface{}, 16)
+		done := make(chan struct{})
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(handled)
+
+			for n := 0; n < 100; n++ {
+				for _, e := range raceEvents(n) {
+					if err := st.OnInterface(se, e); err != nil {
+						t.Errorf("%T: OnInterface(%T) returned error: %+v", st, e, err)
+					}
+					handled <- e
+				}
+			}
+		}()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range handled {
+				readDeep(t, e)
+			}
+			close(done)
+		}()
+
+		for r := 0; r < 4; r++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+
+					if g, err := st.Guild("1"); err == nil {
+						readDeep(t, g)
+						for _, m := range g.Members {
+							// Copies belong to the reader.
+							m.Nick = "changed"
+						}
+					}
+					if m, err := st.Member("1", "100"); err == nil {
+						readDeep(t, m)
+					}
+					if c, err := st.Channel("10"); err == nil {
+						readDeep(t, c)
+					}
+					if u, err := st.GetUser("100"); err == nil {
+						readDeep(t, u)
+					}
+					if p, err := st.Presence("1", "100"); err == nil {
+						readDeep(t, p)
+					}
+					if r, err := st.Role("1", "2"); err == nil {
+						readDeep(t, r)
+					}
+					if e, err := st.Emoji("1", "3"); err == nil {
+						readDeep(t, e)
+					}
+					readDeep(t, st.MyUser())
+					st.UserColor("100", "10")
+
+					if s, ok := st.(*State); ok {
+						members, _ := s.MembersWithRole("1", "2")
+						readDeep(t, members)
+						members, _ = s.MembersByName("1", "us", 0)
+						readDeep(t, members)
+						voice, _ := s.ChannelVoiceStates("11")
+						readDeep(t, voice)
+						guilds, _ := s.MutualGuilds("100")
+						readDeep(t, guilds)
+						readDeep(t, s.ChannelMessages("10"))
+					}
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		if m, err := st.Member("1", "100"); err != nil || m.Nick != "nick 99" {
+			t.Errorf("%T: member should have the last update, got %+v, %+v", st, m, err)
+		}
+	}
+}
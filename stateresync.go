@@ -0,0 +1,430 @@
+package discordgo
+
+import (
+	"net/http"
+	"sort"
+)
+
+// A StateDriftType is the type of entity a StateDrift is about.
+type StateDriftType int
+
+// Valid StateDriftType values.
+const (
+	StateDriftGuild StateDriftType = iota
+	StateDriftChannel
+	StateDriftRole
+	StateDriftEmoji
+	StateDriftMember
+)
+
+// A StateDrift is an entity whose copy in the state differs from the API.
+type StateDrift struct {
+	Type    StateDriftType
+	GuildID string
+
+	// The ID of the entity, the user ID for members.
+	ID string
+
+	// The entity in the state, nil if it is missing from the state.
+	Cached interface{}
+
+	// The entity fetched from the API, nil if it no longer exists.
+	Fetched interface{}
+}
+
+// sameStrings reports whether two lists hold the same strings, in any order.
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	as := append([]string(nil), a...)
+	bs := append([]string(nil), b...)
+	sort.Strings(as)
+	sort.Strings(bs)
+
+	for i := range as {
+		if as[i] != bs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// guildChanged reports whether the fields of a guild sent over REST differ.
+// The member count is only compared when b has one.
+func guildChanged(a, b *Guild) bool {
+	return a.Name != b.Name ||
+		a.Icon != b.Icon ||
+		a.Region != b.Region ||
+		a.AfkChannelID != b.AfkChannelID ||
+		a.EmbedChannelID != b.EmbedChannelID ||
+		a.OwnerID != b.OwnerID ||
+		a.Splash != b.Splash ||
+		a.AfkTimeout != b.AfkTimeout ||
+		a.VerificationLevel != b.VerificationLevel ||
+		a.EmbedEnabled != b.EmbedEnabled ||
+		a.DefaultMessageNotifications != b.DefaultMessageNotifications ||
+		a.ExplicitContentFilter != b.ExplicitContentFilter ||
+		!sameStrings(a.Features, b.Features) ||
+		a.MfaLevel != b.MfaLevel ||
+		a.WidgetEnabled != b.WidgetEnabled ||
+		a.WidgetChannelID != b.WidgetChannelID ||
+		a.SystemChannelID != b.SystemChannelID ||
+		a.VanityURLCode != b.VanityURLCode ||
+		a.Description != b.Description ||
+		a.Banner != b.Banner ||
+		a.PremiumTier != b.PremiumTier ||
+		a.PremiumSubscriptionCount != b.PremiumSubscriptionCount ||
+		(b.MemberCount != 0 && a.MemberCount != b.MemberCount)
+}
+
+func channelChanged(a, b *Channel) bool {
+	if a.Name != b.Name ||
+		a.Topic != b.Topic ||
+		a.Type != b.Type ||
+		a.NSFW != b.NSFW ||
+		a.Position != b.Position ||
+		a.Bitrate != b.Bitrate ||
+		a.UserLimit != b.UserLimit ||
+		a.RateLimitPerUser != b.RateLimitPerUser ||
+		a.ParentID != b.ParentID ||
+		len(a.PermissionOverwrites) != len(b.PermissionOverwrites) {
+		return true
+	}
+
+	overwrites := make(map[string]PermissionOverwrite, len(a.PermissionOverwrites))
+	for _, o := range a.PermissionOverwrites {
+		overwrites[o.ID] = *o
+	}
+	for _, o := range b.PermissionOverwrites {
+		if ao, ok := overwrites[o.ID]; !ok || ao != *o {
+			return true
+		}
+	}
+	return false
+}
+
+func roleChanged(a, b *Role) bool {
+	return a.Name != b.Name ||
+		a.Managed != b.Managed ||
+		a.Mentionable != b.Mentionable ||
+		a.Hoist != b.Hoist ||
+		a.Color != b.Color ||
+		a.Position != b.Position ||
+		a.Permissions != b.Permissions
+}
+
+func emojiChanged(a, b *Emoji) bool {
+	return a.Name != b.Name ||
+		!sameStrings(a.Roles, b.Roles) ||
+		a.Managed != b.Managed ||
+		a.RequireColons != b.RequireColons ||
+		a.Animated != b.Animated ||
+		a.Available != b.Available
+}
+
+func memberChanged(a, b *Member) bool {
+	return a.Nick != b.Nick ||
+		!sameStrings(a.Roles, b.Roles) ||
+		a.Deaf != b.Deaf ||
+		a.Mute != b.Mute ||
+		a.PremiumSince != b.PremiumSince ||
+		a.User.Username != b.User.Username ||
+		a.User.Discriminator != b.User.Discriminator ||
+		a.User.Avatar != b.User.Avatar
+}
+
+// diffByID appends the drift between the cached and fetched entities of a
+// type, keyed by ID, sorted by ID.
+func diffByID(drift []*StateDrift, t StateDriftType, guildID string, cached, fetched map[string]interface{}, changed func(a, b interface{}) bool) []*StateDrift {
+	ids := make([]string, 0, len(cached)+len(fetched))
+	for id := range fetched {
+		ids = append(ids, id)
+	}
+	for id := range cached {
+		if _, ok := fetched[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		c, inCache := cached[id]
+		f, fetchedOk := fetched[id]
+		if inCache && fetchedOk && !changed(c, f) {
+			continue
+		}
+
+		d := &StateDrift{Type: t, GuildID: guildID, ID: id}
+		if inCache {
+			d.Cached = c
+		}
+		if fetchedOk {
+			d.Fetched = f
+		}
+		drift = append(drift, d)
+	}
+
+	return drift
+}
+
+// diffMembers returns the drift between cached and fetched members of a guild.
+func diffMembers(guildID string, cached, fetched []*Member) []*StateDrift {
+	cm := make(map[string]interface{}, len(cached))
+	for _, m := range cached {
+		cm[m.User.ID] = m
+	}
+	fm := make(map[string]interface{}, len(fetched))
+	for _, m := range fetched {
+		fm[m.User.ID] = m
+	}
+
+	return diffByID(nil, StateDriftMember, guildID, cm, fm, func(a, b interface{}) bool {
+		return memberChanged(a.(*Member), b.(*Member))
+	})
+}
+
+// diffGuild returns the drift between a cached guild and the same guild
+// fetched over REST, with its roles and emojis. The channels and members
+// are only compared when they are not nil.
+func diffGuild(cached, fetched *Guild, channels []*Channel, members []*Member) []*StateDrift {
+	var drift []*StateDrift
+
+	if guildChanged(cached, fetched) {
+		drift = append(drift, &StateDrift{Type: StateDriftGuild, GuildID: cached.ID, ID: cached.ID, Cached: cached, Fetched: fetched})
+	}
+
+	if channels != nil {
+		cc := make(map[string]interface{}, len(cached.Channels))
+		for _, c := range cached.Channels {
+			cc[c.ID] = c
+		}
+		fc := make(map[string]interface{}, len(channels))
+		for _, c := range channels {
+			fc[c.ID] = c
+		}
+		drift = diffByID(drift, StateDriftChannel, cached.ID, cc, fc, func(a, b interface{}) bool {
+			return channelChanged(a.(*Channel), b.(*Channel))
+		})
+	}
+
+	cr := make(map[string]interface{}, len(cached.Roles))
+	for _, r := range cached.Roles {
+		cr[r.ID] = r
+	}
+	fr := make(map[string]interface{}, len(fetched.Roles))
+	for _, r := range fetched.Roles {
+		fr[r.ID] = r
+	}
+	drift = diffByID(drift, StateDriftRole, cached.ID, cr, fr, func(a, b interface{}) bool {
+		return roleChanged(a.(*Role), b.(*Role))
+	})
+
+	ce := make(map[string]interface{}, len(cached.Emojis))
+	for _, e := range cached.Emojis {
+		ce[e.ID] = e
+	}
+	fe := make(map[string]interface{}, len(fetched.Emojis))
+	for _, e := range fetched.Emojis {
+		fe[e.ID] = e
+	}
+	drift = diffByID(drift, StateDriftEmoji, cached.ID, ce, fe, func(a, b interface{}) bool {
+		return emojiChanged(a.(*Emoji), b.(*Emoji))
+	})
+
+	if members != nil {
+		drift = append(drift, diffMembers(cached.ID, cached.Members, members)...)
+	}
+
+	return drift
+}
+
+// A driftEvent is a synthetic event sent for a drifted entity.
+type driftEvent struct {
+	t string
+	i interface{}
+}
+
+// driftEvents returns the events that bring a state from the cached entities
+// of drift to the fetched ones. Missing members are sent in a single
+// GuildMembersChunk, and changed emojis and member counts in the GuildUpdate
+// of fetched.
+func driftEvents(fetched *Guild, drift []*StateDrift) []driftEvent {
+	var events []driftEvent
+	var chunk []*Member
+	updateGuild := false
+
+	for _, d := range drift {
+		switch d.Type {
+		case StateDriftGuild, StateDriftEmoji:
+			updateGuild = true
+		case StateDriftChannel:
+			if d.Fetched == nil {
+				events = append(events, driftEvent{channelDeleteEventType, &ChannelDelete{Channel: d.Cached.(*Channel)}})
+			} else if d.Cached == nil {
+				events = append(events, driftEvent{channelCreateEventType, &ChannelCreate{Channel: d.Fetched.(*Channel)}})
+			} else {
+				events = append(events, driftEvent{channelUpdateEventType, &ChannelUpdate{Channel: d.Fetched.(*Channel)}})
+			}
+		case StateDriftRole:
+			if d.Fetched == nil {
+				events = append(events, driftEvent{guildRoleDeleteEventType, &GuildRoleDelete{RoleID: d.ID, GuildID: d.GuildID}})
+			} else if d.Cached == nil {
+				events = append(events, driftEvent{guildRoleCreateEventType, &GuildRoleCreate{GuildRole: &GuildRole{Role: d.Fetched.(*Role), GuildID: d.GuildID}}})
+			} else {
+				events = append(events, driftEvent{guildRoleUpdateEventType, &GuildRoleUpdate{GuildRole: &GuildRole{Role: d.Fetched.(*Role), GuildID: d.GuildID}}})
+			}
+		case StateDriftMember:
+			if d.Fetched == nil {
+				events = append(events, driftEvent{guildMemberRemoveEventType, &GuildMemberRemove{Member: d.Cached.(*Member)}})
+
+				// Removes lower the member count, which may have been right.
+				updateGuild = updateGuild || fetched.MemberCount != 0
+			} else if d.Cached == nil {
+				chunk = append(chunk, d.Fetched.(*Member))
+			} else {
+				events = append(events, driftEvent{guildMemberUpdateEventType, &GuildMemberUpdate{Member: d.Fetched.(*Member)}})
+			}
+		}
+	}
+
+	if chunk != nil {
+		events = append(events, driftEvent{guildMembersChunkEventType, &GuildMembersChunk{GuildID: fetched.ID, Members: chunk}})
+	}
+
+	if updateGuild {
+		events = append(events, driftEvent{guildUpdateEventType, &GuildUpdate{Guild: fetched}})
+	}
+
+	return events
+}
+
+// snapshotGuild returns a copy of a guild in a state cache, which is not
+// changed by later events.
+func snapshotGuild(st StateCache, guildID string) (*Guild, error) {
+	s, ok := st.(*State)
+	if !ok || s.CopyOnRead {
+		// Other state caches return copies already.
+		return st.Guild(guildID)
+	}
+
+	g, err := s.guild(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.viewCopy(guildID, func() {
+		g = copyGuild(g)
+	})
+	return g, nil
+}
+
+// isNotFound reports whether a REST error is a 404 Not Found.
+func isNotFound(err error) bool {
+	restErr, ok := err.(*RESTError)
+	return ok && restErr.Response != nil && restErr.Response.StatusCode == http.StatusNotFound
+}
+
+// fetchGuildMembers fetches every member of a guild, 1000 at a time.
+func (s *Session) fetchGuildMembers(guildID string) ([]*Member, error) {
+	members := []*Member{}
+	after := ""
+
+	for {
+		page, err := s.GuildMembers(guildID, after, 1000)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range page {
+			m.GuildID = guildID
+		}
+		members = append(members, page...)
+
+		if len(page) < 1000 {
+			return members, nil
+		}
+		after = page[len(page)-1].User.ID
+	}
+}
+
+// stateTracksMembers reports whether the state of a session keeps members.
+func (s *Session) stateTracksMembers() bool {
+	if b, ok := s.State.(stateBackend); ok {
+		return b.options().TrackMembers
+	}
+	return true
+}
+
+// ResyncGuild fetches a guild with its channels, roles, emojis and members
+// over REST, and brings the state up to date with it, for when events were
+// missed. Whatever changed is sent as the events that were missed: channel
+// and role creates, updates and deletes, member updates and removes, a
+// GuildMembersChunk with the members the state did not hold, and a
+// GuildUpdate for changes to the guild itself or its emojis. These events
+// go through the state and the event handlers like any other event.
+//
+// A guild the state does not hold is sent as a GuildCreate, and a guild
+// that no longer exists as a GuildDelete.
+// Members are only fetched if the state tracks them, which takes the
+// GUILD_MEMBERS intent and a request per 1000 members.
+// guildID : The ID of a Guild.
+func (s *Session) ResyncGuild(guildID string) (drift []*StateDrift, err error) {
+	if s.State == nil {
+		return nil, ErrNilState
+	}
+
+	cached, cacheErr := snapshotGuild(s.State, guildID)
+
+	fetched, err := s.FetchGuild(guildID)
+	if isNotFound(err) && cacheErr == nil {
+		s.handleEvent(guildDeleteEventType, &GuildDelete{Guild: cached})
+		return []*StateDrift{{Type: StateDriftGuild, GuildID: guildID, ID: guildID, Cached: cached}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	channels, err := s.GuildChannels(guildID)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range channels {
+		c.GuildID = guildID
+	}
+
+	var members []*Member
+	if s.stateTracksMembers() {
+		if members, err = s.fetchGuildMembers(guildID); err != nil {
+			return nil, err
+		}
+		fetched.MemberCount = len(members)
+	}
+
+	if cacheErr != nil {
+		fetched.Channels = channels
+		fetched.Members = members
+		s.handleEvent(guildCreateEventType, &GuildCreate{Guild: fetched})
+		return []*StateDrift{{Type: StateDriftGuild, GuildID: guildID, ID: guildID, Fetched: fetched}}, nil
+	}
+
+	// Fields only sent with GUILD_CREATE are kept, and the roles and emojis
+	// replace the cached ones even when there are none.
+	fetched.JoinedAt = cached.JoinedAt
+	fetched.Large = cached.Large
+	fetched.Unavailable = false
+	if fetched.Roles == nil {
+		fetched.Roles = []*Role{}
+	}
+	if fetched.Emojis == nil {
+		fetched.Emojis = []*Emoji{}
+	}
+
+	drift = diffGuild(cached, fetched, channels, members)
+	for _, e := range driftEvents(fetched, drift) {
+		s.handleEvent(e.t, e.i)
+	}
+
+	return drift, nil
+}
@@ -0,0 +1,146 @@
+package discordgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// fakeAPI answers REST requests with the JSON of the value stored under
+// their endpoint, or a 404 for the endpoints it does not have.
+type fakeAPI map[string]interface{}
+
+func (f fakeAPI) RoundTrip(req *http.Request) (*http.Response, error) {
+	status := http.StatusNotFound
+	body := []byte(`{"code":10004,"message":"Unknown"}`)
+
+	for endpoint, v := range f {
+		if u, _ := url.Parse(endpoint); u.Path == req.URL.Path {
+			status = http.StatusOK
+			body, _ = json.Marshal(v)
+		}
+	}
+
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func newResyncSession(t *testing.T, api fakeAPI) *Session {
+	se, _ := New("Bot token")
+	se.Client = &http.Client{Transport: api}
+	se.SyncEvents = true
+	se.MaxRestRetries = 0
+
+	err := se.State.OnInterface(se, &Ready{
+		User: &User{ID: "bot"},
+		Guilds: []*Guild{{
+			ID:          "1",
+			Name:        "old",
+			MemberCount: 2,
+			Roles:       []*Role{{ID: "1", Name: "@everyone"}, {ID: "2", Name: "red"}, {ID: "3", Name: "deleted"}},
+			Emojis:      []*Emoji{{ID: "5", Name: "emoji"}},
+			Channels:    []*Channel{{ID: "10", GuildID: "1", Name: "general"}, {ID: "11", GuildID: "1", Name: "deleted"}},
+			Members: []*Member{
+				{GuildID: "1", User: &User{ID: "a", Username: "a"}, Nick: "old"},
+				{GuildID: "1", User: &User{ID: "b", Username: "b"}},
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("OnInterface returned error: %+v", err)
+	}
+
+	return se
+}
+
+func TestResyncGuild(t *testing.T) {
+	se := newResyncSession(t, fakeAPI{
+		EndpointGuild("1"): &Guild{
+			ID:     "1",
+			Name:   "new",
+			Roles:  []*Role{{ID: "1", Name: "@everyone"}, {ID: "2", Name: "blue"}, {ID: "4", Name: "created"}},
+			Emojis: []*Emoji{},
+		},
+		EndpointGuildChannels("1"): []*Channel{{ID: "10", GuildID: "1", Name: "renamed"}, {ID: "12", GuildID: "1", Name: "created"}},
+		EndpointGuildMembers("1"): []*Member{
+			{User: &User{ID: "a", Username: "a"}, Nick: "new"},
+			{User: &User{ID: "c", Username: "c"}},
+		},
+	})
+
+	var channelBefore *Channel
+	var updates, removes, chunked int
+	se.AddHandler(func(s *Session, e *ChannelUpdate) { channelBefore = e.BeforeUpdate })
+	se.AddHandler(func(s *Session, e *GuildRoleUpdate) { updates++ })
+	se.AddHandler(func(s *Session, e *GuildMemberRemove) { removes++ })
+	se.AddHandler(func(s *Session, e *GuildMembersChunk) { chunked += len(e.Members) })
+
+	drift, err := se.ResyncGuild("1")
+	if err != nil {
+		t.Fatalf("ResyncGuild returned error: %+v", err)
+	}
+
+	// The guild, 3 channels, 3 roles, an emoji and 3 members drifted.
+	if len(drift) != 11 {
+		t.Errorf("11 entities should have drifted, got %d", len(drift))
+	}
+	if g := drift[0].Cached.(*Guild); g.Name != "old" {
+		t.Errorf("drift should hold the guild from before the resync, got %s", g.Name)
+	}
+
+	if channelBefore == nil || channelBefore.Name != "general" {
+		t.Errorf("ChannelUpdate should have been sent with the cached channel, got %+v", channelBefore)
+	}
+	if updates != 1 || removes != 1 || chunked != 1 {
+		t.Errorf("1 role update, member remove and chunked member should be sent, got %d, %d and %d", updates, removes, chunked)
+	}
+
+	g, _ := se.State.Guild("1")
+	if g.Name != "new" || g.MemberCount != 2 || len(g.Channels) != 2 || len(g.Roles) != 3 || len(g.Emojis) != 0 || len(g.Members) != 2 {
+		t.Errorf("guild should be resynced, got %+v", g)
+	}
+	if m, err := se.State.Member("1", "a"); err != nil || m.Nick != "new" {
+		t.Errorf("member should be updated, got %+v, %+v", m, err)
+	}
+	if _, err := se.State.Channel("11"); err != ErrStateNotFound {
+		t.Errorf("deleted channel should be removed, got %+v", err)
+	}
+
+	// Nothing drifts after a resync.
+	if drift, err = se.ResyncGuild("1"); err != nil || len(drift) != 0 {
+		t.Errorf("no entities should drift after a resync, got %d, %+v", len(drift), err)
+	}
+}
+
+func TestCheckGuild(t *testing.T) {
+	se := newResyncSession(t, fakeAPI{
+		EndpointGuild("1"): &Guild{
+			ID:     "1",
+			Name:   "old",
+			Roles:  []*Role{{ID: "1", Name: "@everyone"}, {ID: "2", Name: "red"}, {ID: "3", Name: "deleted"}},
+			Emojis: []*Emoji{{ID: "5", Name: "emoji"}},
+		},
+		EndpointGuildChannels("1"):    []*Channel{{ID: "10", GuildID: "1", Name: "general"}, {ID: "11", GuildID: "1", Name: "deleted"}},
+		EndpointGuildMember("1", "a"): &Member{User: &User{ID: "a", Username: "a"}, Nick: "new"},
+	})
+
+	drift, err := se.CheckGuild("1", 2)
+	if err != nil {
+		t.Fatalf("CheckGuild returned error: %+v", err)
+	}
+
+	// Member a changed its nick and member b left.
+	if len(drift) != 2 || drift[0].ID != "a" || drift[1].ID != "b" || drift[1].Fetched != nil {
+		t.Errorf("members a and b should have drifted, got %+v", drift)
+	}
+	if m, _ := se.State.Member("1", "a"); m.Nick != "old" {
+		t.Errorf("CheckGuild should not change the state")
+	}
+}
@@ -0,0 +1,197 @@
+package discordgo
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StateSnapshotVersion is the version of the snapshot format written by State.Save.
+const StateSnapshotVersion = 1
+
+// A StateSnapshot is a point in time copy of a State, as written to disk.
+type StateSnapshot struct {
+	Version int `json:"version"`
+
+	// The gateway session the state belongs to, used to resume it after a restart
+	SessionID string `json:"session_id"`
+	Sequence  int64  `json:"sequence"`
+
+	User            *User      `json:"user"`
+	Guilds          []*Guild   `json:"guilds"`
+	PrivateChannels []*Channel `json:"private_channels"`
+}
+
+// lockAll takes every lock of the state for reading, in a fixed order.
+func (s *State) lockAll() {
+	s.RLock()
+	for i := range s.shards {
+		s.shards[i].RLock()
+	}
+	s.userMu.Lock()
+}
+
+func (s *State) unlockAll() {
+	s.userMu.Unlock()
+	for i := range s.shards {
+		s.shards[i].RUnlock()
+	}
+	s.RUnlock()
+}
+
+// Save writes a consistent snapshot of the state to w.
+// w        : The writer to write the snapshot to.
+// sequence : The last gateway sequence number, stored with the session ID so the session can be resumed.
+func (s *State) Save(w io.Writer, sequence int64) error {
+	if s == nil {
+		return ErrNilState
+	}
+
+	s.lockAll()
+	defer s.unlockAll()
+
+	return json.NewEncoder(w).Encode(&StateSnapshot{
+		Version:         StateSnapshotVersion,
+		SessionID:       s.SessionID,
+		Sequence:        sequence,
+		User:            s.User,
+		Guilds:          s.Guilds,
+		PrivateChannels: s.PrivateChannels,
+	})
+}
+
+// Load replaces the contents of the state with a snapshot written by Save,
+// and returns the snapshot so the session can be resumed.
+// Guilds are kept as loaded until their GUILD_CREATE is received, which
+// then replaces any stale data.
+// r : The reader to read the snapshot from.
+func (s *State) Load(r io.Reader) (*StateSnapshot, error) {
+	if s == nil {
+		return nil, ErrNilState
+	}
+
+	var snap StateSnapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return nil, err
+	}
+
+	if snap.Version != StateSnapshotVersion {
+		return nil, ErrSnapshotVersion
+	}
+
+	if snap.Guilds == nil {
+		snap.Guilds = []*Guild{}
+	}
+	if snap.PrivateChannels == nil {
+		snap.PrivateChannels = []*Channel{}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.clear()
+
+	s.Ready = Ready{
+		SessionID:       snap.SessionID,
+		User:            snap.User,
+		Guilds:          snap.Guilds,
+		PrivateChannels: snap.PrivateChannels,
+	}
+
+	s.setMyID(snap.User)
+
+	for _, g := range s.Guilds {
+		setGuildIds(g)
+		s.guildMap.Store(g.ID, g)
+		s.createMemberMap(g)
+
+		lock := s.shard(g.ID)
+		lock.Lock()
+		s.resetMemberLRU(g, time.Now())
+		s.indexGuild(g)
+		lock.Unlock()
+
+		for _, c := range g.Channels {
+			s.storeChannel(c)
+		}
+	}
+
+	for _, c := range s.PrivateChannels {
+		s.storeChannel(c)
+	}
+
+	return &snap, nil
+}
+
+// clear removes everything from the lookup maps of the state.
+func (s *State) clear() {
+	for _, m := range []*sync.Map{&s.guildMap, &s.channelMap, &s.shardIDMap, &s.memberMap, &s.userMap, &s.lruMap, &s.indexMap} {
+		m.Range(func(k, _ interface{}) bool {
+			m.Delete(k)
+			return true
+		})
+	}
+}
+
+// SaveState writes a snapshot of the session's state, including the
+// information needed to resume the gateway session, to the file at path.
+// path : The path of the snapshot file.
+func (s *Session) SaveState(path string) error {
+	state, ok := s.State.(*State)
+	if !ok {
+		return ErrSnapshotUnsupported
+	}
+
+	// Written to a temporary file first, so a crash never leaves a partial snapshot.
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+
+	err = state.Save(f, atomic.LoadInt64(s.sequence))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// LoadState loads a snapshot written by SaveState into the session's state.
+// It must be called before Open, which then tries to resume the saved
+// gateway session instead of identifying again.
+// path : The path of the snapshot file.
+func (s *Session) LoadState(path string) error {
+	state, ok := s.State.(*State)
+	if !ok {
+		return ErrSnapshotUnsupported
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	snap, err := state.Load(f)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range snap.Guilds {
+		s.setSession(g)
+	}
+
+	s.Lock()
+	s.sessionID = snap.SessionID
+	s.Unlock()
+	atomic.StoreInt64(s.sequence, snap.Sequence)
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package discordgo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func newSnapshotState(t *testing.T) (*State, *Session) {
+	se := &Session{StateEnabled: true}
+	state := NewState()
+
+	err := state.onReady(se, &Ready{
+		SessionID: "session",
+		User:      &User{ID: "bot"},
+		Guilds: []*Guild{{
+			ID:          "1",
+			Name:        "guild",
+			Roles:       []*Role{{ID: "1", Name: "@everyone"}},
+			Channels:    []*Channel{{ID: "10", Name: "general"}, {ID: "11", Name: "old"}},
+			Members:     []*Member{{User: &User{ID: "bot"}}, {User: &User{ID: "100", Username: "left"}}},
+			VoiceStates: []*VoiceState{{UserID: "bot", ChannelID: "10"}},
+		}, {
+			ID:   "2",
+			Name: "removed",
+		}},
+		PrivateChannels: []*Channel{{ID: "20", Type: ChannelTypeDM}},
+	})
+	if err != nil {
+		t.Fatalf("onReady returned error: %+v", err)
+	}
+
+	return state, se
+}
+
+func TestStateSnapshot(t *testing.T) {
+	state, _ := newSnapshotState(t)
+
+	var buf bytes.Buffer
+	if err := state.Save(&buf, 42); err != nil {
+		t.Fatalf("Save returned error: %+v", err)
+	}
+
+	loaded := NewState()
+	snap, err := loaded.Load(&buf)
+	if err != nil {
+		t.Fatalf("Load returned error: %+v", err)
+	}
+
+	if snap.SessionID != "session" || snap.Sequence != 42 {
+		t.Errorf("resume information was not restored: %+v", snap)
+	}
+	if loaded.MyUser().ID != "bot" {
+		t.Errorf("user was not restored: %+v", loaded.MyUser())
+	}
+
+	g, err := loaded.Guild("1")
+	if err != nil || g.Name != "guild" || len(g.VoiceStates) != 1 {
+		t.Fatalf("guild was not restored: %+v, %+v", g, err)
+	}
+	if _, err = loaded.Role("1", "1"); err != nil {
+		t.Errorf("role was not restored: %+v", err)
+	}
+	if c, err := loaded.Channel("10"); err != nil || c.GuildID != "1" {
+		t.Errorf("channel was not restored: %+v, %+v", c, err)
+	}
+	if _, err = loaded.Channel("20"); err != nil {
+		t.Errorf("private channel was not restored: %+v", err)
+	}
+	if m, err := loaded.Member("1", "100"); err != nil || m.GuildID != "1" {
+		t.Errorf("member was not restored: %+v, %+v", m, err)
+	}
+	if _, err = loaded.GetUser("100"); err != nil {
+		t.Errorf("user was not restored: %+v", err)
+	}
+}
+
+func TestStateSnapshotReconcile(t *testing.T) {
+	state, _ := newSnapshotState(t)
+
+	var buf bytes.Buffer
+	state.Save(&buf, 1)
+
+	se := &Session{StateEnabled: true}
+	loaded := NewState()
+	if _, err := loaded.Load(&buf); err != nil {
+		t.Fatalf("Load returned error: %+v", err)
+	}
+
+	err := loaded.onReady(se, &Ready{
+		SessionID: "new",
+		User:      &User{ID: "bot"},
+		Guilds:    []*Guild{{ID: "1", Unavailable: true}},
+	})
+	if err != nil {
+		t.Fatalf("onReady returned error: %+v", err)
+	}
+
+	if g, err := loaded.Guild("1"); err != nil || g.Name != "guild" {
+		t.Errorf("loaded guild should be kept until its GUILD_CREATE, got %+v, %+v", g, err)
+	}
+	if _, err = loaded.Guild("2"); err != ErrStateNotFound {
+		t.Errorf("guild missing from READY should be dropped, got %+v", err)
+	}
+
+	err = loaded.GuildAdd(&Guild{
+		ID:       "1",
+		Name:     "renamed",
+		Channels: []*Channel{{ID: "10", Name: "general", GuildID: "1"}},
+		Members:  []*Member{{GuildID: "1", User: &User{ID: "bot"}}},
+	}, se)
+	if err != nil {
+		t.Fatalf("GuildAdd returned error: %+v", err)
+	}
+
+	if g, _ := loaded.Guild("1"); g.Name != "renamed" {
+		t.Errorf("guild should be updated by GUILD_CREATE, got %q", g.Name)
+	}
+	if _, err = loaded.Channel("11"); err != ErrStateNotFound {
+		t.Errorf("stale channel should be dropped, got %+v", err)
+	}
+	if _, err = loaded.Member("1", "100"); err != ErrStateNotFound {
+		t.Errorf("stale member should be dropped, got %+v", err)
+	}
+	if _, err = loaded.GetUser("100"); err != ErrStateNotFound {
+		t.Errorf("stale user should be dropped, got %+v", err)
+	}
+}
+
+func TestStateSnapshotVersion(t *testing.T) {
+	_, err := NewState().Load(strings.NewReader(`{"version":0}`))
+	if err != ErrSnapshotVersion {
+		t.Errorf("Load should return ErrSnapshotVersion, got %+v", err)
+	}
+}
+
+func TestSessionSaveState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discordgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	s, _ := New()
+	state, _ := newSnapshotState(t)
+	s.State = state
+	atomic.StoreInt64(s.sequence, 7)
+
+	if err = s.SaveState(path); err != nil {
+		t.Fatalf("SaveState returned error: %+v", err)
+	}
+
+	restored, _ := New()
+	if err = restored.LoadState(path); err != nil {
+		t.Fatalf("LoadState returned error: %+v", err)
+	}
+
+	if restored.sessionID != "session" || atomic.LoadInt64(restored.sequence) != 7 {
+		t.Errorf("session should resume session at 7, got %q at %d", restored.sessionID, atomic.LoadInt64(restored.sequence))
+	}
+	if g, err := restored.State.Guild("1"); err != nil || g.Session != restored {
+		t.Errorf("restored guild should belong to the session, got %+v, %+v", g, err)
+	}
+}
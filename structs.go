@@ -99,6 +99,14 @@ type Session struct {
 	// Represents a cache for the REST API
 	RESTCache RestCache
 
+	// When set, every raw gateway payload is written to the recorder
+	// so it can be replayed later with an EventReplayer.
+	Recorder *EventRecorder
+
+	// When set, invite uses are tracked to send a GuildMemberJoinedViaInvite
+	// event after every GuildMemberAdd event.
+	InviteTracker *InviteTracker
+
 	// Event handlers
 	handlersMu   sync.RWMutex
 	handlers     map[string][]*eventHandlerInstance
@@ -240,6 +248,9 @@ type Presence struct {
 	Nick   string   `json:"nick"`
 	Roles  []string `json:"roles"`
 	Since  *int     `json:"since"`
+
+	// All of the user's current activities, Game is only the first of them
+	Activities []*Activity `json:"activities"`
 }
 
 // GameType is the type of "game" (see GameType* consts) in the Game struct
@@ -264,7 +275,91 @@ type Game struct {
 	Assets        Assets     `json:"assets,omitempty"`
 	ApplicationID string     `json:"application_id,omitempty"`
 	Instance      int8       `json:"instance,omitempty"`
-	// TODO: Party and Secrets (unknown structure)
+	Party         *Party     `json:"party,omitempty"`
+	Secrets       *Secrets   `json:"secrets,omitempty"`
+}
+
+// ActivityType is the type of an Activity (see ActivityType* consts)
+type ActivityType int
+
+// Valid ActivityType values
+const (
+	ActivityTypeGame ActivityType = iota
+	ActivityTypeStreaming
+	ActivityTypeListening
+	ActivityTypeWatching
+	ActivityTypeCustom
+	ActivityTypeCompeting
+)
+
+// ActivityFlags describe what a rich presence Activity supports
+type ActivityFlags int
+
+// Valid ActivityFlags values
+const (
+	ActivityFlagInstance ActivityFlags = 1 << iota
+	ActivityFlagJoin
+	ActivityFlagSpectate
+	ActivityFlagJoinRequest
+	ActivityFlagSync
+	ActivityFlagPlay
+)
+
+// An Activity holds a single activity of a user, such as the game they are
+// playing, the song they are listening to or their custom status.
+type Activity struct {
+	Name          string        `json:"name"`
+	Type          ActivityType  `json:"type"`
+	URL           string        `json:"url,omitempty"`
+	CreatedAt     int64         `json:"created_at,omitempty"`
+	Details       string        `json:"details,omitempty"`
+	State         string        `json:"state,omitempty"`
+	TimeStamps    *TimeStamps   `json:"timestamps,omitempty"`
+	Assets        *Assets       `json:"assets,omitempty"`
+	ApplicationID string        `json:"application_id,omitempty"`
+	Instance      bool          `json:"instance,omitempty"`
+	Flags         ActivityFlags `json:"flags,omitempty"`
+
+	// The emoji of a custom status (ActivityTypeCustom), the text of
+	// a custom status is held in State
+	Emoji *Emoji `json:"emoji,omitempty"`
+
+	Party   *Party   `json:"party,omitempty"`
+	Secrets *Secrets `json:"secrets,omitempty"`
+
+	// The labels of the buttons shown on the rich presence
+	Buttons []string `json:"buttons,omitempty"`
+}
+
+// A Party struct holds the party of a rich presence Activity
+type Party struct {
+	ID string `json:"id,omitempty"`
+
+	// The current and maximum size of the party, in that order
+	Size []int `json:"size,omitempty"`
+}
+
+// CurrentSize returns the number of users in the party, or 0 if it is not sent.
+func (p *Party) CurrentSize() int {
+	if len(p.Size) < 1 {
+		return 0
+	}
+	return p.Size[0]
+}
+
+// MaxSize returns the maximum number of users in the party, or 0 if it is not sent.
+func (p *Party) MaxSize() int {
+	if len(p.Size) < 2 {
+		return 0
+	}
+	return p.Size[1]
+}
+
+// A Secrets struct holds the secrets used to join and spectate a rich presence Activity
+type Secrets struct {
+	Join     string `json:"join,omitempty"`
+	Spectate string `json:"spectate,omitempty"`
+	Match    string `json:"match,omitempty"`
 }
 
 // A TimeStamps struct contains start and end times used in the rich presence "playing .." Game
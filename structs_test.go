@@ -0,0 +1,70 @@
+package discordgo
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPresenceActivities(t *testing.T) {
+	s := &Session{StateEnabled: true}
+	state := NewState()
+	if err := state.GuildAdd(&Guild{ID: "1"}, s); err != nil {
+		t.Fatalf("GuildAdd returned error: %+v", err)
+	}
+
+	var p PresenceUpdate
+	err := json.Unmarshal([]byte(`{
+		"guild_id": "1",
+		"user": {"id": "2"},
+		"status": "online",
+		"roles": [],
+		"game": {"name": "Custom Status", "type": 4, "state": "busy"},
+		"activities": [
+			{"name": "Custom Status", "type": 4, "state": "busy", "emoji": {"name": "🔥"}, "created_at": 1590000000000},
+			{"name": "Game", "type": 0, "flags": 3, "party": {"id": "p", "size": [2, 4]}, "secrets": {"join": "j"}, "buttons": ["Watch"]}
+		]
+	}`), &p)
+	if err != nil {
+		t.Fatalf("error unmarshalling presence: %+v", err)
+	}
+
+	if len(p.Activities) != 2 {
+		t.Fatalf("expected 2 activities, got %d", len(p.Activities))
+	}
+
+	custom := p.Activities[0]
+	if custom.Type != ActivityTypeCustom || custom.State != "busy" || custom.Emoji == nil || custom.Emoji.Name != "🔥" {
+		t.Errorf("custom status was not unmarshalled: %+v", custom)
+	}
+
+	game := p.Activities[1]
+	if game.Party == nil || game.Party.CurrentSize() != 2 || game.Party.MaxSize() != 4 {
+		t.Errorf("party was not unmarshalled: %+v", game.Party)
+	}
+	if game.Secrets == nil || game.Secrets.Join != "j" {
+		t.Errorf("secrets were not unmarshalled: %+v", game.Secrets)
+	}
+	if game.Flags&ActivityFlagJoin == 0 || len(game.Buttons) != 1 {
+		t.Errorf("flags and buttons were not unmarshalled: %+v", game)
+	}
+
+	if err = state.OnInterface(s, &p); err != nil {
+		t.Fatalf("OnInterface returned error: %+v", err)
+	}
+
+	update := &PresenceUpdate{
+		Presence: Presence{User: &User{ID: "2"}, Activities: p.Activities[1:]},
+		GuildID:  "1",
+	}
+	if err = state.OnInterface(s, update); err != nil {
+		t.Fatalf("OnInterface returned error: %+v", err)
+	}
+
+	presence, err := state.Presence("1", "2")
+	if err != nil {
+		t.Fatalf("presence was not added to the state: %+v", err)
+	}
+	if len(presence.Activities) != 1 || presence.Activities[0].Name != "Game" {
+		t.Errorf("state should hold the latest activities, got %+v", presence.Activities)
+	}
+}
@@ -10,9 +10,11 @@
 package discordgo
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"strconv"
 	"strings"
@@ -20,13 +22,15 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
-	"golang.org/x/crypto/nacl/secretbox"
 )
 
 // ------------------------------------------------------------------------------------------------
 // Code related to both VoiceConnection Websocket and UDP connections.
 // ------------------------------------------------------------------------------------------------
 
+// VoiceGatewayVersion is the voice gateway version used for voice websockets.
+const VoiceGatewayVersion = "8"
+
 // A VoiceConnection struct holds all the data and functions related to a Discord Voice Connection.
 type VoiceConnection struct {
 	sync.RWMutex
@@ -45,6 +49,26 @@ type VoiceConnection struct {
 	OpusSend chan []byte  // Chan for sending opus audio
 	OpusRecv chan *Packet // Chan for receiving opus audio
 
+	// The flags sent when speaking, SpeakingMicrophone when not set
+	SpeakingFlags SpeakingFlags
+
+	// The external address of the udp connection, used when it can't be
+	// discovered such as behind some NATs. The port of the udp connection is
+	// used when ExternalPort is not set. They must be set before connecting.
+	ExternalIP   string
+	ExternalPort int
+
+	// The sample rate and frame size of the audio sent on OpusSend, 48000
+	// and 960 when not set. They must be set before connecting.
+	SampleRate int
+	FrameSize  int
+
+	// Stores the last voice HeartbeatAck that was received (in UTC)
+	LastHeartbeatAck time.Time
+
+	// Stores the last voice Heartbeat sent (in UTC)
+	LastHeartbeatSent time.Time
+
 	wsConn  *websocket.Conn
 	wsMutex sync.Mutex
 	udpConn *net.UDPConn
@@ -57,6 +81,28 @@ type VoiceConnection struct {
 	// Used to send a close signal to goroutines
 	close chan struct{}
 
+	// Used to send a close signal to the goroutines of the websocket only,
+	// so that it can be replaced when resuming
+	wsClose chan struct{}
+
+	// The nonce of the last heartbeat sent, and the latency of its ACK
+	heartbeatNonce int64
+	latency        time.Duration
+
+	// The last sequence received, acknowledged by heartbeats and resumes
+	sequence int64
+
+	// If true, the voice websocket is resuming the session
+	resuming bool
+
+	// The users sending audio with an SSRC, and the users whose audio is
+	// received with ReceiveUser
+	ssrcUsers   map[uint32]string
+	userStreams map[string]*voiceStream
+
+	// The flags of the users speaking
+	speakingUsers map[string]SpeakingFlags
+
 	// Used to allow blocking until connected
 	connected chan bool
 
@@ -66,7 +112,22 @@ type VoiceConnection struct {
 	op4 voiceOP4
 	op2 voiceOP2
 
-	voiceSpeakingUpdateHandlers []VoiceSpeakingUpdateHandler
+	// The cipher of the encryption mode negotiated with the voice server
+	cipher voiceCipher
+
+	// The RTP sequence and timestamp of the next packet sent, and the time
+	// the last packet was sent, kept so that the audio sent continues after
+	// a reconnection or a migration
+	sendSequence  uint16
+	sendTimestamp uint32
+	lastSent      time.Time
+
+	// The endpoint of the voice server the connection is migrating from
+	migratedFrom string
+
+	voiceHandlers []*voiceHandler
+
+	stats VoiceStats
 }
 
 // VoiceSpeakingUpdateHandler type provides a function definition for the
@@ -75,15 +136,37 @@ type VoiceSpeakingUpdateHandler func(vc *VoiceConnection, vs *VoiceSpeakingUpdat
 
 // Speaking sends a speaking notification to Discord over the voice websocket.
 // This must be sent as true prior to sending audio and should be set to false
-// once finished sending audio.
+// once finished sending audio. The flags sent when speaking are
+// SpeakingFlags, or SpeakingMicrophone if not set.
 //  b  : Send true if speaking, false if not.
 func (v *VoiceConnection) Speaking(b bool) (err error) {
 
-	v.log(LogDebug, "called (%t)", b)
+	var flags SpeakingFlags
+	if b {
+		v.RLock()
+		flags = v.SpeakingFlags
+		v.RUnlock()
+
+		if flags == 0 {
+			flags = SpeakingMicrophone
+		}
+	}
+
+	return v.SetSpeaking(flags)
+}
+
+// SetSpeaking sends a speaking notification with flags to Discord over the
+// voice websocket, such as to speak with priority. No flags means not
+// speaking.
+// flags : The speaking flags.
+func (v *VoiceConnection) SetSpeaking(flags SpeakingFlags) (err error) {
+
+	v.log(LogDebug, "called (%d)", flags)
 
 	type voiceSpeakingData struct {
-		Speaking bool `json:"speaking"`
-		Delay    int  `json:"delay"`
+		Speaking SpeakingFlags `json:"speaking"`
+		Delay    int           `json:"delay"`
+		SSRC     uint32        `json:"ssrc"`
 	}
 
 	type voiceSpeakingOp struct {
@@ -91,13 +174,17 @@ func (v *VoiceConnection) Speaking(b bool) (err error) {
 		Data voiceSpeakingData `json:"d"`
 	}
 
-	if v.wsConn == nil {
+	v.RLock()
+	wsConn := v.wsConn
+	data := voiceSpeakingOp{5, voiceSpeakingData{flags, 0, v.op2.SSRC}}
+	v.RUnlock()
+
+	if wsConn == nil {
 		return fmt.Errorf("no VoiceConnection websocket")
 	}
 
-	data := voiceSpeakingOp{5, voiceSpeakingData{b, 0}}
 	v.wsMutex.Lock()
-	err = v.wsConn.WriteJSON(data)
+	err = wsConn.WriteJSON(data)
 	v.wsMutex.Unlock()
 
 	v.Lock()
@@ -108,11 +195,20 @@ func (v *VoiceConnection) Speaking(b bool) (err error) {
 		return
 	}
 
-	v.speaking = b
+	v.speaking = flags != 0
 
 	return
 }
 
+// HeartbeatLatency returns the latency between the last acknowledged voice
+// heartbeat and its acknowledgement.
+func (v *VoiceConnection) HeartbeatLatency() time.Duration {
+	v.RLock()
+	defer v.RUnlock()
+
+	return v.latency
+}
+
 // ChangeChannel sends Discord a request to change channels within a Guild
 // !!! NOTE !!! This function may be removed in favour of just using ChannelVoiceJoin
 func (v *VoiceConnection) ChangeChannel(channelID string, mute, deaf bool) (err error) {
@@ -161,14 +257,50 @@ func (v *VoiceConnection) Disconnect() (err error) {
 
 // Close closes the voice ws and udp connections
 func (v *VoiceConnection) Close() {
+	v.closeWith(nil)
+}
+
+// closeWith closes the voice ws and udp connections, and sends a
+// VoiceDisconnected event with reason if they were open.
+func (v *VoiceConnection) closeWith(reason error) {
 
 	v.log(LogInformational, "called")
 
+	if v.closeConnections() {
+		v.emit(&VoiceDisconnected{Reason: reason})
+	}
+}
+
+// closeConnections closes the voice ws and udp connections, and returns
+// whether they were open.
+func (v *VoiceConnection) closeConnections() (open bool) {
+
+	open, wsConn := v.detachConnections()
+	if wsConn != nil {
+		v.closeWebsocket(wsConn)
+	}
+
+	return
+}
+
+// detachConnections closes the voice udp connection and detaches the voice
+// websocket, which is returned to be closed with closeWebsocket. It returns
+// whether the connections were open.
+func (v *VoiceConnection) detachConnections() (open bool, wsConn *websocket.Conn) {
+
 	v.Lock()
 	defer v.Unlock()
 
+	open = v.close != nil || v.wsConn != nil
+
 	v.Ready = false
 	v.speaking = false
+	v.resuming = false
+
+	if v.wsClose != nil {
+		close(v.wsClose)
+		v.wsClose = nil
+	}
 
 	if v.close != nil {
 		v.log(LogInformational, "closing v.close")
@@ -185,44 +317,67 @@ func (v *VoiceConnection) Close() {
 		v.udpConn = nil
 	}
 
-	if v.wsConn != nil {
-		v.log(LogInformational, "sending close frame")
+	wsConn, v.wsConn = v.wsConn, nil
 
-		// To cleanly close a connection, a client should send a close
-		// frame and wait for the server to close the connection.
-		v.wsMutex.Lock()
-		err := v.wsConn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
-		v.wsMutex.Unlock()
-		if err != nil {
-			v.log(LogError, "error closing websocket, %s", err)
-		}
+	return
+}
 
-		// TODO: Wait for Discord to actually close the connection.
-		time.Sleep(1 * time.Second)
+// closeWebsocket cleanly closes a voice websocket detached from the voice
+// connection. The voice connection must not be locked.
+func (v *VoiceConnection) closeWebsocket(wsConn *websocket.Conn) {
 
-		v.log(LogInformational, "closing websocket")
-		err = v.wsConn.Close()
-		if err != nil {
-			v.log(LogError, "error closing websocket, %s", err)
-		}
+	v.log(LogInformational, "sending close frame")
 
-		v.wsConn = nil
+	// To cleanly close a connection, a client should send a close
+	// frame and wait for the server to close the connection.
+	v.wsMutex.Lock()
+	err := wsConn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	v.wsMutex.Unlock()
+	if err != nil {
+		v.log(LogError, "error closing websocket, %s", err)
+	}
+
+	// TODO: Wait for Discord to actually close the connection.
+	time.Sleep(1 * time.Second)
+
+	v.log(LogInformational, "closing websocket")
+	err = wsConn.Close()
+	if err != nil {
+		v.log(LogError, "error closing websocket, %s", err)
 	}
 }
 
-// AddHandler adds a Handler for VoiceSpeakingUpdate events.
-func (v *VoiceConnection) AddHandler(h VoiceSpeakingUpdateHandler) {
-	v.Lock()
-	defer v.Unlock()
+// SpeakingFlags are the flags of a speaking notification, telling how a user
+// is speaking.
+type SpeakingFlags int
+
+// Speaking flags, which can be combined.
+const (
+	SpeakingMicrophone SpeakingFlags = 1 << iota // Normal audio
+	SpeakingSoundshare                           // Audio of a shared screen, without speaking indicator
+	SpeakingPriority                             // Priority speaker, lowering the volume of other users
+)
+
+// UnmarshalJSON unmarshals the flags, or the bool sent by older voice gateway
+// versions as SpeakingMicrophone.
+func (f *SpeakingFlags) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		*f = 0
+		if b {
+			*f = SpeakingMicrophone
+		}
+		return nil
+	}
 
-	v.voiceSpeakingUpdateHandlers = append(v.voiceSpeakingUpdateHandlers, h)
+	return json.Unmarshal(data, (*int)(f))
 }
 
 // VoiceSpeakingUpdate is a struct for a VoiceSpeakingUpdate event.
 type VoiceSpeakingUpdate struct {
-	UserID   string `json:"user_id"`
-	SSRC     int    `json:"ssrc"`
-	Speaking bool   `json:"speaking"`
+	UserID   string        `json:"user_id"`
+	SSRC     int           `json:"ssrc"`
+	Speaking SpeakingFlags `json:"speaking"`
 }
 
 // ------------------------------------------------------------------------------------------------
@@ -230,12 +385,31 @@ type VoiceSpeakingUpdate struct {
 // ------------------------------------------------------------------------------------------------
 
 // A voiceOP4 stores the data for the voice operation 4 websocket event
-// which provides us with the NaCl SecretBox encryption key
+// which provides us with the encryption mode and key
 type voiceOP4 struct {
 	SecretKey [32]byte `json:"secret_key"`
 	Mode      string   `json:"mode"`
 }
 
+// A voiceEvent is a message received over the voice websocket.
+type voiceEvent struct {
+	Operation int             `json:"op"`
+	Sequence  *int64          `json:"seq"`
+	RawData   json.RawMessage `json:"d"`
+}
+
+// A voiceOP8 stores the data for the voice operation 8 websocket event
+// which is sent first on every voice websocket
+type voiceOP8 struct {
+	HeartbeatInterval float64 `json:"heartbeat_interval"`
+}
+
+// A voiceOP13 stores the data for the voice operation 13 websocket event
+// which is sent when a user leaves the voice channel
+type voiceOP13 struct {
+	UserID string `json:"user_id"`
+}
+
 // A voiceOP2 stores the data for the voice operation 2 websocket event
 // which is sort of like the voice READY packet
 type voiceOP2 struct {
@@ -277,6 +451,11 @@ func (v *VoiceConnection) open() (err error) {
 
 	v.log(LogInformational, "called")
 
+	v.RLock()
+	endpoint := v.endpoint
+	v.RUnlock()
+	v.emit(&VoiceConnecting{Endpoint: endpoint})
+
 	v.Lock()
 	defer v.Unlock()
 
@@ -300,7 +479,7 @@ func (v *VoiceConnection) open() (err error) {
 	}
 
 	// Connect to VoiceConnection Websocket
-	vg := "wss://" + strings.TrimSuffix(v.endpoint, ":80")
+	vg := voiceGatewayURL(v.endpoint)
 	v.log(LogInformational, "connecting to voice endpoint %s", vg)
 	v.wsConn, _, err = websocket.DefaultDialer.Dial(vg, nil)
 	if err != nil {
@@ -327,8 +506,10 @@ func (v *VoiceConnection) open() (err error) {
 		return
 	}
 
+	v.sequence = -1
 	v.close = make(chan struct{})
-	go v.wsListen(v.wsConn, v.close)
+	v.wsClose = make(chan struct{})
+	go v.wsListen(v.wsConn, v.wsClose)
 
 	// add loop/check for Ready bool here?
 	// then return false if not ready?
@@ -337,6 +518,28 @@ func (v *VoiceConnection) open() (err error) {
 	return
 }
 
+// voiceGatewayURL returns the websocket URL of a voice endpoint.
+func voiceGatewayURL(endpoint string) string {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "wss://" + strings.TrimSuffix(endpoint, ":80")
+	}
+
+	return endpoint + "/?v=" + VoiceGatewayVersion
+}
+
+// voiceResumable returns whether a voice session can be resumed after its
+// websocket closed with err.
+func voiceResumable(err error) bool {
+	if ce, ok := err.(*websocket.CloseError); ok {
+		switch ce.Code {
+		case 4004, 4006, 4009, 4014: // Authentication failed, session no longer valid, session timeout, disconnected
+			return false
+		}
+	}
+
+	return true
+}
+
 // wsListen listens on the voice websocket for messages and passes them
 // to the voice event handler.  This is automatically called by the Open func
 func (v *VoiceConnection) wsListen(wsConn *websocket.Conn, close <-chan struct{}) {
@@ -344,20 +547,26 @@ func (v *VoiceConnection) wsListen(wsConn *websocket.Conn, close <-chan struct{}
 	v.log(LogInformational, "called")
 
 	for {
-		_, message, err := v.wsConn.ReadMessage()
+		_, message, err := wsConn.ReadMessage()
 		if err != nil {
 			// Detect if we have been closed manually. If a Close() has already
 			// happened, the websocket we are listening on will be different to the
 			// current session.
 			v.RLock()
 			sameConnection := v.wsConn == wsConn
+			resuming := v.resuming
 			v.RUnlock()
 			if sameConnection {
 
 				v.log(LogError, "voice endpoint %s websocket closed unexpectantly, %s", v.endpoint, err)
 
-				// Start reconnect goroutine then exit.
-				go v.reconnect()
+				// Try to resume the session, unless that is what failed,
+				// otherwise start reconnect goroutine then exit.
+				if !resuming && voiceResumable(err) {
+					go v.resume()
+				} else {
+					go v.reconnect(err)
+				}
 			}
 			return
 		}
@@ -378,12 +587,20 @@ func (v *VoiceConnection) onEvent(message []byte) {
 
 	v.log(LogDebug, "received: %s", string(message))
 
-	var e Event
+	var e voiceEvent
 	if err := json.Unmarshal(message, &e); err != nil {
 		v.log(LogError, "unmarshall error, %s", err)
 		return
 	}
 
+	if e.Sequence != nil {
+		v.Lock()
+		if *e.Sequence > v.sequence {
+			v.sequence = *e.Sequence
+		}
+		v.Unlock()
+	}
+
 	switch e.Operation {
 
 	case 2: // READY
@@ -393,37 +610,40 @@ func (v *VoiceConnection) onEvent(message []byte) {
 			return
 		}
 
-		// Start the voice websocket heartbeat to keep the connection alive
-		go v.wsHeartbeat(v.wsConn, v.close, v.op2.HeartbeatInterval)
-		// TODO monitor a chan/bool to verify this was successful
-
-		// Start the UDP connection
+		// Start the UDP connection, the audio is sent and received
+		// once the encryption key is received in OP4
 		err := v.udpOpen()
 		if err != nil {
 			v.log(LogError, "error opening udp connection, %s", err)
 			return
 		}
 
-		// Start the opusSender.
-		// TODO: Should we allow 48000/960 values to be user defined?
-		if v.OpusSend == nil {
-			v.OpusSend = make(chan []byte, 2)
-		}
-		go v.opusSender(v.udpConn, v.close, v.OpusSend, 48000, 960)
+		return
 
-		// Start the opusReceiver
-		if !v.deaf {
-			if v.OpusRecv == nil {
-				v.OpusRecv = make(chan *Packet, 2)
-			}
+	case 3, 6: // HEARTBEAT ACK, which was op 3 before voice gateway v4
+		v.onHeartbeatAck(e.RawData)
+		return
 
-			go v.opusReceiver(v.udpConn, v.close, v.OpusRecv)
+	case 8: // HELLO
+		var h voiceOP8
+		if err := json.Unmarshal(e.RawData, &h); err != nil {
+			v.log(LogError, "OP8 unmarshall error, %s, %s", err, string(e.RawData))
+			return
 		}
 
+		// Start the voice websocket heartbeat to keep the connection alive
+		v.RLock()
+		wsConn, wsClose := v.wsConn, v.wsClose
+		v.RUnlock()
+		go v.wsHeartbeat(wsConn, wsClose, time.Duration(h.HeartbeatInterval*float64(time.Millisecond)))
 		return
 
-	case 3: // HEARTBEAT response
-		// add code to use this to track latency?
+	case 9: // RESUMED
+		v.Lock()
+		v.resuming = false
+		v.Unlock()
+
+		v.log(LogInformational, "resumed voice session on %s", v.endpoint)
 		return
 
 	case 4: // udp encryption secret key
@@ -435,22 +655,49 @@ func (v *VoiceConnection) onEvent(message []byte) {
 			v.log(LogError, "OP4 unmarshall error, %s, %s", err, string(e.RawData))
 			return
 		}
-		return
 
-	case 5:
-		if len(v.voiceSpeakingUpdateHandlers) == 0 {
+		var err error
+		v.cipher, err = newVoiceCipher(v.op4.Mode, v.op4.SecretKey)
+		if err != nil {
+			v.log(LogError, "error creating voice cipher, %s", err)
 			return
 		}
 
+		// Start the opusSender.
+		if v.OpusSend == nil {
+			v.OpusSend = make(chan []byte, 2)
+		}
+		rate, size := v.audioFormat()
+		go v.opusSender(v.udpConn, v.close, v.OpusSend, rate, size)
+
+		// Start the opusReceiver
+		if !v.deaf {
+			if v.OpusRecv == nil {
+				v.OpusRecv = make(chan *Packet, 2)
+			}
+
+			go v.opusReceiver(v.udpConn, v.close, v.OpusRecv)
+		}
+		return
+
+	case 5:
 		voiceSpeakingUpdate := &VoiceSpeakingUpdate{}
 		if err := json.Unmarshal(e.RawData, voiceSpeakingUpdate); err != nil {
 			v.log(LogError, "OP5 unmarshall error, %s, %s", err, string(e.RawData))
 			return
 		}
+		v.setSSRCUser(uint32(voiceSpeakingUpdate.SSRC), voiceSpeakingUpdate.UserID)
+		v.setSpeakingUser(voiceSpeakingUpdate.UserID, voiceSpeakingUpdate.Speaking)
 
-		for _, h := range v.voiceSpeakingUpdateHandlers {
-			h(v, voiceSpeakingUpdate)
+		v.emit(voiceSpeakingUpdate)
+
+	case 13: // CLIENT DISCONNECT
+		var op13 voiceOP13
+		if err := json.Unmarshal(e.RawData, &op13); err != nil {
+			v.log(LogError, "OP13 unmarshall error, %s, %s", err, string(e.RawData))
+			return
 		}
+		v.removeUser(op13.UserID)
 
 	default:
 		v.log(LogDebug, "unknown voice operation, %d, %s", e.Operation, string(e.RawData))
@@ -459,9 +706,40 @@ func (v *VoiceConnection) onEvent(message []byte) {
 	return
 }
 
+type voiceHeartbeatData struct {
+	Nonce  int64 `json:"t"`
+	SeqAck int64 `json:"seq_ack"`
+}
+
 type voiceHeartbeatOp struct {
-	Op   int `json:"op"` // Always 3
-	Data int `json:"d"`
+	Op   int                `json:"op"` // Always 3
+	Data voiceHeartbeatData `json:"d"`
+}
+
+// onHeartbeatAck measures the latency of a voice heartbeat once its nonce is
+// acknowledged.
+func (v *VoiceConnection) onHeartbeatAck(data json.RawMessage) {
+
+	var ack voiceHeartbeatData
+	if err := json.Unmarshal(data, &ack); err != nil {
+		// Before voice gateway v8 the nonce is sent by itself
+		if err = json.Unmarshal(data, &ack.Nonce); err != nil {
+			v.log(LogError, "heartbeat ACK unmarshall error, %s, %s", err, string(data))
+			return
+		}
+	}
+
+	v.Lock()
+	defer v.Unlock()
+
+	if ack.Nonce != v.heartbeatNonce {
+		v.log(LogWarning, "got heartbeat ACK with nonce %d, expected %d", ack.Nonce, v.heartbeatNonce)
+		return
+	}
+
+	v.LastHeartbeatAck = time.Now().UTC()
+	v.latency = v.LastHeartbeatAck.Sub(v.LastHeartbeatSent)
+	v.log(LogDebug, "got heartbeat ACK, latency %s", v.latency)
 }
 
 // NOTE :: When a guild voice server changes how do we shut this down
@@ -476,19 +754,37 @@ func (v *VoiceConnection) wsHeartbeat(wsConn *websocket.Conn, close <-chan struc
 		return
 	}
 
+	v.Lock()
+	v.LastHeartbeatAck = time.Now().UTC()
+	v.Unlock()
+
 	var err error
-	ticker := time.NewTicker(i * time.Millisecond)
+	ticker := time.NewTicker(i)
 	defer ticker.Stop()
 	for {
+		v.Lock()
+		last := v.LastHeartbeatAck
+		v.LastHeartbeatSent = time.Now().UTC()
+		v.heartbeatNonce = v.LastHeartbeatSent.UnixNano() / int64(time.Millisecond)
+		data := voiceHeartbeatOp{3, voiceHeartbeatData{v.heartbeatNonce, v.sequence}}
+		v.Unlock()
+
 		v.log(LogDebug, "sending heartbeat packet")
 		v.wsMutex.Lock()
-		err = wsConn.WriteJSON(voiceHeartbeatOp{3, int(time.Now().Unix())})
+		err = wsConn.WriteJSON(data)
 		v.wsMutex.Unlock()
 		if err != nil {
 			v.log(LogError, "error sending heartbeat to voice endpoint %s, %s", v.endpoint, err)
 			return
 		}
 
+		// Resume if the last 5 heartbeats were not acknowledged
+		if time.Now().UTC().Sub(last) > 5*i {
+			v.log(LogError, "haven't gotten a voice heartbeat ACK in %v, resuming", time.Now().UTC().Sub(last))
+			go v.resume()
+			return
+		}
+
 		select {
 		case <-ticker.C:
 			// continue loop and send heartbeat
@@ -505,7 +801,7 @@ func (v *VoiceConnection) wsHeartbeat(wsConn *websocket.Conn, close <-chan struc
 type voiceUDPData struct {
 	Address string `json:"address"` // Public IP of machine running this code
 	Port    uint16 `json:"port"`    // UDP Port of machine running this code
-	Mode    string `json:"mode"`    // always "xsalsa20_poly1305"
+	Mode    string `json:"mode"`    // One of VoiceModes
 }
 
 type voiceUDPD struct {
@@ -543,6 +839,12 @@ func (v *VoiceConnection) udpOpen() (err error) {
 		return fmt.Errorf("empty endpoint")
 	}
 
+	mode, err := selectVoiceMode(v.op2.Modes)
+	if err != nil {
+		v.log(LogWarning, "%s", err)
+		return
+	}
+
 	host := v.op2.IP + ":" + strconv.Itoa(v.op2.Port)
 	addr, err := net.ResolveUDPAddr("udp", host)
 	if err != nil {
@@ -557,48 +859,25 @@ func (v *VoiceConnection) udpOpen() (err error) {
 		return
 	}
 
-	// Create a 70 byte array and put the SSRC code from the Op 2 VoiceConnection event
-	// into it.  Then send that over the UDP connection to Discord
-	sb := make([]byte, 70)
-	binary.BigEndian.PutUint32(sb, v.op2.SSRC)
-	_, err = v.udpConn.Write(sb)
-	if err != nil {
-		v.log(LogWarning, "udp write error to %s, %s", addr.String(), err)
-		return
-	}
-
-	// Create a 70 byte array and listen for the initial handshake response
-	// from Discord.  Once we get it parse the IP and PORT information out
-	// of the response.  This should be our public IP and PORT as Discord
-	// saw us.
-	rb := make([]byte, 70)
-	rlen, _, err := v.udpConn.ReadFromUDP(rb)
+	// Discover our public IP and PORT as Discord sees us, or fall back to
+	// the address given by the user.
+	ip, port, err := voiceIPDiscovery(v.udpConn, v.op2.SSRC)
 	if err != nil {
-		v.log(LogWarning, "udp read error, %s, %s", addr.String(), err)
-		return
-	}
-
-	if rlen < 70 {
-		v.log(LogWarning, "received udp packet too small")
-		return fmt.Errorf("received udp packet too small")
-	}
+		if v.ExternalIP == "" {
+			v.log(LogWarning, "%s, %s", err, addr.String())
+			return
+		}
 
-	// Loop over position 4 through 20 to grab the IP address
-	// Should never be beyond position 20.
-	var ip string
-	for i := 4; i < 20; i++ {
-		if rb[i] == 0 {
-			break
+		v.log(LogWarning, "%s, using external address %s", err, v.ExternalIP)
+		ip, port = v.ExternalIP, uint16(v.ExternalPort)
+		if port == 0 {
+			port = uint16(v.udpConn.LocalAddr().(*net.UDPAddr).Port)
 		}
-		ip += string(rb[i])
 	}
 
-	// Grab port from position 68 and 69
-	port := binary.BigEndian.Uint16(rb[68:70])
-
 	// Take the data from above and send it back to Discord to finalize
 	// the UDP connection handshake.
-	data := voiceUDPOp{1, voiceUDPD{"udp", voiceUDPData{ip, port, "xsalsa20_poly1305"}}}
+	data := voiceUDPOp{1, voiceUDPD{"udp", voiceUDPData{ip, port, mode}}}
 
 	v.wsMutex.Lock()
 	err = v.wsConn.WriteJSON(data)
@@ -615,6 +894,65 @@ func (v *VoiceConnection) udpOpen() (err error) {
 	return
 }
 
+// The time to wait for an IP discovery response, and the number of
+// discovery requests sent.
+var (
+	voiceDiscoveryTimeout  = time.Second
+	voiceDiscoveryAttempts = 3
+)
+
+// voiceIPDiscovery discovers the external address of a udp connection to a
+// voice server, see
+// https://discord.com/developers/docs/topics/voice-connections#ip-discovery
+func voiceIPDiscovery(udpConn *net.UDPConn, ssrc uint32) (ip string, port uint16, err error) {
+
+	// The request holds the type, length of what follows and the SSRC, and
+	// has the room for the address and port of the response.
+	sb := make([]byte, 74)
+	binary.BigEndian.PutUint16(sb, 1)
+	binary.BigEndian.PutUint16(sb[2:], 70)
+	binary.BigEndian.PutUint32(sb[4:], ssrc)
+
+	defer udpConn.SetReadDeadline(time.Time{})
+
+	rb := make([]byte, 1024)
+	for i := 0; i < voiceDiscoveryAttempts; i++ {
+		if _, err = udpConn.Write(sb); err != nil {
+			return
+		}
+
+		udpConn.SetReadDeadline(time.Now().Add(voiceDiscoveryTimeout))
+		for {
+			var rlen int
+			rlen, err = udpConn.Read(rb)
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			}
+			if err != nil {
+				return
+			}
+
+			// Skip anything but the response to our request
+			if rlen < 74 || binary.BigEndian.Uint16(rb) != 2 || binary.BigEndian.Uint32(rb[4:]) != ssrc {
+				continue
+			}
+
+			// The address is null terminated
+			addr := rb[8:72]
+			if n := bytes.IndexByte(addr, 0); n >= 0 {
+				addr = addr[:n]
+			}
+			if net.ParseIP(string(addr)) == nil {
+				return "", 0, ErrVoiceIPDiscovery
+			}
+
+			return string(addr), binary.BigEndian.Uint16(rb[72:]), nil
+		}
+	}
+
+	return "", 0, ErrVoiceIPDiscovery
+}
+
 // udpKeepAlive sends a udp packet to keep the udp connection open
 // This is still a bit of a "proof of concept"
 func (v *VoiceConnection) udpKeepAlive(udpConn *net.UDPConn, close <-chan struct{}, i time.Duration) {
@@ -650,8 +988,30 @@ func (v *VoiceConnection) udpKeepAlive(udpConn *net.UDPConn, close <-chan struct
 	}
 }
 
+// opusSilenceFrame is a 20ms opus frame of silence.
+var opusSilenceFrame = []byte{0xF8, 0xFF, 0xFE}
+
+// voiceSilenceFrames is the number of silence frames sent once there is no
+// more audio to send, so that clients don't interpolate the end of it.
+const voiceSilenceFrames = 5
+
+// audioFormat returns the sample rate and frame size of the audio sent on
+// OpusSend. The voice connection must be locked.
+func (v *VoiceConnection) audioFormat() (rate, size int) {
+	rate, size = v.SampleRate, v.FrameSize
+	if rate == 0 {
+		rate = voiceSampleRate
+	}
+	if size == 0 {
+		size = voiceFrameSize
+	}
+	return
+}
+
 // opusSender will listen on the given channel and send any
 // pre-encoded opus audio to Discord.  Supposedly.
+// Once the channel is empty for a frame, it sends silence frames and stops
+// sending until there is audio again.
 func (v *VoiceConnection) opusSender(udpConn *net.UDPConn, close <-chan struct{}, opus <-chan []byte, rate, size int) {
 
 	if udpConn == nil || close == nil {
@@ -662,31 +1022,59 @@ func (v *VoiceConnection) opusSender(udpConn *net.UDPConn, close <-chan struct{}
 	// TODO: this needs reviewed as I think there must be a better way.
 	v.Lock()
 	v.Ready = true
+	ready := &VoiceReady{SSRC: v.op2.SSRC, Mode: v.op4.Mode}
+	migrated := v.migratedFrom
+	v.migratedFrom = ""
+	endpoint := v.endpoint
+
+	// Continue the audio sent before a reconnection or a migration
+	sequence, timestamp, last := v.sendSequence, v.sendTimestamp, v.lastSent
 	v.Unlock()
+
+	v.emit(ready)
+	if migrated != "" {
+		v.emit(&VoiceMigrated{OldEndpoint: migrated, Endpoint: endpoint})
+	}
+
 	defer func() {
 		v.Lock()
 		v.Ready = false
 		v.Unlock()
 	}()
 
-	var sequence uint16
-	var timestamp uint32
 	var recvbuf []byte
 	var ok bool
 	udpHeader := make([]byte, 12)
-	var nonce [24]byte
 
 	// build the parts that don't change in the udpHeader
 	udpHeader[0] = 0x80
 	udpHeader[1] = 0x78
 	binary.BigEndian.PutUint32(udpHeader[8:], v.op2.SSRC)
 
-	// start a send loop that loops until buf chan is closed
-	ticker := time.NewTicker(time.Millisecond * time.Duration(size/(rate/1000)))
-	defer ticker.Stop()
+	// The duration of a frame, and its length in the 48kHz clock of opus
+	// RTP timestamps
+	frame := time.Duration(size) * time.Second / time.Duration(rate)
+	samples := uint32(size * voiceSampleRate / rate)
+
+	// The ticker only runs while there is audio to send
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+
+	var silence int
+
+	// If true, the packet starts a burst of audio after a pause
+	var burst bool
+
 	for {
 
-		// Get data from chan.  If chan is closed, return.
+		// Get data from chan.  If chan is closed, return.  If there
+		// was no data for a frame, send a silence frame right away.
+		var onTick, audio bool
 		select {
 		case <-close:
 			return
@@ -694,17 +1082,52 @@ func (v *VoiceConnection) opusSender(udpConn *net.UDPConn, close <-chan struct{}
 			if !ok {
 				return
 			}
-			// else, continue loop
+			audio = true
+		case <-tick:
+			onTick = true
+
+			// Audio ready at the tick is sent before silence
+			select {
+			case recvbuf, ok = <-opus:
+				if !ok {
+					return
+				}
+				audio = true
+			default:
+			}
 		}
 
-		v.RLock()
-		speaking := v.speaking
-		v.RUnlock()
-		if !speaking {
-			err := v.Speaking(true)
-			if err != nil {
-				v.log(LogError, "error sending speaking packet, %s", err)
+		if audio {
+			if ticker == nil {
+				burst = true
+				err := v.Speaking(true)
+				if err != nil {
+					v.log(LogError, "error sending speaking packet, %s", err)
+				}
+
+				ticker = time.NewTicker(frame)
+				tick = ticker.C
+
+				// Keep the timestamp in time over the pause
+				if n := time.Since(last) / frame; !last.IsZero() && n > 1 {
+					timestamp += uint32(n-1) * samples
+				}
+			}
+
+			silence = voiceSilenceFrames
+		} else {
+			if silence == 0 {
+				ticker.Stop()
+				ticker, tick = nil, nil
+
+				if err := v.Speaking(false); err != nil {
+					v.log(LogError, "error sending speaking packet, %s", err)
+				}
+				continue
 			}
+
+			silence--
+			recvbuf = opusSilenceFrame
 		}
 
 		// Add sequence and timestamp to udpPacket
@@ -712,18 +1135,19 @@ func (v *VoiceConnection) opusSender(udpConn *net.UDPConn, close <-chan struct{}
 		binary.BigEndian.PutUint32(udpHeader[4:], timestamp)
 
 		// encrypt the opus data
-		copy(nonce[:], udpHeader)
 		v.RLock()
-		sendbuf := secretbox.Seal(udpHeader, recvbuf, &nonce, &v.op4.SecretKey)
+		sendbuf := v.cipher.seal(nil, udpHeader, recvbuf)
 		v.RUnlock()
 
 		// block here until we're exactly at the right time :)
 		// Then send rtp audio packet to Discord over UDP
-		select {
-		case <-close:
-			return
-		case <-ticker.C:
-			// continue
+		if !onTick {
+			select {
+			case <-close:
+				return
+			case <-tick:
+				// continue
+			}
 		}
 		_, err := udpConn.Write(sendbuf)
 
@@ -733,28 +1157,74 @@ func (v *VoiceConnection) opusSender(udpConn *net.UDPConn, close <-chan struct{}
 			return
 		}
 
-		if (sequence) == 0xFFFF {
-			sequence = 0
+		now := time.Now()
+		if burst || last.IsZero() {
+			v.countSent(0, frame)
 		} else {
-			sequence++
+			v.countSent(now.Sub(last), frame)
 		}
+		burst = false
 
-		if (timestamp + uint32(size)) >= 0xFFFFFFFF {
-			timestamp = 0
-		} else {
-			timestamp += uint32(size)
+		last = now
+		sequence++
+		timestamp += samples
+
+		v.Lock()
+		v.sendSequence, v.sendTimestamp, v.lastSent = sequence, timestamp, last
+		v.Unlock()
+	}
+}
+
+// playOpus sends the opus packets returned by next on OpusSend, until next
+// returns io.EOF or stop is closed. The packets must be a frame long.
+func (v *VoiceConnection) playOpus(next func() ([]byte, error), stop <-chan struct{}) error {
+
+	v.RLock()
+	send := v.OpusSend
+	rate, size := v.audioFormat()
+	v.RUnlock()
+
+	if send == nil {
+		return ErrVoiceNotReady
+	}
+
+	for {
+		p, err := next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if opusPacketSamples(p)*rate != size*voiceSampleRate {
+			return ErrOpusFrameSize
+		}
+
+		select {
+		case send <- p:
+		case <-stop:
+			return nil
 		}
 	}
 }
 
 // A Packet contains the headers and content of a received voice packet.
 type Packet struct {
-	SSRC      uint32
-	Sequence  uint16
-	Timestamp uint32
-	Type      []byte
-	Opus      []byte
-	PCM       []int16
+	SSRC       uint32
+	UserID     string // The ID of the user sending the packet, if known
+	Sequence   uint16
+	Timestamp  uint32
+	Type       []byte
+	Extensions []RTPHeaderExtension
+	Opus       []byte
+	PCM        []int16
+
+	// Lost is the number of packets lost right before this packet, and
+	// Silence the time the user was silent before it. Both are only set for
+	// packets received with ReceiveUser.
+	Lost    int
+	Silence time.Duration
 }
 
 // opusReceiver listens on the UDP socket for incoming packets
@@ -767,10 +1237,21 @@ func (v *VoiceConnection) opusReceiver(udpConn *net.UDPConn, close <-chan struct
 	}
 
 	recvbuf := make([]byte, 1024)
-	var nonce [24]byte
+	buffers := make(map[uint32]*jitterBuffer)
+	sequences := make(map[uint32]*rtpSequence)
 
 	for {
+		// Release the packets held back too long, whatever else is received
+		if !v.releaseStreams(buffers, close) {
+			return
+		}
+
+		// Wake up regularly to release them while nothing is received
+		udpConn.SetReadDeadline(time.Now().Add(VoiceJitterDelay))
 		rlen, err := udpConn.Read(recvbuf)
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			continue
+		}
 		if err != nil {
 			// Detect if we have been closed manually. If a Close() has already
 			// happened, the udp connection we are listening on will be different
@@ -783,7 +1264,7 @@ func (v *VoiceConnection) opusReceiver(udpConn *net.UDPConn, close <-chan struct
 				v.log(LogError, "udp read error, %s, %s", v.endpoint, err)
 				v.log(LogDebug, "voice struct: %#v\n", v)
 
-				go v.reconnect()
+				go v.reconnect(err)
 			}
 			return
 		}
@@ -795,24 +1276,53 @@ func (v *VoiceConnection) opusReceiver(udpConn *net.UDPConn, close <-chan struct
 			// continue loop
 		}
 
-		// For now, skip anything except audio.
-		if rlen < 12 || (recvbuf[0] != 0x80 && recvbuf[0] != 0x90) {
+		// For now, skip anything except RTP version 2 opus audio.
+		if rlen < 12 || recvbuf[0]>>6 != 2 || recvbuf[1]&0x7F != 0x78 {
 			continue
 		}
 
 		// build a audio packet struct
 		p := Packet{}
-		p.Type = recvbuf[0:2]
+		p.Type = append([]byte(nil), recvbuf[0:2]...)
 		p.Sequence = binary.BigEndian.Uint16(recvbuf[2:4])
 		p.Timestamp = binary.BigEndian.Uint32(recvbuf[4:8])
 		p.SSRC = binary.BigEndian.Uint32(recvbuf[8:12])
 		// decrypt opus data
-		copy(nonce[:], recvbuf[0:12])
-		p.Opus, _ = secretbox.Open(nil, recvbuf[12:rlen], &nonce, &v.op4.SecretKey)
+		v.RLock()
+		payload, err := v.cipher.open(recvbuf[:rlen])
+		v.RUnlock()
+		if err != nil {
+			v.log(LogDebug, "%s from ssrc %d", err, p.SSRC)
+			continue
+		}
+
+		var ok bool
+		p.Extensions, p.Opus, ok = parseRTPPayload(recvbuf[0], payload)
+		if !ok {
+			v.log(LogDebug, "malformed rtp packet from ssrc %d", p.SSRC)
+			continue
+		}
+
+		v.countReceived(sequences, p.SSRC, p.Sequence)
+
+		var stream *voiceStream
+		p.UserID, stream = v.userStream(p.SSRC)
+
+		// Send the audio of users received with ReceiveUser on their
+		// own channel, in order
+		if stream != nil {
+			b, ok := buffers[p.SSRC]
+			if !ok {
+				b = newJitterBuffer()
+				buffers[p.SSRC] = b
+			}
 
-		if len(p.Opus) > 8 && recvbuf[0] == 0x90 {
-			// Extension bit is set, first 8 bytes is the extended header
-			p.Opus = p.Opus[8:]
+			for _, rp := range b.push(&p, time.Now()) {
+				if !stream.send(rp, close) {
+					return
+				}
+			}
+			continue
 		}
 
 		if c != nil {
@@ -825,12 +1335,151 @@ func (v *VoiceConnection) opusReceiver(udpConn *net.UDPConn, close <-chan struct
 	}
 }
 
+// releaseStreams sends the packets held back too long by the jitter buffers
+// of an opusReceiver. It returns false if close was closed.
+func (v *VoiceConnection) releaseStreams(buffers map[uint32]*jitterBuffer, close <-chan struct{}) bool {
+
+	now := time.Now()
+	for ssrc, b := range buffers {
+		if len(b.held) == 0 {
+			continue
+		}
+
+		_, stream := v.userStream(ssrc)
+		for _, p := range b.release(now) {
+			if stream != nil && !stream.send(p, close) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+type voiceResumeData struct {
+	ServerID  string `json:"server_id"`
+	SessionID string `json:"session_id"`
+	Token     string `json:"token"`
+	SeqAck    int64  `json:"seq_ack"`
+}
+
+type voiceResumeOp struct {
+	Op   int             `json:"op"` // Always 7
+	Data voiceResumeData `json:"d"`
+}
+
+// resume replaces the voice websocket and resumes the voice session on it.
+// The udp connection is kept open, so that audio keeps flowing. If the
+// session can not be resumed, the voice connection is reconnected.
+func (v *VoiceConnection) resume() {
+
+	v.log(LogInformational, "called")
+
+	if err := v.wsResume(); err != nil {
+		v.log(LogWarning, "error resuming voice session, %s", err)
+		v.reconnect(err)
+	}
+}
+
+// wsResume opens a new voice websocket and sends the Op 7 Resume packet.
+func (v *VoiceConnection) wsResume() (err error) {
+
+	v.Lock()
+
+	// Don't resume a closed or reconnecting voice connection
+	if v.close == nil || v.reconnecting || v.resuming {
+		v.Unlock()
+		return
+	}
+
+	if v.wsClose != nil {
+		close(v.wsClose)
+		v.wsClose = nil
+	}
+
+	if v.wsConn != nil {
+		v.wsConn.Close()
+		v.wsConn = nil
+	}
+
+	// The websocket is dialed without the lock, resuming keeps other
+	// resumes from starting meanwhile.
+	v.resuming = true
+	vg := voiceGatewayURL(v.endpoint)
+	data := voiceResumeOp{7, voiceResumeData{v.GuildID, v.sessionID, v.token, v.sequence}}
+	v.Unlock()
+
+	v.log(LogInformational, "resuming voice session on %s", vg)
+	wsConn, _, err := websocket.DefaultDialer.Dial(vg, nil)
+	if err == nil {
+		if err = wsConn.WriteJSON(data); err != nil {
+			wsConn.Close()
+		}
+	}
+
+	v.Lock()
+	defer v.Unlock()
+
+	// The voice connection was closed or reconnected while resuming
+	if v.close == nil || v.reconnecting || !v.resuming || v.wsConn != nil {
+		if err == nil {
+			wsConn.Close()
+		}
+		return nil
+	}
+
+	if err != nil {
+		v.resuming = false
+		return
+	}
+
+	v.wsConn = wsConn
+	v.wsClose = make(chan struct{})
+	go v.wsListen(wsConn, v.wsClose)
+
+	return
+}
+
+// migrate moves an open voice connection to another voice server, such as
+// when Discord moves the voice server of a guild. The OpusSend and OpusRecv
+// channels are kept, and the audio sent is paused during the handshake with
+// the new server and then continues its RTP sequence and timestamps.
+func (v *VoiceConnection) migrate(token, endpoint string) {
+
+	v.RLock()
+	oldEndpoint := v.endpoint
+	v.RUnlock()
+
+	v.log(LogInformational, "migrating voice connection from %s to %s", oldEndpoint, endpoint)
+
+	// The sender stops with the old connections, and the audio waits on
+	// OpusSend until the new sender starts. The old websocket is closed in
+	// the background, not to hold up the handshake with the new server.
+	if _, wsConn := v.detachConnections(); wsConn != nil {
+		go v.closeWebsocket(wsConn)
+	}
+
+	v.Lock()
+	v.token = token
+	v.endpoint = endpoint
+	if endpoint != oldEndpoint {
+		v.migratedFrom = oldEndpoint
+	}
+	v.Unlock()
+
+	if err := v.open(); err != nil {
+		v.log(LogError, "error migrating voice connection to %s, %s", endpoint, err)
+		go v.reconnect(err)
+	}
+}
+
 // Reconnect will close down a voice connection then immediately try to
-// reconnect to that session.
+// reconnect to that session. reason is the error the connection was lost
+// with.
 // NOTE : This func is messy and a WIP while I find what works.
 // It will be cleaned up once a proven stable option is flushed out.
 // aka: this is ugly shit code, please don't judge too harshly.
-func (v *VoiceConnection) reconnect() {
+func (v *VoiceConnection) reconnect(reason error) {
 
 	v.log(LogInformational, "called")
 
@@ -846,10 +1495,10 @@ func (v *VoiceConnection) reconnect() {
 	defer func() { v.reconnecting = false }()
 
 	// Close any currently open connections
-	v.Close()
+	v.closeWith(reason)
 
 	wait := time.Duration(1)
-	for {
+	for attempt := 1; ; attempt++ {
 
 		<-time.After(wait * time.Second)
 		wait *= 2
@@ -863,6 +1512,7 @@ func (v *VoiceConnection) reconnect() {
 		}
 
 		v.log(LogInformational, "trying to reconnect to channel %s", v.ChannelID)
+		v.emit(&VoiceReconnecting{Attempt: attempt})
 
 		_, err := v.session.ChannelVoiceJoin(v.GuildID, v.ChannelID, v.mute, v.deaf)
 		if err == nil {
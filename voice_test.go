@@ -0,0 +1,385 @@
+package discordgo
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeVoiceGateway is a voice gateway that acknowledges heartbeats, and
+// closes the first connection after its first heartbeat so that the session
+// gets resumed.
+type fakeVoiceGateway struct {
+	sync.Mutex
+
+	conns   int
+	resumed chan voiceResumeData
+}
+
+func (g *fakeVoiceGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+
+	g.Lock()
+	g.conns++
+	conn := g.conns
+	g.Unlock()
+
+	ws.WriteJSON(map[string]interface{}{"op": 8, "d": map[string]interface{}{"heartbeat_interval": 20.5}})
+
+	for {
+		var e voiceEvent
+		if err := ws.ReadJSON(&e); err != nil {
+			return
+		}
+
+		switch e.Operation {
+		case 0:
+			ws.WriteJSON(map[string]interface{}{"op": 5, "seq": 3, "d": map[string]interface{}{"user_id": "2", "ssrc": 1, "speaking": true}})
+		case 3:
+			var hb voiceHeartbeatData
+			json.Unmarshal(e.RawData, &hb)
+			ws.WriteJSON(map[string]interface{}{"op": 6, "d": map[string]interface{}{"t": hb.Nonce}})
+
+			if conn == 1 && hb.SeqAck == 3 {
+				ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(4015, "voice server crashed"))
+				return
+			}
+		case 7:
+			var resume voiceResumeData
+			json.Unmarshal(e.RawData, &resume)
+			ws.WriteJSON(map[string]interface{}{"op": 9, "d": nil})
+			g.resumed <- resume
+		}
+	}
+}
+
+func TestVoiceGatewayResume(t *testing.T) {
+	g := &fakeVoiceGateway{resumed: make(chan voiceResumeData, 1)}
+	srv := httptest.NewServer(g)
+	defer srv.Close()
+
+	v := &VoiceConnection{
+		GuildID:   "1",
+		UserID:    "2",
+		session:   &Session{},
+		sessionID: "session",
+		token:     "token",
+		endpoint:  "ws" + strings.TrimPrefix(srv.URL, "http"),
+	}
+	defer v.Close()
+
+	if err := v.open(); err != nil {
+		t.Fatalf("open returned error: %+v", err)
+	}
+
+	select {
+	case resume := <-g.resumed:
+		want := voiceResumeData{ServerID: "1", SessionID: "session", Token: "token", SeqAck: 3}
+		if resume != want {
+			t.Errorf("resume should be %+v, got %+v", want, resume)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("voice session was not resumed")
+	}
+
+	// Wait for a heartbeat to be acknowledged on the resumed websocket.
+	time.Sleep(100 * time.Millisecond)
+
+	v.RLock()
+	resuming, reconnecting := v.resuming, v.reconnecting
+	v.RUnlock()
+	if resuming || reconnecting {
+		t.Errorf("voice session should be resumed, got resuming %t and reconnecting %t", resuming, reconnecting)
+	}
+
+	if l := v.HeartbeatLatency(); l <= 0 || l > time.Second {
+		t.Errorf("heartbeat latency should be measured, got %s", l)
+	}
+
+	g.Lock()
+	defer g.Unlock()
+	if g.conns != 2 {
+		t.Errorf("voice gateway should be connected to twice, got %d", g.conns)
+	}
+}
+
+// fakeVoiceServer is a voice server answering the voice handshake, and the IP
+// discovery if discovery is true. It sends the RTP packets it receives on
+// packets, and the address selected by the client on selected.
+type fakeVoiceServer struct {
+	ssrc      uint32
+	udp       *net.UDPConn
+	srv       *httptest.Server
+	packets   chan []byte
+	selected  chan voiceUDPData
+	discovery bool
+}
+
+func newFakeVoiceServer(t *testing.T, ssrc uint32, discovery bool) *fakeVoiceServer {
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP returned error: %+v", err)
+	}
+
+	s := &fakeVoiceServer{ssrc: ssrc, udp: udp, packets: make(chan []byte, 64), selected: make(chan voiceUDPData, 1), discovery: discovery}
+	s.srv = httptest.NewServer(s)
+	go s.serveUDP()
+	return s
+}
+
+func (s *fakeVoiceServer) endpoint() string {
+	return "ws" + strings.TrimPrefix(s.srv.URL, "http")
+}
+
+func (s *fakeVoiceServer) Close() {
+	s.srv.Close()
+	s.udp.Close()
+}
+
+func (s *fakeVoiceServer) serveUDP() {
+	b := make([]byte, 1024)
+	for {
+		n, addr, err := s.udp.ReadFromUDP(b)
+		if err != nil {
+			return
+		}
+
+		switch {
+		case n == 74 && binary.BigEndian.Uint16(b) == 1:
+			if s.discovery {
+				s.udp.WriteToUDP(discoveryResponse(binary.BigEndian.Uint32(b[4:]), addr), addr)
+			}
+		case n >= 12 && b[0] == 0x80 && b[1] == 0x78:
+			select {
+			case s.packets <- append([]byte(nil), b[:n]...):
+			default:
+			}
+		}
+	}
+}
+
+func (s *fakeVoiceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+
+	ws.WriteJSON(map[string]interface{}{"op": 8, "d": voiceOP8{HeartbeatInterval: 1000}})
+
+	for {
+		var e voiceEvent
+		if err := ws.ReadJSON(&e); err != nil {
+			return
+		}
+
+		switch e.Operation {
+		case 0:
+			addr := s.udp.LocalAddr().(*net.UDPAddr)
+			ws.WriteJSON(map[string]interface{}{"op": 2, "d": map[string]interface{}{
+				"ssrc":  s.ssrc,
+				"ip":    addr.IP.String(),
+				"port":  addr.Port,
+				"modes": []string{VoiceModeAES256GCMRTPSize},
+			}})
+		case 1:
+			var selected voiceUDPD
+			json.Unmarshal(e.RawData, &selected)
+			select {
+			case s.selected <- selected.Data:
+			default:
+			}
+
+			ws.WriteJSON(map[string]interface{}{"op": 4, "d": voiceOP4{SecretKey: testVoiceKey(), Mode: VoiceModeAES256GCMRTPSize}})
+		case 3:
+			var hb voiceHeartbeatData
+			json.Unmarshal(e.RawData, &hb)
+			ws.WriteJSON(map[string]interface{}{"op": 6, "d": map[string]interface{}{"t": hb.Nonce}})
+		}
+	}
+}
+
+// discoveryResponse returns the IP discovery response of an address.
+func discoveryResponse(ssrc uint32, addr *net.UDPAddr) []byte {
+	rb := make([]byte, 74)
+	binary.BigEndian.PutUint16(rb, 2)
+	binary.BigEndian.PutUint16(rb[2:], 70)
+	binary.BigEndian.PutUint32(rb[4:], ssrc)
+	copy(rb[8:], addr.IP.String())
+	binary.BigEndian.PutUint16(rb[72:], uint16(addr.Port))
+	return rb
+}
+
+// next returns the sequence, timestamp and SSRC of the next RTP packet
+// received.
+func (s *fakeVoiceServer) next(t *testing.T) (uint16, uint32, uint32) {
+	select {
+	case p := <-s.packets:
+		return binary.BigEndian.Uint16(p[2:]), binary.BigEndian.Uint32(p[4:]), binary.BigEndian.Uint32(p[8:])
+	case <-time.After(2 * time.Second):
+		t.Fatal("voice server did not receive a packet")
+	}
+	return 0, 0, 0
+}
+
+func TestVoiceMigration(t *testing.T) {
+	a := newFakeVoiceServer(t, 10, true)
+	defer a.Close()
+	b := newFakeVoiceServer(t, 20, true)
+	defer b.Close()
+
+	v := &VoiceConnection{
+		GuildID:   "1",
+		UserID:    "2",
+		sessionID: "session",
+		token:     "token",
+		endpoint:  a.endpoint(),
+		OpusSend:  make(chan []byte, 2),
+		OpusRecv:  make(chan *Packet, 2),
+	}
+	s := &Session{VoiceConnections: map[string]*VoiceConnection{"1": v}}
+	v.session = s
+	defer v.Close()
+
+	migrated := make(chan *VoiceMigrated, 1)
+	v.AddHandler(func(v *VoiceConnection, e *VoiceMigrated) { migrated <- e })
+
+	if err := v.open(); err != nil {
+		t.Fatalf("open returned error: %+v", err)
+	}
+	if err := v.waitUntilConnected(); err != nil {
+		t.Fatalf("voice connection did not connect: %+v", err)
+	}
+
+	// A frame of audio followed by the silence frames
+	frame := []byte{0xFC, 1}
+	v.OpusSend <- frame
+	var sequence uint16
+	var timestamp uint32
+	for i := 0; i <= voiceSilenceFrames; i++ {
+		sequence, timestamp, _ = a.next(t)
+	}
+
+	send, recv := v.OpusSend, v.OpusRecv
+	start := time.Now()
+	s.onVoiceServerUpdate(&VoiceServerUpdate{Token: "token", GuildID: "1", Endpoint: b.endpoint()})
+	v.OpusSend <- frame
+
+	select {
+	case e := <-migrated:
+		if e.OldEndpoint != a.endpoint() || e.Endpoint != b.endpoint() {
+			t.Errorf("migration should be from %s to %s, got %+v", a.endpoint(), b.endpoint(), e)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("voice connection was not migrated")
+	}
+
+	if v.OpusSend != send || v.OpusRecv != recv {
+		t.Errorf("OpusSend and OpusRecv should be kept")
+	}
+
+	seq, ts, ssrc := b.next(t)
+	if seq != sequence+1 || ts <= timestamp || ssrc != 20 {
+		t.Errorf("audio should continue after sequence %d and timestamp %d with SSRC 20, got %d, %d and %d", sequence, timestamp, seq, ts, ssrc)
+	}
+
+	// The audio is only paused for the handshake with the new server.
+	if gap := time.Since(start); gap > 500*time.Millisecond {
+		t.Errorf("audio should be sent again within 500ms of the migration, got %s", gap)
+	}
+}
+
+func TestVoiceIPDiscovery(t *testing.T) {
+	defer func(timeout time.Duration) { voiceDiscoveryTimeout = timeout }(voiceDiscoveryTimeout)
+	voiceDiscoveryTimeout = 50 * time.Millisecond
+
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP returned error: %+v", err)
+	}
+	defer server.Close()
+
+	// The first request is lost, the second is answered after a response
+	// to another SSRC.
+	go func() {
+		b := make([]byte, 128)
+		for i := 0; ; i++ {
+			n, addr, err := server.ReadFromUDP(b)
+			if err != nil {
+				return
+			}
+			if n != 74 || binary.BigEndian.Uint16(b) != 1 || binary.BigEndian.Uint16(b[2:]) != 70 || binary.BigEndian.Uint32(b[4:]) != 7 {
+				t.Errorf("invalid discovery request %x", b[:n])
+				return
+			}
+
+			if i == 1 {
+				server.WriteToUDP(discoveryResponse(8, &net.UDPAddr{IP: net.IPv4(1, 1, 1, 1), Port: 1}), addr)
+				server.WriteToUDP(discoveryResponse(7, &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 50000}), addr)
+			}
+		}
+	}()
+
+	udpConn, err := net.DialUDP("udp", nil, server.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("DialUDP returned error: %+v", err)
+	}
+	defer udpConn.Close()
+
+	ip, port, err := voiceIPDiscovery(udpConn, 7)
+	if err != nil || ip != "192.0.2.1" || port != 50000 {
+		t.Errorf("address should be 192.0.2.1:50000, got %s:%d, %+v", ip, port, err)
+	}
+
+	// No more responses
+	if _, _, err = voiceIPDiscovery(udpConn, 7); err != ErrVoiceIPDiscovery {
+		t.Errorf("discovery without a response should fail, got %+v", err)
+	}
+}
+
+func TestVoiceExternalIP(t *testing.T) {
+	defer func(timeout time.Duration) { voiceDiscoveryTimeout = timeout }(voiceDiscoveryTimeout)
+	voiceDiscoveryTimeout = 20 * time.Millisecond
+
+	srv := newFakeVoiceServer(t, 10, false)
+	defer srv.Close()
+
+	v := &VoiceConnection{
+		GuildID:    "1",
+		UserID:     "2",
+		sessionID:  "session",
+		token:      "token",
+		endpoint:   srv.endpoint(),
+		session:    &Session{},
+		ExternalIP: "192.0.2.1",
+	}
+	defer v.Close()
+
+	if err := v.open(); err != nil {
+		t.Fatalf("open returned error: %+v", err)
+	}
+
+	select {
+	case selected := <-srv.selected:
+		v.RLock()
+		port := v.udpConn.LocalAddr().(*net.UDPAddr).Port
+		v.RUnlock()
+		if selected.Address != "192.0.2.1" || int(selected.Port) != port {
+			t.Errorf("external address should be 192.0.2.1:%d, got %+v", port, selected)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("protocol was not selected")
+	}
+}
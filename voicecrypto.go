@@ -0,0 +1,163 @@
+package discordgo
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// Voice encryption modes supported by discordgo.
+const (
+	VoiceModeAES256GCMRTPSize         = "aead_aes256_gcm_rtpsize"
+	VoiceModeXChaCha20Poly1305RTPSize = "aead_xchacha20_poly1305_rtpsize"
+	VoiceModeXSalsa20Poly1305         = "xsalsa20_poly1305"
+)
+
+// VoiceModes lists the supported voice encryption modes, in order of
+// preference. The first one offered by the voice server is used.
+var VoiceModes = []string{
+	VoiceModeAES256GCMRTPSize,
+	VoiceModeXChaCha20Poly1305RTPSize,
+	VoiceModeXSalsa20Poly1305,
+}
+
+// rtpHeaderSize is the size of an RTP header without CSRCs or extension.
+const rtpHeaderSize = 12
+
+// A voiceCipher encrypts and decrypts the payload of RTP voice packets.
+type voiceCipher interface {
+	// seal appends to dst the RTP packet with the given header and the
+	// encrypted opus audio. It is not safe to call concurrently.
+	seal(dst, header, opus []byte) []byte
+
+	// open decrypts an RTP packet, and returns its payload following the
+	// 12 byte fixed header, with the CSRCs and the extension header in
+	// place as if it were never encrypted.
+	open(packet []byte) ([]byte, error)
+}
+
+// selectVoiceMode returns the preferred encryption mode of modes.
+func selectVoiceMode(modes []string) (string, error) {
+	for _, m := range VoiceModes {
+		for _, offered := range modes {
+			if m == offered {
+				return m, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no supported voice encryption mode in %v", modes)
+}
+
+// newVoiceCipher creates the voiceCipher of an encryption mode.
+func newVoiceCipher(mode string, key [32]byte) (voiceCipher, error) {
+	switch mode {
+	case VoiceModeAES256GCMRTPSize:
+		block, err := aes.NewCipher(key[:])
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		return &rtpSizeCipher{aead: aead}, nil
+
+	case VoiceModeXChaCha20Poly1305RTPSize:
+		aead, err := chacha20poly1305.NewX(key[:])
+		if err != nil {
+			return nil, err
+		}
+		return &rtpSizeCipher{aead: aead}, nil
+
+	case VoiceModeXSalsa20Poly1305:
+		return &xsalsa20Cipher{key: key}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported voice encryption mode %s", mode)
+}
+
+// rtpHeaderLen returns the length of the unencrypted part of an rtpsize
+// packet: the fixed header, the CSRCs and the extension header, but not the
+// extension itself.
+func rtpHeaderLen(packet []byte) int {
+	if len(packet) < rtpHeaderSize {
+		return -1
+	}
+
+	n := rtpHeaderSize + 4*int(packet[0]&0x0F)
+	if packet[0]&0x10 != 0 {
+		n += 4
+	}
+
+	return n
+}
+
+// rtpSizeCipher implements the aead_*_rtpsize modes. The RTP header is
+// authenticated but not encrypted, and the 4 byte nonce counter is
+// appended to the packet.
+type rtpSizeCipher struct {
+	aead  cipher.AEAD
+	nonce uint32
+}
+
+func (c *rtpSizeCipher) seal(dst, header, opus []byte) []byte {
+	nonce := make([]byte, c.aead.NonceSize())
+	binary.BigEndian.PutUint32(nonce, c.nonce)
+	c.nonce++
+
+	dst = append(dst, header...)
+	dst = c.aead.Seal(dst, nonce, opus, header)
+	return append(dst, nonce[:4]...)
+}
+
+func (c *rtpSizeCipher) open(packet []byte) ([]byte, error) {
+	n := rtpHeaderLen(packet)
+	if n < 0 || len(packet) < n+c.aead.Overhead()+4 {
+		return nil, ErrVoiceDecrypt
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
+	copy(nonce, packet[len(packet)-4:])
+
+	payload := append([]byte(nil), packet[rtpHeaderSize:n]...)
+	payload, err := c.aead.Open(payload, nonce, packet[n:len(packet)-4], packet[:n])
+	if err != nil {
+		return nil, ErrVoiceDecrypt
+	}
+
+	return payload, nil
+}
+
+// xsalsa20Cipher implements the xsalsa20_poly1305 mode, which uses the
+// RTP header as nonce.
+type xsalsa20Cipher struct {
+	key [32]byte
+}
+
+func (c *xsalsa20Cipher) seal(dst, header, opus []byte) []byte {
+	var nonce [24]byte
+	copy(nonce[:], header)
+
+	return secretbox.Seal(append(dst, header...), opus, &nonce, &c.key)
+}
+
+func (c *xsalsa20Cipher) open(packet []byte) ([]byte, error) {
+	if len(packet) < rtpHeaderSize {
+		return nil, ErrVoiceDecrypt
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], packet[:rtpHeaderSize])
+
+	payload, ok := secretbox.Open(nil, packet[rtpHeaderSize:], &nonce, &c.key)
+	if !ok {
+		return nil, ErrVoiceDecrypt
+	}
+
+	return payload, nil
+}
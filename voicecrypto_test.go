@@ -0,0 +1,128 @@
+package discordgo
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func testVoiceKey() (key [32]byte) {
+	for i := range key {
+		key[i] = byte(i)
+	}
+	return
+}
+
+func TestVoiceCipherKnownAnswers(t *testing.T) {
+	header, _ := hex.DecodeString("80780001000003c000012345")
+	opus := []byte("opus frame")
+
+	// Two packets sealed in a row, the rtpsize modes append their nonce.
+	// The packets were built by hand around the output of libsodium 1.0.18
+	// with the key above: crypto_aead_aes256gcm_encrypt and
+	// crypto_aead_xchacha20poly1305_ietf_encrypt of the opus frame, with the
+	// header as additional data and the big endian counter 0, then 1, zero
+	// padded as nonce, followed by the first 4 nonce bytes; and
+	// crypto_secretbox_easy with the header zero padded as nonce.
+	tests := map[string][2]string{
+		VoiceModeAES256GCMRTPSize: {
+			"80780001000003c00001234561ccc0ad954af1dc65cd628761df5fca89920bda9932401b5fca00000000",
+			"80780001000003c0000123452b46b8d92c3c86c9325981ccd7f269099ea7dd5e1d61dca695ed00000001",
+		},
+		VoiceModeXChaCha20Poly1305RTPSize: {
+			"80780001000003c000012345fa76f9b4ccee97787beb447465256a38f25ef581529f92802db800000000",
+			"80780001000003c00001234566d724534f66e3bea382f4ce0f9c80033e7157734b4e6975a16a00000001",
+		},
+		VoiceModeXSalsa20Poly1305: {
+			"80780001000003c000012345bc951055102c871cc27dd9df0d1c68d3b326039473a9197adbfc",
+			"80780001000003c000012345bc951055102c871cc27dd9df0d1c68d3b326039473a9197adbfc",
+		},
+	}
+
+	for mode, packets := range tests {
+		c, err := newVoiceCipher(mode, testVoiceKey())
+		if err != nil {
+			t.Fatalf("%s: newVoiceCipher returned error: %+v", mode, err)
+		}
+
+		for i, want := range packets {
+			packet := c.seal(nil, header, opus)
+			if got := hex.EncodeToString(packet); got != want {
+				t.Errorf("%s: packet %d should be %s, got %s", mode, i, want, got)
+			}
+
+			payload, err := c.open(packet)
+			if err != nil || !bytes.Equal(payload, opus) {
+				t.Errorf("%s: packet %d should open to %q, got %q, %+v", mode, i, opus, payload, err)
+			}
+
+			packet[len(packet)-5] ^= 1
+			if _, err = c.open(packet); err != ErrVoiceDecrypt {
+				t.Errorf("%s: tampered packet %d should not open, got %+v", mode, i, err)
+			}
+		}
+	}
+}
+
+func TestVoiceCipherExtension(t *testing.T) {
+	// A received packet with a one-byte header extension of one word. In
+	// the rtpsize modes the extension header is authenticated but only the
+	// extension itself is encrypted.
+	header, _ := hex.DecodeString("90780001000003c000012345bede0001")
+	extension, _ := hex.DecodeString("10ff0000")
+	opus := []byte("opus frame")
+
+	want := append(append(append([]byte(nil), header[12:]...), extension...), opus...)
+
+	// Received packets built with libsodium 1.0.18 as in
+	// TestVoiceCipherKnownAnswers, encrypting the extension and the opus
+	// frame with the 16 byte header as additional data and nonce counter 7.
+	received := map[string]string{
+		VoiceModeAES256GCMRTPSize:         "90780001000003c000012345bede00014f18d481155856f8cfb4e6a46caf4162f382e2dbb6772d3039b3b7d95dc900000007",
+		VoiceModeXChaCha20Poly1305RTPSize: "90780001000003c000012345bede0001a6485d3717b2dc38f725373eaf7c969a29817ddf03db0b6fc549bcb32b1f00000007",
+	}
+
+	for mode, p := range received {
+		c, _ := newVoiceCipher(mode, testVoiceKey())
+		packet, _ := hex.DecodeString(p)
+
+		payload, err := c.open(packet)
+		if err != nil || !bytes.Equal(payload, want) {
+			t.Errorf("%s: received payload should be %x, got %x, %+v", mode, want, payload, err)
+		}
+
+		packet = c.seal(nil, header, append(append([]byte(nil), extension...), opus...))
+		payload, err = c.open(packet)
+		if err != nil || !bytes.Equal(payload, want) {
+			t.Errorf("%s: payload should be %x, got %x, %+v", mode, want, payload, err)
+		}
+	}
+
+	// The xsalsa20_poly1305 mode encrypts everything after the fixed header.
+	c, _ := newVoiceCipher(VoiceModeXSalsa20Poly1305, testVoiceKey())
+	packet := c.seal(nil, header[:12], want)
+
+	payload, err := c.open(packet)
+	if err != nil || !bytes.Equal(payload, want) {
+		t.Errorf("%s: payload should be %x, got %x, %+v", VoiceModeXSalsa20Poly1305, want, payload, err)
+	}
+}
+
+func TestSelectVoiceMode(t *testing.T) {
+	tests := []struct {
+		modes []string
+		want  string
+	}{
+		{[]string{"xsalsa20_poly1305", "xsalsa20_poly1305_lite", "aead_xchacha20_poly1305_rtpsize", "aead_aes256_gcm_rtpsize"}, VoiceModeAES256GCMRTPSize},
+		{[]string{"xsalsa20_poly1305", "aead_xchacha20_poly1305_rtpsize"}, VoiceModeXChaCha20Poly1305RTPSize},
+		{[]string{"xsalsa20_poly1305_suffix", "xsalsa20_poly1305"}, VoiceModeXSalsa20Poly1305},
+		{[]string{"xsalsa20_poly1305_lite"}, ""},
+	}
+
+	for _, test := range tests {
+		mode, err := selectVoiceMode(test.modes)
+		if mode != test.want || (err != nil) != (test.want == "") {
+			t.Errorf("selectVoiceMode(%v) should be %q, got %q, %+v", test.modes, test.want, mode, err)
+		}
+	}
+}
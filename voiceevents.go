@@ -0,0 +1,255 @@
+package discordgo
+
+import (
+	"time"
+)
+
+// VoiceConnecting is sent when a voice connection starts connecting to its
+// voice server.
+type VoiceConnecting struct {
+	Endpoint string
+}
+
+// VoiceReady is sent when a voice connection is ready to send and receive
+// audio.
+type VoiceReady struct {
+	SSRC uint32
+	Mode string // The encryption mode of the audio
+}
+
+// VoiceReconnecting is sent before each attempt to reconnect a lost voice
+// connection.
+type VoiceReconnecting struct {
+	Attempt int
+}
+
+// VoiceDisconnected is sent when the connections to the voice server are
+// closed. Moving to another voice server sends VoiceEndpointChanged and
+// VoiceMigrated instead.
+type VoiceDisconnected struct {
+	// Reason is the error the connection was lost with, nil if it was
+	// closed, such as by Close or Disconnect.
+	Reason error
+}
+
+// VoiceEndpointChanged is sent when Discord moves a voice connection to
+// another voice server.
+type VoiceEndpointChanged struct {
+	OldEndpoint string
+	Endpoint    string
+}
+
+// VoiceMigrated is sent when a voice connection moved to another voice
+// server is ready to send and receive audio again.
+type VoiceMigrated struct {
+	OldEndpoint string
+	Endpoint    string
+}
+
+// A voiceHandler is a handler added with VoiceConnection.AddHandler, which
+// ignores the events of other types.
+type voiceHandler struct {
+	handle func(v *VoiceConnection, i interface{})
+}
+
+// voiceHandlerForInterface returns the voiceHandler of a handler function,
+// or nil if the handler is not a valid voice handler.
+func voiceHandlerForInterface(handler interface{}) *voiceHandler {
+	var handle func(*VoiceConnection, interface{})
+
+	switch h := handler.(type) {
+	case func(*VoiceConnection, interface{}):
+		handle = h
+	case VoiceSpeakingUpdateHandler:
+		handle = func(v *VoiceConnection, i interface{}) {
+			if e, ok := i.(*VoiceSpeakingUpdate); ok {
+				h(v, e)
+			}
+		}
+	case func(*VoiceConnection, *VoiceSpeakingUpdate):
+		return voiceHandlerForInterface(VoiceSpeakingUpdateHandler(h))
+	case func(*VoiceConnection, *VoiceConnecting):
+		handle = func(v *VoiceConnection, i interface{}) {
+			if e, ok := i.(*VoiceConnecting); ok {
+				h(v, e)
+			}
+		}
+	case func(*VoiceConnection, *VoiceReady):
+		handle = func(v *VoiceConnection, i interface{}) {
+			if e, ok := i.(*VoiceReady); ok {
+				h(v, e)
+			}
+		}
+	case func(*VoiceConnection, *VoiceReconnecting):
+		handle = func(v *VoiceConnection, i interface{}) {
+			if e, ok := i.(*VoiceReconnecting); ok {
+				h(v, e)
+			}
+		}
+	case func(*VoiceConnection, *VoiceDisconnected):
+		handle = func(v *VoiceConnection, i interface{}) {
+			if e, ok := i.(*VoiceDisconnected); ok {
+				h(v, e)
+			}
+		}
+	case func(*VoiceConnection, *VoiceEndpointChanged):
+		handle = func(v *VoiceConnection, i interface{}) {
+			if e, ok := i.(*VoiceEndpointChanged); ok {
+				h(v, e)
+			}
+		}
+	case func(*VoiceConnection, *VoiceMigrated):
+		handle = func(v *VoiceConnection, i interface{}) {
+			if e, ok := i.(*VoiceMigrated); ok {
+				h(v, e)
+			}
+		}
+	default:
+		return nil
+	}
+
+	return &voiceHandler{handle}
+}
+
+// AddHandler adds a handler of voice events, that will be fired anytime the
+// event that matches the function happens. The first parameter is a
+// *VoiceConnection, and the second parameter is a pointer to the event:
+// a VoiceSpeakingUpdate, or one of the lifecycle events VoiceConnecting,
+// VoiceReady, VoiceReconnecting, VoiceDisconnected, VoiceEndpointChanged and
+// VoiceMigrated.
+// A handler with an interface{} parameter receives every event.
+//
+// eg:
+//
+//	vc.AddHandler(func(vc *discordgo.VoiceConnection, e *discordgo.VoiceDisconnected) {
+//	})
+//
+// The return value of this method is a function, that when called will remove
+// the event handler.
+func (v *VoiceConnection) AddHandler(handler interface{}) func() {
+	vh := voiceHandlerForInterface(handler)
+	if vh == nil {
+		v.log(LogError, "Invalid handler type, handler will never be called")
+		return func() {}
+	}
+
+	v.Lock()
+	defer v.Unlock()
+
+	v.voiceHandlers = append(v.voiceHandlers, vh)
+
+	return func() {
+		v.Lock()
+		defer v.Unlock()
+
+		for i, h := range v.voiceHandlers {
+			if h == vh {
+				v.voiceHandlers = append(v.voiceHandlers[:i], v.voiceHandlers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// emit calls the voice handlers with an event. The voice connection must
+// not be locked.
+func (v *VoiceConnection) emit(event interface{}) {
+	v.RLock()
+	handlers := append([]*voiceHandler(nil), v.voiceHandlers...)
+	v.RUnlock()
+
+	for _, h := range handlers {
+		h.handle(v, event)
+	}
+}
+
+// VoiceStats are the statistics of a voice connection, since it was created.
+type VoiceStats struct {
+	PacketsSent     uint64
+	PacketsReceived uint64
+
+	// PacketsLost is estimated from the gaps in the sequences of the
+	// received packets, see RFC 3550 appendix A.3.
+	PacketsLost uint64
+
+	// SendJitter is the mean deviation of the intervals between the packets
+	// sent from the duration of a frame, see RFC 3550 section 6.4.1.
+	SendJitter time.Duration
+
+	// HeartbeatLatency is the latency of the last voice heartbeat.
+	HeartbeatLatency time.Duration
+}
+
+// Stats returns the statistics of the voice connection.
+func (v *VoiceConnection) Stats() VoiceStats {
+	v.RLock()
+	defer v.RUnlock()
+
+	stats := v.stats
+	stats.HeartbeatLatency = v.latency
+	return stats
+}
+
+// countSent counts a sent packet, at interval after the packet before it.
+// The interval is 0 for the first packet of a burst of audio.
+func (v *VoiceConnection) countSent(interval, frame time.Duration) {
+	v.Lock()
+	defer v.Unlock()
+
+	v.stats.PacketsSent++
+
+	if interval > 0 {
+		d := interval - frame
+		if d < 0 {
+			d = -d
+		}
+		v.stats.SendJitter += (d - v.stats.SendJitter) / 16
+	}
+}
+
+// An rtpSequence counts the packets received and expected from an SSRC.
+type rtpSequence struct {
+	base     uint32 // extended sequence of the first packet
+	max      uint32 // highest extended sequence received
+	received uint32
+}
+
+// lost returns the number of packets lost.
+func (s *rtpSequence) lost() uint32 {
+	expected := s.max - s.base + 1
+	if s.received > expected {
+		return 0
+	}
+	return expected - s.received
+}
+
+// countReceived counts a received packet. sequences holds the sequences of
+// the SSRCs received, and is only used by the receiving goroutine.
+func (v *VoiceConnection) countReceived(sequences map[uint32]*rtpSequence, ssrc uint32, sequence uint16) {
+	var lost uint32
+	s, ok := sequences[ssrc]
+	if ok {
+		lost = s.lost()
+	} else {
+		s = &rtpSequence{base: uint32(sequence), max: uint32(sequence)}
+		sequences[ssrc] = s
+	}
+
+	// Extend the sequence with the number of times it wrapped around
+	ext := s.max&^0xFFFF | uint32(sequence)
+	if delta := int16(sequence - uint16(s.max)); delta > 0 && ext < s.max {
+		ext += 1 << 16
+	} else if delta < 0 && ext > s.max {
+		ext -= 1 << 16
+	}
+	if int32(ext-s.max) > 0 {
+		s.max = ext
+	}
+	s.received++
+
+	v.Lock()
+	defer v.Unlock()
+
+	v.stats.PacketsReceived++
+	v.stats.PacketsLost = v.stats.PacketsLost - uint64(lost) + uint64(s.lost())
+}
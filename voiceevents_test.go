@@ -0,0 +1,62 @@
+package discordgo
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVoiceAddHandler(t *testing.T) {
+	v := &VoiceConnection{}
+
+	var connecting, speaking, all int
+	remove := v.AddHandler(func(v *VoiceConnection, e *VoiceConnecting) { connecting++ })
+	v.AddHandler(VoiceSpeakingUpdateHandler(func(v *VoiceConnection, e *VoiceSpeakingUpdate) { speaking++ }))
+	v.AddHandler(func(v *VoiceConnection, e interface{}) { all++ })
+	v.AddHandler(func(s *Session, e *VoiceConnecting) { t.Errorf("invalid handler should not be called") })
+
+	v.emit(&VoiceConnecting{})
+	v.emit(&VoiceSpeakingUpdate{})
+	remove()
+	v.emit(&VoiceConnecting{})
+
+	if connecting != 1 || speaking != 1 || all != 3 {
+		t.Errorf("handlers should be called for their events, got %d, %d and %d calls", connecting, speaking, all)
+	}
+}
+
+func TestVoiceDisconnected(t *testing.T) {
+	v := &VoiceConnection{close: make(chan struct{})}
+
+	var reasons []error
+	v.AddHandler(func(v *VoiceConnection, e *VoiceDisconnected) { reasons = append(reasons, e.Reason) })
+
+	lost := errors.New("lost")
+	v.closeWith(lost)
+	v.Close()
+
+	if len(reasons) != 1 || reasons[0] != lost {
+		t.Errorf("closing should be sent once with its reason, got %v", reasons)
+	}
+}
+
+func TestVoiceStatsLoss(t *testing.T) {
+	v := &VoiceConnection{}
+	sequences := make(map[uint32]*rtpSequence)
+
+	// Packets 0 and 2 of SSRC 1 are lost, packet 65535 of SSRC 2 is late.
+	for _, p := range []struct {
+		ssrc     uint32
+		sequence uint16
+	}{{1, 65534}, {1, 65535}, {1, 1}, {2, 0}, {1, 3}, {2, 1}, {2, 65535}} {
+		v.countReceived(sequences, p.ssrc, p.sequence)
+	}
+
+	if stats := v.Stats(); stats.PacketsReceived != 7 || stats.PacketsLost != 2 {
+		t.Errorf("7 packets should be received and 2 lost, got %+v", stats)
+	}
+
+	v.countReceived(sequences, 1, 2)
+	if stats := v.Stats(); stats.PacketsLost != 1 {
+		t.Errorf("late packet should not be lost, got %+v", stats)
+	}
+}
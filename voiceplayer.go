@@ -0,0 +1,244 @@
+package discordgo
+
+import (
+	"sync"
+)
+
+// A FrameSource returns the opus frames of a track, and io.EOF once it ended.
+// A DCAReader is a FrameSource.
+type FrameSource interface {
+	ReadFrame() ([]byte, error)
+}
+
+// FrameSourceFunc is a function used as a FrameSource, such as the
+// ReadPacket method of an OggReader.
+type FrameSourceFunc func() ([]byte, error)
+
+// ReadFrame calls f.
+func (f FrameSourceFunc) ReadFrame() ([]byte, error) {
+	return f()
+}
+
+// A Track is audio queued on a VoicePlayer.
+type Track struct {
+	Title  string
+	Source FrameSource
+}
+
+// A VoicePlayer plays a queue of tracks on a voice connection, one after the
+// other. While the player is paused, or has nothing to play, the voice
+// connection sends silence frames and then stops sending.
+type VoicePlayer struct {
+	sync.Mutex
+
+	// OnTrackStart is called when a track starts playing.
+	OnTrackStart func(p *VoicePlayer, t *Track)
+
+	// OnTrackEnd is called when a track stops playing, with the error it
+	// ended with. The error is ErrTrackSkipped for a skipped track, and
+	// ErrPlayerStopped once the player is stopped.
+	OnTrackEnd func(p *VoicePlayer, t *Track, err error)
+
+	vc      *VoiceConnection
+	queue   []*Track
+	current *Track
+	paused  bool
+	stopped bool
+
+	// skip is closed to stop the current track, for the reason in end.
+	skip chan struct{}
+	end  error
+
+	// wake is signalled when a track is queued or the player is resumed.
+	wake chan struct{}
+}
+
+// NewVoicePlayer creates a VoicePlayer, which sends its tracks on the
+// OpusSend channel of a voice connection until it is stopped.
+// vc : The voice connection to play on.
+func NewVoicePlayer(vc *VoiceConnection) *VoicePlayer {
+	p := &VoicePlayer{
+		vc:   vc,
+		wake: make(chan struct{}, 1),
+	}
+
+	go p.run()
+	return p
+}
+
+// Enqueue adds tracks to the end of the queue.
+func (p *VoicePlayer) Enqueue(tracks ...*Track) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.stopped {
+		return ErrPlayerStopped
+	}
+
+	p.queue = append(p.queue, tracks...)
+	p.signal()
+	return nil
+}
+
+// Queue returns the tracks queued after the current track.
+func (p *VoicePlayer) Queue() []*Track {
+	p.Lock()
+	defer p.Unlock()
+
+	return append([]*Track(nil), p.queue...)
+}
+
+// Playing returns the current track, or nil when nothing is playing.
+func (p *VoicePlayer) Playing() *Track {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.current
+}
+
+// Paused returns whether the player is paused.
+func (p *VoicePlayer) Paused() bool {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.paused
+}
+
+// Pause pauses the current track, and the tracks played after it, until
+// Resume is called.
+func (p *VoicePlayer) Pause() {
+	p.Lock()
+	defer p.Unlock()
+
+	p.paused = true
+}
+
+// Resume resumes playing after Pause.
+func (p *VoicePlayer) Resume() {
+	p.Lock()
+	defer p.Unlock()
+
+	p.paused = false
+	p.signal()
+}
+
+// Skip stops the current track, and plays the next track of the queue.
+func (p *VoicePlayer) Skip() {
+	p.Lock()
+	defer p.Unlock()
+
+	p.stopTrack(ErrTrackSkipped)
+}
+
+// Stop stops the current track and clears the queue. The player can't be used
+// once stopped.
+func (p *VoicePlayer) Stop() {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.stopped {
+		return
+	}
+
+	p.stopped = true
+	p.queue = nil
+	p.stopTrack(ErrPlayerStopped)
+	p.signal()
+}
+
+// signal wakes up the player. The player must be locked.
+func (p *VoicePlayer) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stopTrack stops the current track with an error. The player must be locked.
+func (p *VoicePlayer) stopTrack(err error) {
+	if p.current == nil || p.end != nil {
+		return
+	}
+
+	p.end = err
+	close(p.skip)
+}
+
+// run plays the tracks of the queue until the player is stopped.
+func (p *VoicePlayer) run() {
+	for {
+		t, skip := p.next()
+		if t == nil {
+			return
+		}
+
+		if p.OnTrackStart != nil {
+			p.OnTrackStart(p, t)
+		}
+
+		err := p.vc.playOpus(func() ([]byte, error) {
+			if err := p.waitPaused(skip); err != nil {
+				return nil, err
+			}
+			return t.Source.ReadFrame()
+		}, skip)
+
+		p.Lock()
+		if err == nil {
+			err = p.end
+		}
+		p.current, p.skip, p.end = nil, nil, nil
+		p.Unlock()
+
+		if p.OnTrackEnd != nil {
+			p.OnTrackEnd(p, t, err)
+		}
+	}
+}
+
+// next waits for the next track of the queue, and makes it the current track.
+// It returns nil once the player is stopped.
+func (p *VoicePlayer) next() (*Track, chan struct{}) {
+	p.Lock()
+	defer p.Unlock()
+
+	for len(p.queue) == 0 {
+		if p.stopped {
+			return nil, nil
+		}
+
+		p.Unlock()
+		<-p.wake
+		p.Lock()
+	}
+
+	if p.stopped {
+		return nil, nil
+	}
+
+	p.current, p.queue = p.queue[0], p.queue[1:]
+	p.skip = make(chan struct{})
+	return p.current, p.skip
+}
+
+// waitPaused waits while the player is paused. It returns the reason the
+// track was stopped if skip is closed first.
+func (p *VoicePlayer) waitPaused(skip chan struct{}) error {
+	p.Lock()
+	defer p.Unlock()
+
+	for p.paused {
+		p.Unlock()
+		select {
+		case <-p.wake:
+		case <-skip:
+		}
+		p.Lock()
+
+		if p.end != nil {
+			return p.end
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package discordgo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// testTrack returns a track of n frames, each frame starting with the CELT
+// TOC byte followed by its number.
+func testTrack(title string, n int) *Track {
+	var i int
+	return &Track{Title: title, Source: FrameSourceFunc(func() ([]byte, error) {
+		if i == n {
+			return nil, io.EOF
+		}
+		i++
+		return []byte{0xFC, byte(i)}, nil
+	})}
+}
+
+type trackEvent struct {
+	start bool
+	title string
+	err   error
+}
+
+func newTestPlayer() (*VoicePlayer, chan []byte, chan trackEvent) {
+	send := make(chan []byte)
+	events := make(chan trackEvent, 8)
+
+	p := NewVoicePlayer(&VoiceConnection{OpusSend: send})
+	p.OnTrackStart = func(p *VoicePlayer, t *Track) {
+		events <- trackEvent{true, t.Title, nil}
+	}
+	p.OnTrackEnd = func(p *VoicePlayer, t *Track, err error) {
+		events <- trackEvent{false, t.Title, err}
+	}
+
+	return p, send, events
+}
+
+func expectTrackEvent(t *testing.T, events chan trackEvent, want trackEvent) {
+	select {
+	case e := <-events:
+		if e != want {
+			t.Errorf("track event should be %+v, got %+v", want, e)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("track event %+v was not sent", want)
+	}
+}
+
+func expectFrame(t *testing.T, send chan []byte, want []byte) {
+	select {
+	case f := <-send:
+		if !bytes.Equal(f, want) {
+			t.Errorf("frame should be %x, got %x", want, f)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("frame %x was not sent", want)
+	}
+}
+
+func TestVoicePlayerQueue(t *testing.T) {
+	p, send, events := newTestPlayer()
+	defer p.Stop()
+
+	p.Enqueue(testTrack("a", 2), testTrack("b", 1))
+
+	expectTrackEvent(t, events, trackEvent{true, "a", nil})
+	expectFrame(t, send, []byte{0xFC, 1})
+	if q := p.Queue(); len(q) != 1 || q[0].Title != "b" || p.Playing().Title != "a" {
+		t.Errorf("a should be playing with b queued, got %v", q)
+	}
+	expectFrame(t, send, []byte{0xFC, 2})
+	expectTrackEvent(t, events, trackEvent{false, "a", nil})
+
+	expectTrackEvent(t, events, trackEvent{true, "b", nil})
+	expectFrame(t, send, []byte{0xFC, 1})
+	expectTrackEvent(t, events, trackEvent{false, "b", nil})
+
+	if p.Playing() != nil {
+		t.Errorf("nothing should be playing, got %+v", p.Playing())
+	}
+}
+
+func TestVoicePlayerPauseSkipStop(t *testing.T) {
+	p, send, events := newTestPlayer()
+
+	p.Enqueue(testTrack("a", 10), testTrack("b", 10))
+	expectTrackEvent(t, events, trackEvent{true, "a", nil})
+	expectFrame(t, send, []byte{0xFC, 1})
+
+	p.Pause()
+	if !p.Paused() {
+		t.Errorf("player should be paused")
+	}
+
+	// The frame read before pausing may still be sent.
+	select {
+	case <-send:
+	case <-time.After(50 * time.Millisecond):
+	}
+	select {
+	case f := <-send:
+		t.Fatalf("paused player should not send frames, got %x", f)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	p.Skip()
+	expectTrackEvent(t, events, trackEvent{false, "a", ErrTrackSkipped})
+	expectTrackEvent(t, events, trackEvent{true, "b", nil})
+
+	p.Resume()
+	expectFrame(t, send, []byte{0xFC, 1})
+
+	p.Stop()
+	expectTrackEvent(t, events, trackEvent{false, "b", ErrPlayerStopped})
+
+	if err := p.Enqueue(testTrack("c", 1)); err != ErrPlayerStopped {
+		t.Errorf("stopped player should not queue tracks, got %+v", err)
+	}
+}
+
+func TestOpusSenderSilence(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP returned error: %+v", err)
+	}
+	defer server.Close()
+
+	udpConn, err := net.DialUDP("udp", nil, server.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("DialUDP returned error: %+v", err)
+	}
+	defer udpConn.Close()
+
+	c, _ := newVoiceCipher(VoiceModeXChaCha20Poly1305RTPSize, testVoiceKey())
+	v := &VoiceConnection{cipher: c}
+
+	// 10ms frames
+	opus := make(chan []byte, 2)
+	stop := make(chan struct{})
+	defer close(stop)
+	go v.opusSender(udpConn, stop, opus, 48000, 480)
+
+	recv := func() ([]byte, uint16, uint32) {
+		b := make([]byte, 128)
+		server.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := server.Read(b)
+		if err != nil {
+			t.Fatalf("packet was not sent: %+v", err)
+		}
+
+		payload, err := c.open(b[:n])
+		if err != nil {
+			t.Fatalf("packet could not be decrypted: %+v", err)
+		}
+		return payload, binary.BigEndian.Uint16(b[2:]), binary.BigEndian.Uint32(b[4:])
+	}
+
+	frame := []byte{0xF0, 1}
+	opus <- frame
+	if p, seq, ts := recv(); !bytes.Equal(p, frame) || seq != 0 || ts != 0 {
+		t.Errorf("first packet should be %x with sequence 0 and timestamp 0, got %x, %d, %d", frame, p, seq, ts)
+	}
+
+	for i := 1; i <= voiceSilenceFrames; i++ {
+		if p, seq, ts := recv(); !bytes.Equal(p, opusSilenceFrame) || seq != uint16(i) || ts != uint32(i*480) {
+			t.Errorf("packet %d should be silence with timestamp %d, got %x, %d, %d", i, i*480, p, seq, ts)
+		}
+	}
+
+	// The timestamp keeps counting while nothing is sent.
+	time.Sleep(100 * time.Millisecond)
+	opus <- frame
+	p, seq, ts := recv()
+	if !bytes.Equal(p, frame) || seq != voiceSilenceFrames+1 || ts < 15*480 {
+		t.Errorf("packet after the pause should be %x with sequence %d and a timestamp of 15 frames, got %x, %d, %d", frame, voiceSilenceFrames+1, p, seq, ts)
+	}
+}
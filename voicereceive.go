@@ -0,0 +1,328 @@
+package discordgo
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// VoiceJitterDelay is the longest time a packet received with ReceiveUser is
+// held back, waiting for the packets sent before it. The packets still
+// missing after it are counted as lost.
+var VoiceJitterDelay = 100 * time.Millisecond
+
+// The sample rate and frame size of the opus audio sent by Discord clients.
+const (
+	voiceSampleRate = 48000
+	voiceFrameSize  = 960
+)
+
+// An RTPHeaderExtension is an element of the header extension of a received
+// RTP packet.
+type RTPHeaderExtension struct {
+	ID   byte
+	Data []byte
+}
+
+// parseRTPPayload splits the payload of a received RTP packet, as returned by
+// voiceCipher.open, into the elements of its header extension and its opus
+// audio. first is the first byte of the RTP header.
+func parseRTPPayload(first byte, payload []byte) ([]RTPHeaderExtension, []byte, bool) {
+	// Padding is counted by the last byte of the payload
+	if first&0x20 != 0 {
+		if len(payload) == 0 || int(payload[len(payload)-1]) > len(payload) {
+			return nil, nil, false
+		}
+		payload = payload[:len(payload)-int(payload[len(payload)-1])]
+	}
+
+	// Skip the CSRCs
+	off := 4 * int(first&0x0F)
+	if off > len(payload) {
+		return nil, nil, false
+	}
+	payload = payload[off:]
+
+	if first&0x10 == 0 {
+		return nil, payload, true
+	}
+
+	if len(payload) < 4 {
+		return nil, nil, false
+	}
+	profile := binary.BigEndian.Uint16(payload)
+	end := 4 + 4*int(binary.BigEndian.Uint16(payload[2:]))
+	if end > len(payload) {
+		return nil, nil, false
+	}
+	ext, payload := payload[4:end], payload[end:]
+
+	// Only the one-byte and two-byte header formats of RFC 8285 have
+	// elements, the extensions of other profiles are skipped.
+	var elements []RTPHeaderExtension
+	for i := 0; i < len(ext); {
+		if ext[i] == 0 {
+			// Padding between elements
+			i++
+			continue
+		}
+
+		var id byte
+		var l int
+		switch {
+		case profile == 0xBEDE:
+			id, l = ext[i]>>4, int(ext[i]&0x0F)+1
+			if id == 15 {
+				return elements, payload, true
+			}
+			i++
+		case profile&0xFFF0 == 0x1000:
+			if i+1 >= len(ext) {
+				return nil, nil, false
+			}
+			id, l = ext[i], int(ext[i+1])
+			i += 2
+		default:
+			return nil, payload, true
+		}
+
+		if i+l > len(ext) {
+			return nil, nil, false
+		}
+		elements = append(elements, RTPHeaderExtension{ID: id, Data: ext[i : i+l]})
+		i += l
+	}
+
+	return elements, payload, true
+}
+
+// A heldPacket is a packet held back by a jitterBuffer, with its arrival time.
+type heldPacket struct {
+	p  *Packet
+	at time.Time
+}
+
+// A jitterBuffer puts the packets of an SSRC back in sequence order. Packets
+// are released once the packets before them are, or once a packet was held
+// back for VoiceJitterDelay.
+type jitterBuffer struct {
+	started   bool
+	next      uint16 // sequence of the next packet to release
+	timestamp uint32 // timestamp of the last packet released
+	held      map[uint16]heldPacket
+}
+
+func newJitterBuffer() *jitterBuffer {
+	return &jitterBuffer{held: make(map[uint16]heldPacket)}
+}
+
+// push adds a packet received at now, and returns the packets released.
+func (b *jitterBuffer) push(p *Packet, now time.Time) []*Packet {
+	// Packets far behind were sent by a restarted sender
+	if late := int16(p.Sequence - b.next); b.started && late < -voiceSampleRate/voiceFrameSize {
+		b.started = false
+		b.held = make(map[uint16]heldPacket)
+	}
+
+	if !b.started {
+		b.started = true
+		b.next = p.Sequence
+		b.timestamp = p.Timestamp - voiceFrameSize
+	}
+
+	// Drop late and duplicate packets
+	if _, ok := b.held[p.Sequence]; ok || int16(p.Sequence-b.next) < 0 {
+		return nil
+	}
+
+	b.held[p.Sequence] = heldPacket{p, now}
+	return b.release(now)
+}
+
+// release returns the packets that can be released at now.
+func (b *jitterBuffer) release(now time.Time) []*Packet {
+	var out []*Packet
+
+	for len(b.held) > 0 {
+		h, ok := b.held[b.next]
+		if !ok {
+			// Give up on the missing packets if a packet after them was
+			// held back for too long, and release the first packet held.
+			var first heldPacket
+			var expired bool
+			for _, o := range b.held {
+				if now.Sub(o.at) >= VoiceJitterDelay {
+					expired = true
+				}
+				if first.p == nil || int16(o.p.Sequence-first.p.Sequence) < 0 {
+					first = o
+				}
+			}
+			if !expired {
+				break
+			}
+			h = first
+		}
+
+		delete(b.held, h.p.Sequence)
+		out = append(out, b.released(h.p))
+	}
+
+	return out
+}
+
+// released sets the packets lost and the silence before a released packet.
+func (b *jitterBuffer) released(p *Packet) *Packet {
+	p.Lost = int(p.Sequence - b.next)
+
+	samples := p.Timestamp - b.timestamp
+	if expected := uint32(p.Lost+1) * voiceFrameSize; samples > expected && samples < 1<<31 {
+		p.Silence = time.Duration(samples-expected) * time.Second / voiceSampleRate
+	}
+
+	b.next = p.Sequence + 1
+	b.timestamp = p.Timestamp
+	return p
+}
+
+// A voiceStream is the channel receiving the audio of a single user.
+type voiceStream struct {
+	c    chan *Packet
+	done chan struct{}
+}
+
+// send sends a packet on the stream, unless the stream is stopped. It
+// returns false if close was closed first.
+func (s *voiceStream) send(p *Packet, close <-chan struct{}) bool {
+	select {
+	case s.c <- p:
+	case <-s.done:
+	case <-close:
+		return false
+	}
+	return true
+}
+
+// ReceiveUser returns a channel receiving the audio of a user in sequence
+// order. Late packets are dropped, and missing packets are reported by the
+// Lost field of the packet after them, see VoiceJitterDelay.
+// The audio of the user is no longer sent on OpusRecv, until StopReceiveUser
+// is called.
+// userID : The ID of a User.
+func (v *VoiceConnection) ReceiveUser(userID string) <-chan *Packet {
+	v.Lock()
+	defer v.Unlock()
+
+	if v.userStreams == nil {
+		v.userStreams = make(map[string]*voiceStream)
+	}
+
+	s, ok := v.userStreams[userID]
+	if !ok {
+		s = &voiceStream{c: make(chan *Packet, 16), done: make(chan struct{})}
+		v.userStreams[userID] = s
+	}
+
+	return s.c
+}
+
+// StopReceiveUser stops sending the audio of a user on the channel returned
+// by ReceiveUser, which is left open.
+// userID : The ID of a User.
+func (v *VoiceConnection) StopReceiveUser(userID string) {
+	v.Lock()
+	defer v.Unlock()
+
+	if s, ok := v.userStreams[userID]; ok {
+		close(s.done)
+		delete(v.userStreams, userID)
+	}
+}
+
+// UserIDBySSRC returns the ID of the user sending audio with an SSRC. Users
+// are known once they started speaking.
+// ssrc : The SSRC of received packets.
+func (v *VoiceConnection) UserIDBySSRC(ssrc uint32) (string, bool) {
+	v.RLock()
+	defer v.RUnlock()
+
+	userID, ok := v.ssrcUsers[ssrc]
+	return userID, ok
+}
+
+// setSSRCUser stores the user sending audio with an SSRC.
+func (v *VoiceConnection) setSSRCUser(ssrc uint32, userID string) {
+	v.Lock()
+	defer v.Unlock()
+
+	if v.ssrcUsers == nil {
+		v.ssrcUsers = make(map[uint32]string)
+	}
+
+	v.ssrcUsers[ssrc] = userID
+}
+
+// removeUser removes the SSRCs and the speaking flags of a user who left the
+// voice channel.
+func (v *VoiceConnection) removeUser(userID string) {
+	v.Lock()
+	defer v.Unlock()
+
+	for ssrc, id := range v.ssrcUsers {
+		if id == userID {
+			delete(v.ssrcUsers, ssrc)
+		}
+	}
+
+	delete(v.speakingUsers, userID)
+}
+
+// setSpeakingUser stores the speaking flags of a user, a user without flags
+// stopped speaking.
+func (v *VoiceConnection) setSpeakingUser(userID string, flags SpeakingFlags) {
+	v.Lock()
+	defer v.Unlock()
+
+	if flags == 0 {
+		delete(v.speakingUsers, userID)
+		return
+	}
+
+	if v.speakingUsers == nil {
+		v.speakingUsers = make(map[string]SpeakingFlags)
+	}
+
+	v.speakingUsers[userID] = flags
+}
+
+// SpeakingUsers returns the speaking flags of the users speaking, by user ID,
+// as last notified by Discord.
+func (v *VoiceConnection) SpeakingUsers() map[string]SpeakingFlags {
+	v.RLock()
+	defer v.RUnlock()
+
+	users := make(map[string]SpeakingFlags, len(v.speakingUsers))
+	for userID, flags := range v.speakingUsers {
+		users[userID] = flags
+	}
+	return users
+}
+
+// UserSpeaking returns the speaking flags of a user, no flags if the user is
+// not speaking.
+// userID : The ID of a User.
+func (v *VoiceConnection) UserSpeaking(userID string) SpeakingFlags {
+	v.RLock()
+	defer v.RUnlock()
+
+	return v.speakingUsers[userID]
+}
+
+// userStream returns the user and their stream of an SSRC, the stream is nil
+// if the user is not received with ReceiveUser.
+func (v *VoiceConnection) userStream(ssrc uint32) (string, *voiceStream) {
+	v.RLock()
+	defer v.RUnlock()
+
+	userID := v.ssrcUsers[ssrc]
+	return userID, v.userStreams[userID]
+}
@@ -0,0 +1,249 @@
+package discordgo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRTPPayload(t *testing.T) {
+	tests := []struct {
+		name       string
+		first      byte
+		payload    string
+		extensions []RTPHeaderExtension
+		opus       string
+	}{
+		{"plain", 0x80, "f8fffe", nil, "f8fffe"},
+		{"csrc", 0x81, "00000001f8fffe", nil, "f8fffe"},
+		{"padding", 0xa0, "f8fffe000003", nil, "f8fffe"},
+		{"one-byte", 0x90, "bede0002" + "10ff" + "00" + "2101020000" + "f8fffe", []RTPHeaderExtension{{1, []byte{0xff}}, {2, []byte{1, 2}}}, "f8fffe"},
+		{"one-byte stop", 0x90, "bede0001" + "10fff000" + "f8fffe", []RTPHeaderExtension{{1, []byte{0xff}}}, "f8fffe"},
+		{"two-byte", 0x90, "10000001" + "0102aabb" + "f8fffe", []RTPHeaderExtension{{1, []byte{0xaa, 0xbb}}}, "f8fffe"},
+		{"other profile", 0x90, "abcd0001" + "01020304" + "f8fffe", nil, "f8fffe"},
+	}
+
+	for _, test := range tests {
+		payload, _ := hex.DecodeString(test.payload)
+		extensions, opus, ok := parseRTPPayload(test.first, payload)
+		if !ok {
+			t.Errorf("%s: parseRTPPayload should succeed", test.name)
+			continue
+		}
+
+		if hex.EncodeToString(opus) != test.opus {
+			t.Errorf("%s: opus should be %s, got %x", test.name, test.opus, opus)
+		}
+
+		if len(extensions) != len(test.extensions) {
+			t.Errorf("%s: extensions should be %v, got %v", test.name, test.extensions, extensions)
+			continue
+		}
+		for i, e := range extensions {
+			if e.ID != test.extensions[i].ID || !bytes.Equal(e.Data, test.extensions[i].Data) {
+				t.Errorf("%s: extension %d should be %v, got %v", test.name, i, test.extensions[i], e)
+			}
+		}
+	}
+
+	for _, malformed := range []string{"bede0002" + "10ff", "bede0001" + "3fff0000", "bede"} {
+		payload, _ := hex.DecodeString(malformed)
+		if _, _, ok := parseRTPPayload(0x90, payload); ok {
+			t.Errorf("parseRTPPayload(%s) should fail", malformed)
+		}
+	}
+}
+
+func testPacket(seq uint16, timestamp uint32) *Packet {
+	return &Packet{Sequence: seq, Timestamp: timestamp}
+}
+
+func TestJitterBuffer(t *testing.T) {
+	now := time.Now()
+	b := newJitterBuffer()
+
+	check := func(name string, ps []*Packet, want ...uint16) {
+		got := []uint16{}
+		for _, p := range ps {
+			got = append(got, p.Sequence)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: released packets should be %v, got %v", name, want, got)
+		}
+	}
+
+	check("first", b.push(testPacket(65534, 0), now), 65534)
+	check("out of order", b.push(testPacket(0, 1920), now))
+	check("wrap around", b.push(testPacket(65535, 960), now), 65535, 0)
+	check("duplicate", b.push(testPacket(0, 1920), now))
+	check("late", b.push(testPacket(65530, 0), now))
+
+	// Packet 1 is lost, packet 3 is held until it expires.
+	check("gap", b.push(testPacket(3, 3840), now))
+	check("held", b.push(testPacket(2, 2880), now.Add(VoiceJitterDelay/2)))
+	ps := b.release(now.Add(VoiceJitterDelay))
+	check("expired", ps, 2, 3)
+	if ps[0].Lost != 1 || ps[0].Silence != 0 || ps[1].Lost != 0 {
+		t.Errorf("packet 2 should follow 1 lost packet, got %d and %d lost", ps[0].Lost, ps[1].Lost)
+	}
+
+	// A second of silence before packet 4.
+	ps = b.push(testPacket(4, 3840+960+voiceSampleRate), now)
+	if len(ps) != 1 || ps[0].Lost != 0 || ps[0].Silence != time.Second {
+		t.Errorf("packet 4 should follow a second of silence, got %+v", ps)
+	}
+
+	// A restarted sender starts over.
+	check("restart", b.push(testPacket(60000, 0), now), 60000)
+	check("restarted", b.push(testPacket(60001, 960), now), 60001)
+}
+
+// newTestReceiver returns a voice connection receiving on udp with an
+// opusReceiver, and a function sending it packets with their sequence as
+// payload.
+func newTestReceiver(t *testing.T, recv chan *Packet) (*VoiceConnection, func(ssrc uint32, seq uint16)) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP returned error: %+v", err)
+	}
+
+	udpConn, err := net.DialUDP("udp", nil, server.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("DialUDP returned error: %+v", err)
+	}
+
+	c, _ := newVoiceCipher(VoiceModeXChaCha20Poly1305RTPSize, testVoiceKey())
+	v := &VoiceConnection{udpConn: udpConn, cipher: c, close: make(chan struct{})}
+	v.AddHandler(func(v *VoiceConnection, e *VoiceDisconnected) { server.Close() })
+
+	go v.opusReceiver(udpConn, v.close, recv)
+
+	return v, func(ssrc uint32, seq uint16) {
+		header := make([]byte, 12)
+		header[0], header[1] = 0x80, 0x78
+		binary.BigEndian.PutUint16(header[2:], seq)
+		binary.BigEndian.PutUint32(header[4:], uint32(seq)*voiceFrameSize)
+		binary.BigEndian.PutUint32(header[8:], ssrc)
+		server.WriteToUDP(c.seal(nil, header, []byte{byte(seq)}), udpConn.LocalAddr().(*net.UDPAddr))
+	}
+}
+
+func TestOpusReceiverUsers(t *testing.T) {
+	recv := make(chan *Packet, 8)
+	v, send := newTestReceiver(t, recv)
+	defer v.Close()
+
+	v.setSSRCUser(1, "a")
+	v.setSSRCUser(2, "b")
+	stream := v.ReceiveUser("a")
+
+	for _, seq := range []uint16{10, 12, 11, 14} {
+		send(1, seq)
+	}
+	send(2, 5)
+
+	p := <-recv
+	if p.UserID != "b" || p.Sequence != 5 || !bytes.Equal(p.Opus, []byte{5}) {
+		t.Errorf("packet of user b should be sent on OpusRecv, got %+v", p)
+	}
+
+	for _, want := range []struct {
+		seq  uint16
+		lost int
+	}{{10, 0}, {11, 0}, {12, 0}, {14, 1}} {
+		select {
+		case p := <-stream:
+			if p.UserID != "a" || p.Sequence != want.seq || p.Lost != want.lost || !bytes.Equal(p.Opus, []byte{byte(want.seq)}) {
+				t.Errorf("packet %d of user a should follow %d lost, got %+v", want.seq, want.lost, p)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("packet %d of user a was not received", want.seq)
+		}
+	}
+
+	if userID, ok := v.UserIDBySSRC(2); !ok || userID != "b" {
+		t.Errorf("SSRC 2 should be of user b, got %s", userID)
+	}
+	v.removeUser("b")
+	if _, ok := v.UserIDBySSRC(2); ok {
+		t.Errorf("SSRC 2 should be removed with user b")
+	}
+}
+
+func TestOpusReceiverReleaseWhileReceiving(t *testing.T) {
+	recv := make(chan *Packet, 8)
+	v, send := newTestReceiver(t, recv)
+	defer v.Close()
+
+	v.setSSRCUser(1, "a")
+	v.setSSRCUser(2, "b")
+	stream := v.ReceiveUser("a")
+
+	// Packet 11 of user a never arrives, while user b keeps sending
+	// faster than the receiver wakes up on its own.
+	send(1, 10)
+	send(1, 12)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for seq := uint16(0); ; seq++ {
+			select {
+			case <-stop:
+				return
+			case <-recv:
+			case <-time.After(VoiceJitterDelay / 10):
+				send(2, seq)
+			}
+		}
+	}()
+
+	for _, want := range []uint16{10, 12} {
+		select {
+		case p := <-stream:
+			if p.Sequence != want {
+				t.Errorf("packet %d of user a should be received, got %+v", want, p)
+			}
+		case <-time.After(3 * VoiceJitterDelay):
+			t.Fatalf("packet %d of user a was not released", want)
+		}
+	}
+}
+
+func TestVoiceSpeakingUsers(t *testing.T) {
+	v := &VoiceConnection{}
+
+	var updates []SpeakingFlags
+	v.AddHandler(func(v *VoiceConnection, e *VoiceSpeakingUpdate) { updates = append(updates, e.Speaking) })
+
+	v.onEvent([]byte(`{"op":5,"d":{"user_id":"a","ssrc":1,"speaking":5}}`))
+	v.onEvent([]byte(`{"op":5,"d":{"user_id":"b","ssrc":2,"speaking":true}}`))
+	v.onEvent([]byte(`{"op":5,"d":{"user_id":"c","ssrc":3,"speaking":1}}`))
+	v.onEvent([]byte(`{"op":5,"d":{"user_id":"c","ssrc":3,"speaking":0}}`))
+
+	want := []SpeakingFlags{SpeakingMicrophone | SpeakingPriority, SpeakingMicrophone, SpeakingMicrophone, 0}
+	if !reflect.DeepEqual(updates, want) {
+		t.Errorf("speaking updates should be %v, got %v", want, updates)
+	}
+
+	users := v.SpeakingUsers()
+	if len(users) != 2 || users["a"] != SpeakingMicrophone|SpeakingPriority || users["b"] != SpeakingMicrophone {
+		t.Errorf("users a and b should be speaking, got %v", users)
+	}
+	if userID, ok := v.UserIDBySSRC(3); !ok || userID != "c" {
+		t.Errorf("SSRC 3 should be of user c, got %s", userID)
+	}
+
+	v.onEvent([]byte(`{"op":13,"d":{"user_id":"a"}}`))
+	if flags := v.UserSpeaking("a"); flags != 0 {
+		t.Errorf("user a should stop speaking once disconnected, got %d", flags)
+	}
+	if _, ok := v.UserIDBySSRC(1); ok {
+		t.Errorf("SSRC 1 should be removed with user a")
+	}
+}
@@ -310,10 +310,11 @@ func (s *Session) heartbeat(wsConn *websocket.Conn, listening <-chan interface{}
 
 // UpdateStatusData ia provided to UpdateStatusComplex()
 type UpdateStatusData struct {
-	IdleSince *int   `json:"since"`
-	Game      *Game  `json:"game"`
-	AFK       bool   `json:"afk"`
-	Status    string `json:"status"`
+	IdleSince  *int        `json:"since"`
+	Game       *Game       `json:"game"`
+	Activities []*Activity `json:"activities,omitempty"`
+	AFK        bool        `json:"afk"`
+	Status     string      `json:"status"`
 }
 
 type updateStatusOp struct {
@@ -369,6 +370,34 @@ func (s *Session) UpdateListeningStatus(game string) (err error) {
 	return s.UpdateStatusComplex(*newUpdateStatusData(0, GameTypeListening, game, ""))
 }
 
+// UpdateCompetingStatus is used to set the user to "Competing in..."
+// If name!="" then set to what user is competing in
+// Else, set user to active and no activity.
+func (s *Session) UpdateCompetingStatus(name string) (err error) {
+	usd := UpdateStatusData{Status: "online"}
+	if name != "" {
+		usd.Activities = []*Activity{{Name: name, Type: ActivityTypeCompeting}}
+	}
+	return s.UpdateStatusComplex(usd)
+}
+
+// UpdateCustomStatus is used to update the user's custom status.
+// If state!="" then set the custom status text.
+// If emoji!=nil then set the emoji shown in front of it.
+// if otherwise, set status to active, and no custom status.
+func (s *Session) UpdateCustomStatus(state string, emoji *Emoji) (err error) {
+	usd := UpdateStatusData{Status: "online"}
+	if state != "" || emoji != nil {
+		usd.Activities = []*Activity{{
+			Name:  "Custom Status",
+			Type:  ActivityTypeCustom,
+			State: state,
+			Emoji: emoji,
+		}}
+	}
+	return s.UpdateStatusComplex(usd)
+}
+
 // UpdateStatusComplex allows for sending the raw status update data untouched by discordgo.
 func (s *Session) UpdateStatusComplex(usd UpdateStatusData) (err error) {
 
@@ -466,6 +495,13 @@ func (s *Session) onEvent(messageType int, message []byte) (*Event, error) {
 
 	s.log(LogDebug, "Op: %d, Seq: %d, Type: %s, Data: %s\n\n", e.Operation, e.Sequence, e.Type, string(e.RawData))
 
+	// Write the raw payload to the recorder before anything acts on it.
+	if s.Recorder != nil {
+		if err := s.Recorder.Record(e); err != nil {
+			s.log(LogWarning, "error recording gateway event, %s", err)
+		}
+	}
+
 	// Ping request.
 	// Must respond with a heartbeat packet within 5 seconds
 	if e.Operation == 1 {
@@ -529,12 +565,22 @@ func (s *Session) onEvent(messageType int, message []byte) (*Event, error) {
 	// Store the message sequence
 	atomic.StoreInt64(s.sequence, e.Sequence)
 
+	s.dispatch(e)
+
+	return e, nil
+}
+
+// dispatch unmarshals an Op 0 (Dispatch) event into its registered struct
+// and passes it along to the event handlers. It leaves the sequence of the
+// session alone, so that replayed events don't change it.
+func (s *Session) dispatch(e *Event) {
+
 	// Map event to registered event handlers and pass it along to any registered handlers.
 	if eh, ok := registeredInterfaceProviders[e.Type]; ok {
 		e.Struct = eh.New()
 
 		// Attempt to unmarshal our event.
-		if err = json.Unmarshal(e.RawData, e.Struct); err != nil {
+		if err := json.Unmarshal(e.RawData, e.Struct); err != nil {
 			s.log(LogError, "error unmarshalling %s event, %s", e.Type, err)
 		}
 
@@ -552,8 +598,6 @@ func (s *Session) onEvent(messageType int, message []byte) (*Event, error) {
 
 	// For legacy reasons, we send the raw event also, this could be useful for handling unknown events.
 	s.handleEvent(eventEventType, e)
-
-	return e, nil
 }
 
 // ------------------------------------------------------------------------------------------------
@@ -691,7 +735,29 @@ func (s *Session) onVoiceServerUpdate(st *VoiceServerUpdate) {
 		return
 	}
 
-	// If currently connected to voice ws/udp, then disconnect.
+	// Discord sends a null endpoint while it allocates a new voice server,
+	// followed by another update once the server is ready.
+	if st.Endpoint == "" {
+		return
+	}
+
+	voice.Lock()
+	oldEndpoint := voice.endpoint
+	connected := voice.wsConn != nil
+	voice.GuildID = st.GuildID
+	voice.Unlock()
+
+	if oldEndpoint != "" && oldEndpoint != st.Endpoint {
+		voice.emit(&VoiceEndpointChanged{OldEndpoint: oldEndpoint, Endpoint: st.Endpoint})
+	}
+
+	// If currently connected to voice ws/udp, then move the connection to
+	// the new voice server.
+	if connected {
+		voice.migrate(st.Token, st.Endpoint)
+		return
+	}
+
 	// Has no effect if not connected.
 	voice.Close()
 
@@ -699,7 +765,6 @@ func (s *Session) onVoiceServerUpdate(st *VoiceServerUpdate) {
 	voice.Lock()
 	voice.token = st.Token
 	voice.endpoint = st.Endpoint
-	voice.GuildID = st.GuildID
 	voice.Unlock()
 
 	// Open a connection to the voice server
@@ -794,7 +859,7 @@ func (s *Session) reconnect() {
 				for _, v := range s.VoiceConnections {
 
 					s.log(LogInformational, "reconnecting voice connection to guild %s", v.GuildID)
-					go v.reconnect()
+					go v.reconnect(nil)
 
 					// This is here just to prevent violently spamming the
 					// voice reconnects